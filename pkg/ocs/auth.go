@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes granted to API clients. Each route requires one; admin grants all of them.
+const (
+	ScopeRead    = "read"    // Read prompts, analyses and configuration
+	ScopeCollect = "collect" // Trigger collection and import topology
+	ScopeAdmin   = "admin"   // Reload and change configuration
+)
+
+// authScopes lists the valid scopes
+var authScopes = []string{ScopeRead, ScopeCollect, ScopeAdmin}
+
+// How a principal authenticated
+const (
+	AuthMethodNone   = "none"
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+	AuthMethodMTLS   = "mtls"
+)
+
+// principalContextKey is the gin context key holding the authenticated principal
+const principalContextKey = "principal"
+
+// Principal is an authenticated API client
+type Principal struct {
+	Name   string
+	Method string
+	Scopes []string
+}
+
+// anonymousPrincipal is used for requests without credentials while auth is disabled. It can only
+// read: collect and admin routes always require credentials.
+var anonymousPrincipal = &Principal{Name: "anonymous", Method: AuthMethodNone, Scopes: []string{ScopeRead}}
+
+// hasScope reports whether the principal was granted scope, directly or through admin
+func (p *Principal) hasScope(scope string) bool {
+	return containsString(p.Scopes, scope) || containsString(p.Scopes, ScopeAdmin)
+}
+
+// apiKey is a configured API key, kept only as a hash
+type apiKey struct {
+	name   string
+	hash   []byte
+	scopes []string
+}
+
+// authenticator identifies the principal behind a request from its API key, bearer token or
+// client certificate
+type authenticator struct {
+	enabled     bool
+	apiKeys     []apiKey
+	jwt         *jwtVerifier        // nil unless auth.jwt.jwks_file is set
+	mtlsClients map[string][]string // scopes by certificate common name
+}
+
+// newAuthenticator builds the authenticator for the auth section and server.admin_token
+func newAuthenticator(config *Config) (*authenticator, error) {
+	auth := &authenticator{
+		enabled:     config.Auth.Enabled,
+		mtlsClients: make(map[string][]string),
+	}
+
+	for _, key := range config.Auth.APIKeys {
+		hash := sha256.Sum256([]byte(key.Key))
+		keyHash := hash[:]
+		if key.KeySHA256 != "" {
+			decoded, err := hex.DecodeString(key.KeySHA256)
+			if err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("API key %s: key_sha256 must be a hex-encoded SHA-256 hash", key.Name)
+			}
+			keyHash = decoded
+		}
+		auth.apiKeys = append(auth.apiKeys, apiKey{name: key.Name, hash: keyHash, scopes: key.Scopes})
+	}
+	if token := config.Server.AdminToken; token != "" {
+		hash := sha256.Sum256([]byte(token))
+		auth.apiKeys = append(auth.apiKeys, apiKey{name: "admin_token", hash: hash[:], scopes: []string{ScopeAdmin}})
+	}
+
+	if config.Auth.JWT.JWKSFile != "" {
+		verifier, err := newJWTVerifier(config.Auth.JWT)
+		if err != nil {
+			return nil, err
+		}
+		auth.jwt = verifier
+	}
+
+	for _, client := range config.Auth.MTLS.Clients {
+		auth.mtlsClients[client.CommonName] = client.Scopes
+	}
+	return auth, nil
+}
+
+// hasCredentials reports whether any way of authenticating is configured
+func (a *authenticator) hasCredentials() bool {
+	return len(a.apiKeys) > 0 || a.jwt != nil || len(a.mtlsClients) > 0
+}
+
+// authenticate returns the principal identified by a request's credentials, nil if it carries
+// none, or an error if they are invalid. A verified client certificate is tried first, then the
+// X-API-Key header, then the Authorization bearer token, which may be a JWT or an API key.
+func (a *authenticator) authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		commonName := req.TLS.PeerCertificates[0].Subject.CommonName
+		if scopes, ok := a.mtlsClients[commonName]; ok {
+			return &Principal{Name: commonName, Method: AuthMethodMTLS, Scopes: scopes}, nil
+		}
+	}
+
+	if key := req.Header.Get("X-API-Key"); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return nil, fmt.Errorf("unsupported authorization scheme")
+	}
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		return a.jwt.verify(token, time.Now())
+	}
+	return a.authenticateAPIKey(token)
+}
+
+// authenticateAPIKey returns the principal of the API key matching key
+func (a *authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(key))
+	var match *apiKey
+	for i := range a.apiKeys {
+		// Compare against every key so the time taken does not reveal which one matched
+		if subtle.ConstantTimeCompare(hash[:], a.apiKeys[i].hash) == 1 {
+			match = &a.apiKeys[i]
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	return &Principal{Name: match.name, Method: AuthMethodAPIKey, Scopes: match.scopes}, nil
+}
+
+// requireScope returns middleware that authenticates the request and requires scope. While auth
+// is disabled, requests without credentials may read. Requests that need more than read, and
+// every rejected request, are written to the audit log.
+func (s *Server) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := s.activeConfig().authenticator
+		principal, err := auth.authenticate(c.Request)
+		switch {
+		case err != nil:
+			s.rejectRequest(c, http.StatusUnauthorized, scope, nil, fmt.Sprintf("Authentication failed: %v", err))
+			return
+		case principal == nil && !auth.enabled && scope == ScopeRead:
+			principal = anonymousPrincipal
+		case principal == nil && !auth.hasCredentials():
+			s.rejectRequest(c, http.StatusForbidden, scope, nil, fmt.Sprintf("Endpoints needing the %s scope are disabled; set server.admin_token or configure auth to enable them", scope))
+			return
+		case principal == nil:
+			s.rejectRequest(c, http.StatusUnauthorized, scope, nil, "Authentication required")
+			return
+		}
+		// While auth is disabled, a key never grants less than sending no credentials would
+		if !principal.hasScope(scope) && (auth.enabled || scope != ScopeRead) {
+			s.rejectRequest(c, http.StatusForbidden, scope, principal, fmt.Sprintf("%s lacks the %s scope", principal.Name, scope))
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+		if scope != ScopeRead {
+			auditLog(c, principal, scope, "allowed")
+		}
+	}
+}
+
+// rejectRequest aborts a request that failed authentication or authorization
+func (s *Server) rejectRequest(c *gin.Context, status int, scope string, principal *Principal, message string) {
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Bearer realm="ocs"`)
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"status":  "error",
+		"message": message,
+	})
+	auditLog(c, principal, scope, "denied: "+message)
+}
+
+// auditLog records who called which route with which outcome
+func auditLog(c *gin.Context, principal *Principal, scope, outcome string) {
+	name, method := "-", "-"
+	if principal != nil {
+		name, method = principal.Name, principal.Method
+	}
+	log.Printf("AUDIT principal=%q method=%s scope=%s request=%q status=%d remote=%s outcome=%q",
+		name, method, scope, c.Request.Method+" "+c.Request.URL.RequestURI(), c.Writer.Status(), c.ClientIP(), outcome)
+}
+
+// newServerTLSConfig builds the TLS configuration for HTTPS. With a client CA, client
+// certificates are requested and verified, but only required by routes that need them.
+func newServerTLSConfig(config ServerConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	data, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", config.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
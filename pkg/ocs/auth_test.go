@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withKeys := &Config{Auth: AuthConfig{APIKeys: []APIKeyConfig{
+		{Name: "dashboards", Key: "read-key", Scopes: []string{ScopeRead}},
+		{Name: "collector", Key: "collect-key", Scopes: []string{ScopeCollect}},
+	}}}
+	enabled := *withKeys
+	enabled.Auth.Enabled = true
+
+	tests := []struct {
+		name   string
+		config *Config
+		scope  string
+		apiKey string
+		want   int
+	}{
+		{name: "anonymous read while disabled", config: &Config{}, scope: ScopeRead, want: http.StatusOK},
+		{name: "anonymous collect without credentials configured", config: &Config{}, scope: ScopeCollect, want: http.StatusForbidden},
+		{name: "anonymous collect while disabled", config: withKeys, scope: ScopeCollect, want: http.StatusUnauthorized},
+		{name: "anonymous admin while disabled", config: withKeys, scope: ScopeAdmin, want: http.StatusUnauthorized},
+		{name: "read key reads while disabled", config: withKeys, scope: ScopeRead, apiKey: "read-key", want: http.StatusOK},
+		{name: "read key collects while disabled", config: withKeys, scope: ScopeCollect, apiKey: "read-key", want: http.StatusForbidden},
+		{name: "collect key collects while disabled", config: withKeys, scope: ScopeCollect, apiKey: "collect-key", want: http.StatusOK},
+		{name: "collect key reads while disabled", config: withKeys, scope: ScopeRead, apiKey: "collect-key", want: http.StatusOK},
+		{name: "invalid key while disabled", config: withKeys, scope: ScopeRead, apiKey: "wrong", want: http.StatusUnauthorized},
+		{name: "anonymous read while enabled", config: &enabled, scope: ScopeRead, want: http.StatusUnauthorized},
+		{name: "collect key reads while enabled", config: &enabled, scope: ScopeRead, apiKey: "collect-key", want: http.StatusForbidden},
+		{name: "collect key collects while enabled", config: &enabled, scope: ScopeCollect, apiKey: "collect-key", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := newAuthenticator(tt.config)
+			if err != nil {
+				t.Fatalf("newAuthenticator() error = %v", err)
+			}
+			server := &Server{}
+			server.config.Store(&ActiveConfig{authenticator: auth})
+
+			router := gin.New()
+			router.GET("/", server.requireScope(tt.scope), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultBackfillBucketMinutes is the length of each backfilled snapshot's window unless bucket_minutes is set
+const defaultBackfillBucketMinutes = 60
+
+// maxBackfillBuckets bounds the snapshots one backfill may save
+const maxBackfillBuckets = 10000
+
+// defaultBackfillListLimit is how many backfills GET /topology/backfills returns unless limit is set
+const defaultBackfillListLimit = 20
+
+// backfillBuckets splits a backfill's range into the windows it saves a snapshot for
+func backfillBuckets(backfill *BackfillDocument) []CollectionRequest {
+	req := CollectionRequest{Workloads: backfill.Workloads, From: &backfill.From, To: &backfill.To, Historical: true}
+	return req.chunks(time.Duration(backfill.BucketMinutes) * time.Minute)
+}
+
+// backfillProviders names the providers a backfill collects with, along with their instances
+func backfillProviders(providers []ContextProvider) []string {
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		name := provider.Name()
+		if instance := provider.Instance(); instance != "" {
+			name += "/" + instance
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// backfillHandler handles the topology/backfill endpoint
+func (s *Server) backfillHandler(c *gin.Context) {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+	if len(cfg.ocsConfig.Workload) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "No source workloads configured in ocs_config.yaml",
+		})
+		return
+	}
+	if c.Query("from_timestamp") == "" || c.Query("to_timestamp") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "from_timestamp and to_timestamp are required",
+		})
+		return
+	}
+	fromTimestamp, toTimestamp, err := parseTimestampParams(c, cfg.ocsConfig)
+	if err == nil && !fromTimestamp.Before(*toTimestamp) {
+		err = fmt.Errorf("from_timestamp must be before to_timestamp")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	bucketMinutes := defaultBackfillBucketMinutes
+	if bucketStr := c.Query("bucket_minutes"); bucketStr != "" {
+		bucketMinutes, err = strconv.Atoi(bucketStr)
+		if err != nil || bucketMinutes <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid bucket_minutes: %s", bucketStr),
+			})
+			return
+		}
+	}
+
+	now := time.Now()
+	backfill := &BackfillDocument{
+		Profile:       cfg.profile,
+		From:          *fromTimestamp,
+		To:            *toTimestamp,
+		BucketMinutes: bucketMinutes,
+		Workloads:     cfg.ocsConfig.Workload,
+		Providers:     backfillProviders(cfg.providers),
+		Status:        JobQueued,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	backfill.BucketsTotal = len(backfillBuckets(backfill))
+	if backfill.BucketsTotal > maxBackfillBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Backfill would save %d snapshots, more than the %d allowed; use longer buckets or a shorter range", backfill.BucketsTotal, maxBackfillBuckets),
+		})
+		return
+	}
+	if !s.allowCollection(c, cfg.config.CollectionLimits) {
+		return
+	}
+
+	if err := s.mongoRepo.SaveBackfill(backfill); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to save backfill: %v", err),
+		})
+		return
+	}
+	if !s.startBackfillJob(c, cfg, backfill) {
+		// The saved backfill would otherwise stay queued with no job to run it
+		backfill.Status, backfill.Error = JobFailed, errTooManyJobs.Error()
+		if err := s.updateBackfill(backfill); err != nil {
+			log.Printf("Failed to mark backfill %s failed: %v", backfill.ID.Hex(), err)
+		}
+	}
+}
+
+// resumeBackfillHandler handles the topology/backfills/:id/resume endpoint
+func (s *Server) resumeBackfillHandler(c *gin.Context) {
+	backfill, ok := s.requestBackfill(c)
+	if !ok {
+		return
+	}
+	if backfill.Status == JobSucceeded {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Backfill %s is complete", backfill.ID.Hex()),
+		})
+		return
+	}
+	if jobID, running := s.jobs.runningBackfill(backfill.ID.Hex()); running {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Backfill %s is already running as job %s", backfill.ID.Hex(), jobID),
+		})
+		return
+	}
+	cfg, ok := s.profile(backfill.Profile)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Profile %s of backfill %s no longer exists", backfill.Profile, backfill.ID.Hex()),
+		})
+		return
+	}
+	// Backfills saved before their workloads and providers were recorded use the current ones
+	if backfill.Workloads == nil {
+		backfill.Workloads = cfg.ocsConfig.Workload
+	}
+	// The providers cannot be rebuilt from an older configuration, so snapshots collected with
+	// different ones would mix into the same backfill
+	if providers := backfillProviders(cfg.providers); backfill.Providers != nil && !slices.Equal(providers, backfill.Providers) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"message": fmt.Sprintf("The providers of profile %s changed since backfill %s started, from %s to %s; start a new backfill",
+				backfill.Profile, backfill.ID.Hex(), strings.Join(backfill.Providers, ", "), strings.Join(providers, ", ")),
+		})
+		return
+	}
+	if !s.allowCollection(c, cfg.config.CollectionLimits) {
+		return
+	}
+	s.startBackfillJob(c, cfg, backfill)
+}
+
+// startBackfillJob queues a job saving the snapshots a backfill is missing, and responds with it.
+// It returns false, having responded with 429, if the job was turned away.
+func (s *Server) startBackfillJob(c *gin.Context, cfg *ActiveConfig, backfill *BackfillDocument) bool {
+	buckets := backfillBuckets(backfill)
+	job := newCollectionJob(c, cfg, JobKindBackfill, &backfill.From, &backfill.To)
+	job.BackfillID = backfill.ID.Hex()
+	job.Progress.BucketsTotal = len(buckets)
+	for _, provider := range cfg.providers {
+		chunks := 0
+		for _, bucket := range buckets {
+			chunks += len(providerChunks(provider, bucket))
+		}
+		job.Progress.ChunksTotal += chunks
+		job.Progress.Providers = append(job.Progress.Providers, ProviderProgress{
+			Provider:    provider.Name(),
+			Instance:    provider.Instance(),
+			Status:      JobQueued,
+			ChunksTotal: chunks,
+		})
+	}
+
+	run := *backfill
+	run.JobID = job.ID
+	limits := cfg.config.CollectionLimits
+	job, err := s.jobs.start(job, func(ctx context.Context) (string, bool, error) {
+		_, _, err := s.collectionLimiter.do(ctx, "backfill|"+run.ID.Hex(), limits, true, func() (*collectionResult, error) {
+			return nil, s.runBackfill(ctx, cfg, run, buckets)
+		})
+		return "", false, err
+	})
+	if err != nil {
+		respondTooManyJobs(c)
+		return false
+	}
+
+	backfill.JobID, backfill.Status = job.ID, JobQueued
+	c.Header("Location", "/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":   "accepted",
+		"message":  "Backfill started",
+		"job":      job,
+		"backfill": backfill,
+	})
+	return true
+}
+
+// runBackfill saves a snapshot for every bucket of a backfill that does not have one yet, in
+// order, recording its progress in MongoDB after each. Nothing more is saved once ctx is cancelled.
+func (s *Server) runBackfill(ctx context.Context, cfg *ActiveConfig, backfill BackfillDocument, buckets []CollectionRequest) (err error) {
+	store := s.store(cfg.profile)
+	saved, err := store.repo.BackfilledWindows(backfill.ID)
+	if err != nil {
+		return err
+	}
+
+	// chunksBefore counts each provider's chunks in the buckets already done
+	chunksBefore := make([]int, len(cfg.providers))
+	backfill.BucketsDone = 0
+	for _, bucket := range buckets {
+		if saved[bucket.From.Unix()] {
+			backfill.BucketsDone++
+			for i, provider := range cfg.providers {
+				chunksBefore[i] += len(providerChunks(provider, bucket))
+			}
+		}
+	}
+	s.jobs.update(backfill.JobID, func(job *CollectionJob) {
+		now := time.Now()
+		job.Status, job.StartedAt = JobRunning, &now
+		job.Progress.BucketsDone = backfill.BucketsDone
+		for i, chunks := range chunksBefore {
+			job.Progress.Providers[i].ChunksDone = chunks
+			job.Progress.ChunksDone += chunks
+		}
+	})
+
+	backfill.Status, backfill.Error = JobRunning, ""
+	if err := s.updateBackfill(&backfill); err != nil {
+		return err
+	}
+	defer func() {
+		switch {
+		case err == nil:
+			backfill.Status = JobSucceeded
+		case ctx.Err() != nil:
+			backfill.Status = JobCancelled
+		default:
+			backfill.Status, backfill.Error = JobFailed, err.Error()
+		}
+		if updateErr := s.updateBackfill(&backfill); updateErr != nil {
+			log.Printf("Failed to record the outcome of backfill %s: %v", backfill.ID.Hex(), updateErr)
+		}
+	}()
+
+	for _, bucket := range buckets {
+		if saved[bucket.From.Unix()] {
+			continue
+		}
+		bucket.StartedAt = time.Now()
+		graph, err := collectContextGraph(ctx, cfg.providers, bucket, func(provider, done, total int) {
+			s.jobs.update(backfill.JobID, func(job *CollectionJob) {
+				progress := &job.Progress.Providers[provider]
+				job.Progress.ChunksDone += chunksBefore[provider] + done - progress.ChunksDone
+				progress.ChunksDone, progress.Status = chunksBefore[provider]+done, JobRunning
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to collect %s to %s: %w", bucket.From.Format(time.RFC3339), bucket.To.Format(time.RFC3339), err)
+		}
+		for i, provider := range cfg.providers {
+			chunksBefore[i] += len(providerChunks(provider, bucket))
+		}
+
+		// Istio configuration describes the present, so it is not added to reconstructed
+		// snapshots; the Kubernetes provider skips historical buckets for the same reason
+		doc := graph.toSnapshot()
+		doc.Timestamp = *bucket.To
+		doc.WindowStart, doc.WindowEnd, doc.Step = bucket.From, bucket.To, defaultQueryStep
+		doc.BackfillID = backfill.ID
+		doc.Query = &SnapshotQuery{Profile: cfg.profile, Workloads: backfill.Workloads, BucketMinutes: backfill.BucketMinutes}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := s.saveSnapshot(cfg, doc); err != nil {
+			return fmt.Errorf("failed to save snapshot for %s: %w", bucket.From.Format(time.RFC3339), err)
+		}
+
+		backfill.BucketsDone++
+		if err := s.updateBackfill(&backfill); err != nil {
+			return err
+		}
+		s.jobs.update(backfill.JobID, func(job *CollectionJob) {
+			job.Progress.BucketsDone = backfill.BucketsDone
+		})
+	}
+	log.Printf("Backfill %s saved %d snapshots from %s to %s", backfill.ID.Hex(), backfill.BucketsDone,
+		backfill.From.Format(time.RFC3339), backfill.To.Format(time.RFC3339))
+	return nil
+}
+
+// updateBackfill saves a backfill's progress
+func (s *Server) updateBackfill(backfill *BackfillDocument) error {
+	backfill.UpdatedAt = time.Now()
+	return s.mongoRepo.UpdateBackfill(*backfill)
+}
+
+// requestBackfill returns the backfill named by the request's id path parameter. It responds
+// with 404 and returns false if there is none.
+func (s *Server) requestBackfill(c *gin.Context) (*BackfillDocument, bool) {
+	var backfill *BackfillDocument
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err == nil {
+		backfill, err = s.mongoRepo.GetBackfill(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return nil, false
+		}
+	}
+	if backfill == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Unknown backfill %s", c.Param("id")),
+		})
+		return nil, false
+	}
+	return backfill, true
+}
+
+// getBackfillHandler handles the topology/backfills/:id endpoint
+func (s *Server) getBackfillHandler(c *gin.Context) {
+	backfill, ok := s.requestBackfill(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"backfill": backfill,
+	})
+}
+
+// listBackfillsHandler handles the topology/backfills endpoint
+func (s *Server) listBackfillsHandler(c *gin.Context) {
+	limit := defaultBackfillListLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid limit: %s", limitStr),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	backfills, err := s.mongoRepo.ListBackfills(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"backfills": backfills,
+	})
+}
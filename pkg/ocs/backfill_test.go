@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBackfillBuckets(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backfill := &BackfillDocument{
+		From:          from,
+		To:            from.Add(150 * time.Minute),
+		BucketMinutes: 60,
+		Workloads:     []string{"checkout"},
+	}
+
+	buckets := backfillBuckets(backfill)
+	if len(buckets) != 3 {
+		t.Fatalf("backfillBuckets() returned %d buckets, want 3", len(buckets))
+	}
+	for i, bucket := range buckets {
+		if !reflect.DeepEqual(bucket.Workloads, []string{"checkout"}) || !bucket.Historical {
+			t.Errorf("bucket %d = %+v, want a historical bucket of the recorded workloads", i, bucket)
+		}
+		if want := from.Add(time.Duration(i) * time.Hour); !bucket.From.Equal(want) {
+			t.Errorf("bucket %d starts at %s, want %s", i, bucket.From, want)
+		}
+	}
+	if !buckets[2].To.Equal(backfill.To) {
+		t.Errorf("last bucket ends at %s, want %s", buckets[2].To, backfill.To)
+	}
+}
+
+func TestStartBackfillJobRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, err := buildActiveConfig(testProfilesPaths, []byte(testProfilesConfig), []byte(testProfilesPrometheusConfig), "hash")
+	if err != nil {
+		t.Fatalf("buildActiveConfig() error = %v", err)
+	}
+	server := &Server{jobs: newJobManager()}
+	server.jobs.pending = maxPendingJobs
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backfill := &BackfillDocument{ID: primitive.NewObjectID(), From: from, To: from.Add(2 * time.Hour), BucketMinutes: 60, Workloads: []string{"app"}, Status: JobQueued}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/topology/backfill", nil)
+
+	// backfillHandler marks the saved backfill failed when this returns false
+	if server.startBackfillJob(c, cfg, backfill) {
+		t.Error("startBackfillJob() = true with too many pending jobs")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("response = %d with Retry-After %q, want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if backfill.JobID != "" || len(server.jobs.jobs) != 0 {
+		t.Errorf("rejected backfill has job %q and %d jobs are registered", backfill.JobID, len(server.jobs.jobs))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPromptCacheEntries bounds the number of cached responses per snapshot. The oldest is
+// dropped to make room for a new one.
+const maxPromptCacheEntries = 128
+
+// cachedPrompt holds a built OCS prompt response, in its requested spec version, along with
+// its validators
+type cachedPrompt struct {
+	response     interface{}
+	temporal     *TemporalContext // for the freshness headers, which 0.1 responses also carry
+	etag         string
+	lastModified time.Time
+}
+
+// PromptCache caches the latest topology snapshot and the OCS prompts built from it.
+// Everything is dropped whenever a new snapshot is saved.
+type PromptCache struct {
+	mu        sync.RWMutex
+	snapshots map[string]*AdjacencyListDocument // latest snapshot by order, nil if the store was empty
+	entries   map[string]*cachedPrompt
+	order     []string // keys of entries, oldest first
+}
+
+// NewPromptCache creates an empty prompt cache
+func NewPromptCache() *PromptCache {
+	return &PromptCache{
+		snapshots: make(map[string]*AdjacencyListDocument),
+		entries:   make(map[string]*cachedPrompt),
+	}
+}
+
+// Snapshot returns the cached latest snapshot by order, and whether one has been loaded.
+// A loaded snapshot may be nil if the store was empty.
+func (pc *PromptCache) Snapshot(order string) (*AdjacencyListDocument, bool) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	snapshot, loaded := pc.snapshots[order]
+	return snapshot, loaded
+}
+
+// SetSnapshot caches the latest snapshot by order
+func (pc *PromptCache) SetSnapshot(order string, snapshot *AdjacencyListDocument) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.snapshots[order] = snapshot
+}
+
+// Get returns the cached prompt for key, if any
+func (pc *PromptCache) Get(key string) (*cachedPrompt, bool) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	entry, ok := pc.entries[key]
+	return entry, ok
+}
+
+// Put caches a prompt under key
+func (pc *PromptCache) Put(key string, entry *cachedPrompt) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if _, ok := pc.entries[key]; !ok {
+		if len(pc.order) >= maxPromptCacheEntries {
+			delete(pc.entries, pc.order[0])
+			pc.order = pc.order[1:]
+		}
+		pc.order = append(pc.order, key)
+	}
+	pc.entries[key] = entry
+}
+
+// Invalidate drops the cached snapshot and every cached prompt
+func (pc *PromptCache) Invalidate() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.snapshots = make(map[string]*AdjacencyListDocument)
+	pc.entries = make(map[string]*cachedPrompt)
+	pc.order = nil
+}
+
+// promptCacheKey builds a cache key from the snapshot ID, the config version and the request
+// parameters, so a prompt built while a reload is in progress is never served for the new config
+func promptCacheKey(snapshot *AdjacencyListDocument, configVersion int, params url.Values) string {
+	snapshotID := "none"
+	if snapshot != nil {
+		snapshotID = snapshot.ID.Hex()
+	}
+	return fmt.Sprintf("%s@%d?%s", snapshotID, configVersion, params.Encode())
+}
+
+// isNotModified reports whether the request's conditional headers match the cached prompt.
+// If-None-Match takes precedence over If-Modified-Since, as in RFC 9110.
+func isNotModified(req *http.Request, entry *cachedPrompt) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == entry.etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := req.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !entry.lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		return !entry.lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPromptCachePut(t *testing.T) {
+	cache := NewPromptCache()
+	if _, ok := cache.Get("missing"); ok {
+		t.Error("Get() of an empty cache hit")
+	}
+
+	for i := 0; i < maxPromptCacheEntries; i++ {
+		cache.Put(fmt.Sprint(i), &cachedPrompt{etag: fmt.Sprint(i)})
+	}
+	// Replacing an entry does not make room
+	cache.Put("0", &cachedPrompt{etag: "replaced"})
+	if entry, ok := cache.Get("0"); !ok || entry.etag != "replaced" {
+		t.Errorf("Get() after replacing = %+v, %v, want the replacement", entry, ok)
+	}
+
+	// A new entry beyond the limit drops only the oldest
+	cache.Put("new", &cachedPrompt{etag: "new"})
+	if _, ok := cache.Get("0"); ok {
+		t.Error("the oldest entry is still cached")
+	}
+	for _, key := range []string{"1", fmt.Sprint(maxPromptCacheEntries - 1), "new"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("entry %s was dropped", key)
+		}
+	}
+	if len(cache.entries) != maxPromptCacheEntries || len(cache.order) != maxPromptCacheEntries {
+		t.Errorf("cache holds %d entries in order of %d, want %d", len(cache.entries), len(cache.order), maxPromptCacheEntries)
+	}
+
+	cache.SetSnapshot(LatestByDataTime, testPromptSnapshot())
+	cache.Invalidate()
+	if _, ok := cache.Get("new"); ok {
+		t.Error("Invalidate() kept a prompt")
+	}
+	if _, loaded := cache.Snapshot(LatestByDataTime); loaded {
+		t.Error("Invalidate() kept the snapshot")
+	}
+}
+
+func TestGetOCSPromptCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, err := buildActiveConfig(testProfilesPaths, []byte(testProfilesConfig), []byte(testProfilesPrometheusConfig), "hash")
+	if err != nil {
+		t.Fatalf("buildActiveConfig() error = %v", err)
+	}
+	cfg.version = 1
+	cfg.loadedAt = time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	// The snapshot is served from the cache, so no MongoDB is needed
+	cache := NewPromptCache()
+	cache.SetSnapshot(LatestByDataTime, testPromptSnapshot())
+	server := &Server{stores: map[string]*profileStore{DefaultProfile: {promptCache: cache}}}
+	server.config.Store(cfg)
+	router := gin.New()
+	router.GET("/get_ocs_prompt", server.getOCSPromptHandler)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/get_ocs_prompt", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A miss builds the prompt and caches it
+	first := get("", "")
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || lastModified != "Mon, 01 Jan 2024 00:05:03 GMT" {
+		t.Fatalf("first response = %d, ETag %q, Last-Modified %q", first.Code, etag, lastModified)
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("cache holds %d prompts after a miss, want 1", len(cache.entries))
+	}
+
+	// A hit serves the cached prompt
+	for _, entry := range cache.entries {
+		entry.etag = `"cached"`
+	}
+	if got := get("", "").Header().Get("ETag"); got != `"cached"` {
+		t.Errorf("second response ETag = %q, want the cached prompt's", got)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "matching etag", header: "If-None-Match", value: `"other", W/"cached"`, wantStatus: http.StatusNotModified},
+		{name: "different etag", header: "If-None-Match", value: etag, wantStatus: http.StatusOK},
+		{name: "not modified since", header: "If-Modified-Since", value: lastModified, wantStatus: http.StatusNotModified},
+		{name: "modified since", header: "If-Modified-Since", value: "Mon, 01 Jan 2024 00:05:02 GMT", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.header, tt.value)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %s", w.Body.String())
+			}
+		})
+	}
+
+	// saveSnapshot invalidates the cache, so the next request builds from the new snapshot
+	cache.Invalidate()
+	next := testPromptSnapshot()
+	next.AdjacencyList = map[string][]string{"app": {"database"}}
+	cache.SetSnapshot(LatestByDataTime, next)
+	if got := get("If-None-Match", etag); got.Code != http.StatusOK || got.Header().Get("ETag") == etag {
+		t.Errorf("response after a new snapshot = %d with ETag %s, want a new prompt", got.Code, got.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collectionBusyRetryAfter is suggested to clients turned away because too many collections are running
+const collectionBusyRetryAfter = 5 * time.Second
+
+// maxIdleRateBuckets is how many client buckets are kept before full, idle ones are dropped
+const maxIdleRateBuckets = 1024
+
+// errCollectionBusy is returned when max_concurrent collections are already running
+var errCollectionBusy = errors.New("too many collections are running")
+
+// errCollectionAborted is returned to requests waiting on a collection that panicked
+var errCollectionAborted = errors.New("collection aborted")
+
+// rateBucket is a client's token bucket
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// collectionLimiter enforces collection_limits. The limits are read from the active config on
+// every call, so reloads change them without losing the state of running collections.
+type collectionLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket // by client
+	running int
+	flights map[string]*collectionFlight // in-flight collections by request key
+	// released is closed and replaced whenever a collection finishes, waking waiting jobs
+	released chan struct{}
+}
+
+// collectionFlight is a running collection that identical requests wait on instead of repeating it
+type collectionFlight struct {
+	done   chan struct{}
+	result *collectionResult
+	err    error
+}
+
+// newCollectionLimiter creates a limiter with no clients or collections
+func newCollectionLimiter() *collectionLimiter {
+	return &collectionLimiter{
+		buckets:  make(map[string]*rateBucket),
+		flights:  make(map[string]*collectionFlight),
+		released: make(chan struct{}),
+	}
+}
+
+// allow takes a token from client's bucket. If the bucket is empty it returns false and how long
+// until the next token.
+func (l *collectionLimiter) allow(client string, limits CollectionLimitsConfig, now time.Time) (bool, time.Duration) {
+	if limits.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+	burst := float64(max(limits.Burst, 1))
+	perSecond := limits.RequestsPerMinute / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	refill := func(bucket *rateBucket) {
+		bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+		bucket.updated = now
+	}
+	if len(l.buckets) >= maxIdleRateBuckets {
+		for name, bucket := range l.buckets {
+			if refill(bucket); bucket.tokens >= burst {
+				delete(l.buckets, name)
+			}
+		}
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &rateBucket{tokens: burst, updated: now}
+		l.buckets[client] = bucket
+	}
+	refill(bucket)
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// do runs collect unless an identical collection is already running, in which case it waits for
+// that one and returns its result with shared set. If max_concurrent collections are running, a
+// new collection waits for one to finish when wait is set, and fails with errCollectionBusy
+// otherwise. Waiting stops with ctx's error once ctx is done.
+func (l *collectionLimiter) do(ctx context.Context, key string, limits CollectionLimitsConfig, wait bool, collect func() (*collectionResult, error)) (result *collectionResult, shared bool, err error) {
+	l.mu.Lock()
+	for {
+		if flight, ok := l.flights[key]; ok {
+			l.mu.Unlock()
+			select {
+			case <-flight.done:
+				return flight.result, true, flight.err
+			case <-ctx.Done():
+				return nil, true, ctx.Err()
+			}
+		}
+		if limits.MaxConcurrent <= 0 || l.running < limits.MaxConcurrent {
+			break
+		}
+		if !wait {
+			l.mu.Unlock()
+			return nil, false, errCollectionBusy
+		}
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		l.mu.Lock()
+	}
+	flight := &collectionFlight{done: make(chan struct{}), err: errCollectionAborted}
+	l.flights[key] = flight
+	l.running++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.flights, key)
+		l.running--
+		close(l.released)
+		l.released = make(chan struct{})
+		l.mu.Unlock()
+		close(flight.done)
+	}()
+	flight.result, flight.err = collect()
+	return flight.result, false, flight.err
+}
+
+// allowCollection applies the client's rate limit to a request starting a collection, responding
+// with 429 and returning false if it is over the limit
+func (s *Server) allowCollection(c *gin.Context, limits CollectionLimitsConfig) bool {
+	ok, wait := s.collectionLimiter.allow(rateLimitClient(c), limits, time.Now())
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"status":  "error",
+			"message": "Collection rate limit exceeded",
+		})
+	}
+	return ok
+}
+
+// rateLimitClient identifies the client a request is rate limited as: its principal when it
+// authenticated, otherwise its address
+func rateLimitClient(c *gin.Context) string {
+	if value, ok := c.Get(principalContextKey); ok {
+		if principal := value.(*Principal); principal != anonymousPrincipal {
+			return principal.Method + ":" + principal.Name
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds for the Retry-After header
+func retryAfterSeconds(wait time.Duration) int {
+	return max(int(math.Ceil(wait.Seconds())), 1)
+}
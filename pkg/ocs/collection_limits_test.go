@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCollectionLimiterAllow(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	limits := CollectionLimitsConfig{RequestsPerMinute: 6, Burst: 2}
+
+	tests := []struct {
+		name     string
+		client   string
+		at       time.Duration
+		limits   CollectionLimitsConfig
+		want     bool
+		wantWait time.Duration
+	}{
+		{name: "first of burst", client: "a", limits: limits, want: true},
+		{name: "second of burst", client: "a", limits: limits, want: true},
+		{name: "burst used up", client: "a", limits: limits, wantWait: 10 * time.Second},
+		{name: "other client has its own bucket", client: "b", limits: limits, want: true},
+		{name: "half refilled", client: "a", at: 5 * time.Second, limits: limits, wantWait: 5 * time.Second},
+		{name: "refilled", client: "a", at: 10 * time.Second, limits: limits, want: true},
+		{name: "empty again", client: "a", at: 10 * time.Second, limits: limits, wantWait: 10 * time.Second},
+		{name: "disabled", client: "a", at: 10 * time.Second, want: true},
+	}
+
+	// The cases share one limiter and run in order
+	limiter := newCollectionLimiter()
+	for _, tt := range tests {
+		ok, wait := limiter.allow(tt.client, tt.limits, start.Add(tt.at))
+		if ok != tt.want || wait != tt.wantWait {
+			t.Errorf("%s: allow() = %v, %v, want %v, %v", tt.name, ok, wait, tt.want, tt.wantWait)
+		}
+	}
+}
+
+func TestCollectionLimiterAllowDropsIdleBuckets(t *testing.T) {
+	limiter := newCollectionLimiter()
+	limits := CollectionLimitsConfig{RequestsPerMinute: 60, Burst: 1}
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < maxIdleRateBuckets; i++ {
+		limiter.allow(fmt.Sprintf("client-%d", i), limits, start)
+	}
+	limiter.allow("busy", limits, start.Add(time.Minute))
+	if len(limiter.buckets) != 1 {
+		t.Errorf("limiter keeps %d buckets, want only the busy client's", len(limiter.buckets))
+	}
+}
+
+func TestCollectionLimiterDo(t *testing.T) {
+	limiter := newCollectionLimiter()
+	limits := CollectionLimitsConfig{MaxConcurrent: 1}
+	want := &collectionResult{providers: []string{ConnectorIstio}}
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	type outcome struct {
+		result *collectionResult
+		shared bool
+		err    error
+	}
+	first := make(chan outcome)
+	go func() {
+		result, shared, err := limiter.do(context.Background(), "a", limits, false, func() (*collectionResult, error) {
+			close(started)
+			<-finish
+			return want, nil
+		})
+		first <- outcome{result, shared, err}
+	}()
+	<-started
+
+	// An identical request waits for the running collection and shares its result
+	identical := make(chan outcome)
+	go func() {
+		result, shared, err := limiter.do(context.Background(), "a", limits, false, func() (*collectionResult, error) {
+			t.Error("identical request ran its own collection")
+			return nil, nil
+		})
+		identical <- outcome{result, shared, err}
+	}()
+
+	// Another request is turned away, or waits when asked to until its context is done. The
+	// wait also gives the identical request time to join the running collection.
+	if _, _, err := limiter.do(context.Background(), "b", limits, false, nil); !errors.Is(err, errCollectionBusy) {
+		t.Errorf("do() while busy error = %v, want errCollectionBusy", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := limiter.do(ctx, "b", limits, true, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("do() waiting while busy error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// A waiting request runs once the running collection finishes
+	waited := make(chan outcome)
+	go func() {
+		result, shared, err := limiter.do(context.Background(), "c", limits, true, func() (*collectionResult, error) {
+			return &collectionResult{}, nil
+		})
+		waited <- outcome{result, shared, err}
+	}()
+
+	close(finish)
+	if got := <-first; got.result != want || got.shared || got.err != nil {
+		t.Errorf("first do() = %+v, want its own result", got)
+	}
+	if got := <-identical; got.result != want || !got.shared || got.err != nil {
+		t.Errorf("identical do() = %+v, want the shared result", got)
+	}
+	if got := <-waited; got.result == nil || got.shared || got.err != nil {
+		t.Errorf("waiting do() = %+v, want its own result", got)
+	}
+	if limiter.running != 0 || len(limiter.flights) != 0 {
+		t.Errorf("limiter still has %d running and %d flights", limiter.running, len(limiter.flights))
+	}
+}
+
+func TestRateLimitClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		principal      *Principal
+		want           string
+	}{
+		{name: "forwarded address from untrusted peer", want: "ip:192.0.2.10"},
+		{name: "forwarded address from trusted proxy", trustedProxies: []string{"192.0.2.0/24"}, want: "ip:198.51.100.7"},
+		{name: "authenticated principal", principal: &Principal{Name: "collector", Method: AuthMethodAPIKey}, want: "api_key:collector"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			router.GET("/", func(c *gin.Context) {
+				if tt.principal != nil {
+					c.Set(principalContextKey, tt.principal)
+				}
+				got = rateLimitClient(c)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.10:41000"
+			req.Header.Set("X-Forwarded-For", "198.51.100.7")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("rateLimitClient() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,55 +1,321 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-// loadOCSConfig loads the OCS configuration from YAML file
-func loadOCSConfig() (*OCSConfig, error) {
-	configPath := filepath.Join(filepath.Dir(os.Args[0]), "pkg/ocs/ocs_config.yaml")
-	// Try relative path if absolute doesn't work
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		configPath = "pkg/ocs/ocs_config.yaml"
+// envPrefix prefixes the environment variables that override configuration fields
+const envPrefix = "OCS"
+
+// Defaults for settings that are usually left to the environment
+const (
+	defaultPort            = "8000"
+	defaultMongoDBURI      = "mongodb://localhost:27017/"
+	defaultMongoDBDatabase = "ocs"
+)
+
+// legacyEnvAliases maps environment variables read before overrides were generalized to the
+// override they now stand for. The override wins when both are set.
+var legacyEnvAliases = map[string]string{
+	"PORT":                   "OCS_SERVER_PORT",
+	"MONGODB_URI":            "OCS_MONGODB_URI",
+	"MONGODB_DB_NAME":        "OCS_MONGODB_DATABASE",
+	"OCS_VALIDATE_RESPONSES": "OCS_SERVER_VALIDATE_RESPONSES",
+	"OCS_IMPORT_TOPOLOGY":    "OCS_SERVER_IMPORT_TOPOLOGY",
+}
+
+// ConfigPaths locates the configuration files
+type ConfigPaths struct {
+	OCSConfig        string
+	PrometheusConfig string
+}
+
+// parseConfigFlags parses the command-line flags that locate the configuration files.
+// OCS_CONFIG and OCS_PROMETHEUS_CONFIG are used when a flag is not given, and well-known
+// locations are searched when neither is set.
+func parseConfigFlags(args []string) (ConfigPaths, error) {
+	flags := flag.NewFlagSet("ocs", flag.ContinueOnError)
+	ocsConfig := flags.String("config", os.Getenv("OCS_CONFIG"), "path to ocs_config.yaml")
+	prometheusConfig := flags.String("prometheus-config", os.Getenv("OCS_PROMETHEUS_CONFIG"), "path to the Prometheus config")
+	if err := flags.Parse(args); err != nil {
+		return ConfigPaths{}, err
 	}
+	return resolveConfigPaths(*ocsConfig, *prometheusConfig)
+}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read OCS config: %w", err)
+// resolveConfigPaths returns the given paths, or finds each file that was not given in the
+// working directory and next to the executable
+func resolveConfigPaths(ocsConfig, prometheusConfig string) (ConfigPaths, error) {
+	var err error
+	if ocsConfig == "" {
+		ocsConfig, err = findConfigFile("OCS config", "--config or OCS_CONFIG", "pkg/ocs/ocs_config.yaml", "ocs_config.yaml")
+		if err != nil {
+			return ConfigPaths{}, err
+		}
 	}
+	if prometheusConfig == "" {
+		prometheusConfig, err = findConfigFile("Prometheus config", "--prometheus-config or OCS_PROMETHEUS_CONFIG", "config/prometheus_config.yaml", "prometheus_config.yaml")
+		if err != nil {
+			return ConfigPaths{}, err
+		}
+	}
+	return ConfigPaths{OCSConfig: ocsConfig, PrometheusConfig: prometheusConfig}, nil
+}
 
-	var config OCSConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse OCS config: %w", err)
+// findConfigFile returns the first of the candidate paths that exists, relative to the working
+// directory and then to the executable's directory. setting names how to pass the path instead.
+func findConfigFile(name, setting string, candidates ...string) (string, error) {
+	var tried []string
+	dirs := []string{"."}
+	if executable, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(executable))
+	}
+	for _, dir := range dirs {
+		for _, candidate := range candidates {
+			path := filepath.Join(dir, candidate)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+			tried = append(tried, path)
+		}
+	}
+	return "", fmt.Errorf("%s not found, tried %s; set its path with %s", name, strings.Join(tried, ", "), setting)
+}
+
+// readConfigFiles reads both configuration files and hashes their contents
+func readConfigFiles(paths ConfigPaths) (ocsData, promData []byte, hash string, err error) {
+	ocsData, err = os.ReadFile(paths.OCSConfig)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read OCS config: %w", err)
+	}
+	promData, err = os.ReadFile(paths.PrometheusConfig)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read Prometheus config: %w", err)
 	}
 
-	return &config, nil
+	hasher := sha256.New()
+	hasher.Write(ocsData)
+	hasher.Write([]byte{0})
+	hasher.Write(promData)
+	return ocsData, promData, hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// loadPrometheusConfig loads Prometheus configuration
-func loadPrometheusConfig() (*PrometheusConfig, error) {
-	configPath := "config/prometheus_config.yaml"
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("prometheus config not found: %s", configPath)
+// parseConfig builds the unified configuration from the contents of both files: ${ENV}
+// references are expanded, defaults filled in, and environment overrides applied last. The files
+// are decoded strictly and validated, and every problem found is reported with its file and line.
+func parseConfig(paths ConfigPaths, ocsData, promData []byte) (*Config, error) {
+	config := &Config{
+		Server:  ServerConfig{Port: defaultPort},
+		MongoDB: MongoDBConfig{URI: defaultMongoDBURI, Database: defaultMongoDBDatabase},
 	}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read Prometheus config: %w", err)
+	ocsDocument, issues := decodeConfigFile(paths.OCSConfig, ocsData, config)
+	promDocument, promIssues := decodeConfigFile(paths.PrometheusConfig, promData, &config.Prometheus)
+	issues = append(issues, promIssues...)
+	if ocsDocument == nil || promDocument == nil {
+		// A file that is not valid YAML cannot be checked any further
+		return nil, &ConfigValidationError{Issues: issues}
+	}
+	config.recordProfileKeys(ocsDocument)
+
+	if err := applyEnvOverrides(reflect.ValueOf(config).Elem(), envPrefix, lookupEnv); err != nil {
+		issues = append(issues, configIssue{File: "environment", Message: err.Error()})
+	}
+
+	// Unknown and mistyped fields are reported together with the values that fail validation
+	if issues = append(issues, validateConfig(config, paths, ocsDocument, promDocument)...); len(issues) > 0 {
+		return nil, &ConfigValidationError{Issues: issues}
+	}
+	return config, nil
+}
+
+// envReference matches ${NAME} and ${NAME:-default}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv expands ${NAME} and ${NAME:-default} references to environment variables in
+// the scalar values of a parsed document, so references in comments and keys are left alone.
+// A reference to an unset variable without a default is reported as an issue rather than
+// expanded to an empty value.
+func interpolateEnv(file string, document *yaml.Node) []configIssue {
+	var issues []configIssue
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				walk(node.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, fmt.Sprintf("%s[%d]", path, i))
+			}
+		case yaml.ScalarNode:
+			expanded, missing := expandEnv(node.Value)
+			for _, name := range missing {
+				issues = append(issues, configIssue{
+					File:    file,
+					Line:    node.Line,
+					Path:    path,
+					Message: fmt.Sprintf("environment variable %s is not set and has no default", name),
+				})
+			}
+			if expanded != node.Value {
+				node.Value = expanded
+				// Plain scalars are resolved again, so ${PORT} can fill an integer field while
+				// quoted or tagged values stay strings
+				if node.Style == 0 {
+					node.Tag = ""
+				}
+			}
+		}
 	}
+	walk(document, "")
+	return issues
+}
+
+// expandEnv expands the ${ENV} references in a value and returns the names of unset variables
+// that have no default
+func expandEnv(value string) (string, []string) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(match string) string {
+		groups := envReference.FindStringSubmatch(match)
+		if value, ok := os.LookupEnv(groups[1]); ok {
+			return value
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return match
+	})
+	return expanded, missing
+}
 
-	var config PrometheusConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse Prometheus config: %w", err)
+// lookupEnv looks up an override, falling back to the legacy variable it replaced
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
 	}
+	for legacy, override := range legacyEnvAliases {
+		if override == name {
+			return os.LookupEnv(legacy)
+		}
+	}
+	return "", false
+}
 
-	if len(config.PrometheusInstances) == 0 {
-		return nil, fmt.Errorf("no Prometheus instances configured")
+// applyEnvOverrides sets configuration fields from environment variables named after their YAML
+// path, e.g. OCS_TIME_WINDOW_MINUTES, OCS_IDENTITY_CLUSTER or OCS_PROMETHEUS_INSTANCES_0_BASE_URL.
+// Lists of strings are comma-separated. Maps are not overridable; use ${ENV} references instead.
+func applyEnvOverrides(value reflect.Value, name string, lookup func(string) (string, bool)) error {
+	switch value.Kind() {
+	case reflect.Struct:
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tag := strings.Split(field.Tag.Get("yaml"), ",")
+			fieldName := name
+			switch {
+			case len(tag) > 1 && tag[1] == "inline", tag[0] == "-":
+				// Inlined fields, and the Prometheus config loaded from its own file, add no
+				// key of their own
+			case tag[0] != "":
+				fieldName = name + "_" + strings.ToUpper(tag[0])
+			default:
+				continue
+			}
+			if err := applyEnvOverrides(value.Field(i), fieldName, lookup); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Struct {
+			for i := 0; i < value.Len(); i++ {
+				if err := applyEnvOverrides(value.Index(i), fmt.Sprintf("%s_%d", name, i), lookup); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		return nil
 	}
 
-	return &config, nil
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	if err := setFromString(value, raw); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
 }
 
+// setFromString parses raw into a scalar, pointer-to-scalar or string list field
+func setFromString(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		target := reflect.New(value.Type().Elem())
+		if err := setFromString(target.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(target)
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
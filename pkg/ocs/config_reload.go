@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configWatchInterval is how often the configuration files are checked for changes
+const configWatchInterval = 5 * time.Second
+
+// ActiveConfig holds the configuration and everything the server builds from it. A reload
+// replaces it as a whole, so each request works with one consistent configuration.
+type ActiveConfig struct {
+	// config is fileConfig with the runtime config merged over it
+	config     *Config
+	fileConfig *Config
+	// ocsConfig points into config, for the many places that only need ocs_config.yaml
+	ocsConfig *OCSConfig
+	// runtime is the runtime config version in effect, nil if there is none. It changes the
+	// top-level settings, which profiles inherit. skippedRuntimeVersion is the stored version that failed to apply
+	// at startup, if any; new versions are numbered after it.
+	runtime               *RuntimeConfigDocument
+	skippedRuntimeVersion int
+	// profile names this configuration; profiles holds the named profiles of the default one
+	profile  string
+	profiles map[string]*ActiveConfig
+	// authenticator checks API credentials; it is only set on the default profile
+	authenticator *authenticator
+	// version counts successful loads and runtime changes, starting at 1; hash identifies the file contents
+	version  int
+	hash     string
+	loadedAt time.Time
+
+	providers            []ContextProvider
+	istioConfigConnector *IstioConfigConnector // nil unless istio_config.enabled is set
+	declaredTopology     map[string][]string
+}
+
+// configReloadStatus records the outcome of the last reload attempt
+type configReloadStatus struct {
+	attemptedAt time.Time
+	trigger     string
+	err         error
+	// attemptedHash is the file contents last tried, so a broken file is not retried on every poll.
+	// attemptedRuntimeVersion does the same for runtime config versions.
+	attemptedHash           string
+	attemptedRuntimeVersion int
+}
+
+// loadActiveConfig reads both configuration files and builds the providers and connectors they describe
+func loadActiveConfig(paths ConfigPaths) (*ActiveConfig, error) {
+	ocsData, promData, hash, err := readConfigFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	return buildActiveConfig(paths, ocsData, promData, hash)
+}
+
+// buildActiveConfig parses the configuration files and builds the providers and connectors they
+// describe. Any failure means the configuration is invalid.
+func buildActiveConfig(paths ConfigPaths, ocsData, promData []byte, hash string) (*ActiveConfig, error) {
+	config, err := parseConfig(paths, ocsData, promData)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := newActiveConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	cfg.profile = DefaultProfile
+	cfg.hash, cfg.loadedAt = hash, time.Now()
+	if cfg.authenticator, err = newAuthenticator(config); err != nil {
+		return nil, fmt.Errorf("failed to initialize auth: %w", err)
+	}
+
+	// Each profile gets its own providers and connectors, built from its merged settings
+	cfg.profiles = make(map[string]*ActiveConfig, len(config.Profiles))
+	for _, name := range config.profileNames() {
+		profile, err := newActiveConfig(config.profileConfig(name))
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		profile.profile = name
+		profile.hash, profile.loadedAt = cfg.hash, cfg.loadedAt
+		cfg.profiles[name] = profile
+	}
+	return cfg, nil
+}
+
+// newActiveConfig builds the providers and connectors a configuration describes
+func newActiveConfig(config *Config) (*ActiveConfig, error) {
+	ocsConfig, promConfig := &config.OCSConfig, &config.Prometheus
+	var err error
+
+	// Initialize the context providers that collect topology
+	providers, err := newProviders(ocsConfig, promConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize providers: %w", err)
+	}
+
+	declaredTopology, err := loadDeclaredTopology(ocsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load declared topology: %w", err)
+	}
+
+	// Initialize Istio config connector for edge routing and security settings
+	var istioConfigConnector *IstioConfigConnector
+	if ocsConfig.IstioConfig.Enabled {
+		istioConfigConnector, err = NewIstioConfigConnector(ocsConfig.IstioConfig, ocsConfig.Kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Istio config connector: %w", err)
+		}
+	}
+
+	return &ActiveConfig{
+		config:               config,
+		fileConfig:           config,
+		ocsConfig:            ocsConfig,
+		providers:            providers,
+		istioConfigConnector: istioConfigConnector,
+		declaredTopology:     declaredTopology,
+	}, nil
+}
+
+// withRuntimeConfig returns a copy of the configuration with a runtime config version merged over
+// the file configuration. Profiles are derived again, so those that inherit the top-level
+// workloads, metrics or policies see the changes. The providers and connectors are shared, as
+// runtime changes only cover workloads, metrics and policies.
+func (cfg *ActiveConfig) withRuntimeConfig(runtime *RuntimeConfigDocument) (*ActiveConfig, error) {
+	merged := *cfg.fileConfig
+	validator := &configValidator{file: "runtime config"}
+	if runtime != nil {
+		merged.OCSConfig = runtime.Config.apply(cfg.fileConfig.OCSConfig)
+		validator.file = fmt.Sprintf("runtime config version %d", runtime.Version)
+		validator.validateOCSConfig(&merged.OCSConfig)
+	}
+
+	profiles := make(map[string]*ActiveConfig, len(cfg.profiles))
+	for _, name := range merged.profileNames() {
+		profileConfig := merged.profileConfig(name)
+		scoped := &configValidator{file: validator.file, prefix: "profiles." + name + "."}
+		scoped.validateOCSConfig(&profileConfig.OCSConfig)
+		validator.issues = append(validator.issues, scoped.issues...)
+
+		profile := *cfg.profiles[name]
+		profile.config = profileConfig
+		profile.ocsConfig = &profileConfig.OCSConfig
+		profiles[name] = &profile
+	}
+	if len(validator.issues) > 0 {
+		return nil, &ConfigValidationError{Issues: validator.issues}
+	}
+
+	next := *cfg
+	next.config = &merged
+	next.ocsConfig = &merged.OCSConfig
+	next.runtime = runtime
+	next.profiles = profiles
+	return &next, nil
+}
+
+// runtimeVersion returns the runtime config version in effect, 0 if there is none
+func (cfg *ActiveConfig) runtimeVersion() int {
+	if cfg.runtime == nil {
+		return 0
+	}
+	return cfg.runtime.Version
+}
+
+// nextRuntimeVersion returns the number of the next runtime config version
+func (cfg *ActiveConfig) nextRuntimeVersion() int {
+	return max(cfg.runtimeVersion(), cfg.skippedRuntimeVersion) + 1
+}
+
+// activeConfig returns the configuration currently in effect
+func (s *Server) activeConfig() *ActiveConfig {
+	return s.config.Load()
+}
+
+// reloadConfig loads the configuration files and the latest runtime config, and swaps them in if
+// either changed and the result is valid. On failure the current configuration stays in effect.
+func (s *Server) reloadConfig(trigger string) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.activeConfig()
+	s.reloadStatus = configReloadStatus{attemptedAt: time.Now(), trigger: trigger}
+
+	runtime := current.runtime
+	if latest, err := s.latestRuntimeConfig(); err != nil {
+		log.Printf("Config reload (%s) keeps runtime config version %d: %v", trigger, current.runtimeVersion(), err)
+	} else if latest != nil {
+		runtime = latest
+		s.reloadStatus.attemptedRuntimeVersion = latest.Version
+	}
+
+	ocsData, promData, hash, err := readConfigFiles(s.configPaths)
+	next := current
+	switch {
+	case err != nil:
+	case hash != current.hash:
+		s.reloadStatus.attemptedHash = hash
+		next, err = buildActiveConfig(s.configPaths, ocsData, promData, hash)
+	case runtime == current.runtime || runtime.Version == current.runtimeVersion():
+		s.reloadStatus.attemptedHash = hash
+		return nil
+	}
+	if err == nil {
+		next, err = next.withRuntimeConfig(runtime)
+	}
+	if err != nil {
+		s.reloadStatus.err = err
+		log.Printf("Config reload (%s) failed, keeping version %d: %v", trigger, current.version, err)
+		return err
+	}
+
+	next.version = current.version + 1
+	s.config.Store(next)
+	// Cached prompts were built from the previous configuration
+	s.invalidatePromptCaches()
+	log.Printf("Config reload (%s) activated version %d (%s, runtime config version %d)", trigger, next.version, next.hash[:12], next.runtimeVersion())
+	return nil
+}
+
+// activateRuntimeConfig swaps in a new runtime config version over the current file
+// configuration. The caller must hold reloadMu.
+func (s *Server) activateRuntimeConfig(next *ActiveConfig) {
+	next.version = s.activeConfig().version + 1
+	s.config.Store(next)
+	s.invalidatePromptCaches()
+	log.Printf("Runtime config version %d activated as config version %d", next.runtimeVersion(), next.version)
+}
+
+// watchConfig reloads the configuration when either file changes, another server saves a runtime
+// config version, or the process receives SIGHUP. It runs until stop is closed.
+func (s *Server) watchConfig(stop <-chan struct{}) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hangup:
+			s.reloadConfig("SIGHUP")
+		case <-ticker.C:
+			if s.configFilesChanged() {
+				s.reloadConfig("file change")
+			} else if s.runtimeConfigChanged() {
+				s.reloadConfig("runtime config change")
+			}
+		}
+	}
+}
+
+// configFilesChanged reports whether the configuration files differ from both the active
+// configuration and the last reload attempt
+func (s *Server) configFilesChanged() bool {
+	_, _, hash, err := readConfigFiles(s.configPaths)
+	if err != nil {
+		// A file that is missing or mid-write is picked up on a later poll
+		return false
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return hash != s.activeConfig().hash && hash != s.reloadStatus.attemptedHash
+}
+
+// runtimeConfigChanged reports whether a newer runtime config version was saved, e.g. by another
+// server sharing the store
+func (s *Server) runtimeConfigChanged() bool {
+	latest, err := s.latestRuntimeConfig()
+	if err != nil || latest == nil {
+		return false
+	}
+	return s.runtimeVersionChanged(latest.Version)
+}
+
+// runtimeVersionChanged reports whether a runtime config version differs from both the active
+// configuration and the last reload attempt
+func (s *Server) runtimeVersionChanged(version int) bool {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return version != s.activeConfig().runtimeVersion() && version != s.reloadStatus.attemptedRuntimeVersion
+}
+
+// latestRuntimeConfig returns the latest stored runtime config version, nil if there is none or
+// the server has no MongoDB
+func (s *Server) latestRuntimeConfig() (*RuntimeConfigDocument, error) {
+	if s.mongoRepo == nil {
+		return nil, nil
+	}
+	return s.mongoRepo.GetLatestRuntimeConfig()
+}
+
+// configVersionHandler handles the config/version endpoint
+func (s *Server) configVersionHandler(c *gin.Context) {
+	cfg := s.activeConfig()
+	response := gin.H{
+		"version":         cfg.version,
+		"hash":            cfg.hash,
+		"loaded_at":       cfg.loadedAt.Format(time.RFC3339),
+		"runtime_version": cfg.runtimeVersion(),
+	}
+
+	s.reloadMu.Lock()
+	status := s.reloadStatus
+	s.reloadMu.Unlock()
+	if !status.attemptedAt.IsZero() {
+		lastReload := gin.H{
+			"attempted_at": status.attemptedAt.Format(time.RFC3339),
+			"trigger":      status.trigger,
+			"status":       "success",
+		}
+		if status.err != nil {
+			lastReload["status"] = "error"
+			lastReload["message"] = status.err.Error()
+		}
+		response["last_reload"] = lastReload
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// reloadConfigHandler handles the config/reload endpoint
+func (s *Server) reloadConfigHandler(c *gin.Context) {
+	if err := s.reloadConfig("api"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Config reload failed, keeping version %d: %v", s.activeConfig().version, err),
+		})
+		return
+	}
+	s.configVersionHandler(c)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestReloadServer writes the test profiles configuration to temp files and returns a server
+// running it as version 1, without MongoDB, along with the default profile's prompt cache
+func newTestReloadServer(t *testing.T) (*Server, *PromptCache) {
+	t.Helper()
+	dir := t.TempDir()
+	paths := ConfigPaths{OCSConfig: filepath.Join(dir, "ocs.yaml"), PrometheusConfig: filepath.Join(dir, "prom.yaml")}
+	writeTestConfigFile(t, paths.OCSConfig, testProfilesConfig)
+	writeTestConfigFile(t, paths.PrometheusConfig, testProfilesPrometheusConfig)
+
+	cfg, err := loadActiveConfig(paths)
+	if err != nil {
+		t.Fatalf("loadActiveConfig() error = %v", err)
+	}
+	cfg.version = 1
+	cache := NewPromptCache()
+	server := &Server{configPaths: paths, stores: map[string]*profileStore{DefaultProfile: {promptCache: cache}}}
+	server.config.Store(cfg)
+	return server, cache
+}
+
+// writeTestConfigFile replaces a configuration file's contents
+func writeTestConfigFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	server, cache := newTestReloadServer(t)
+	cache.Put("prompt", &cachedPrompt{etag: `"v1"`})
+	initial := server.activeConfig()
+
+	// Unchanged files keep the active configuration and its cached prompts
+	if server.configFilesChanged() {
+		t.Error("configFilesChanged() = true for unchanged files")
+	}
+	if err := server.reloadConfig("test"); err != nil {
+		t.Fatalf("reloadConfig() of unchanged files error = %v", err)
+	}
+	if server.activeConfig() != initial {
+		t.Error("reloadConfig() of unchanged files swapped the configuration")
+	}
+	if _, ok := cache.Get("prompt"); !ok {
+		t.Error("reloadConfig() of unchanged files dropped the cached prompts")
+	}
+
+	// A change is swapped in as the next version and drops the cached prompts
+	writeTestConfigFile(t, server.configPaths.OCSConfig, strings.Replace(testProfilesConfig, "workload: [app]", "workload: [app, cart]", 1))
+	if !server.configFilesChanged() {
+		t.Error("configFilesChanged() = false after a change")
+	}
+	if err := server.reloadConfig("test"); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	changed := server.activeConfig()
+	if changed.version != 2 || changed.hash == initial.hash {
+		t.Errorf("reloadConfig() activated version %d with hash %s, want version 2 with a new hash", changed.version, changed.hash)
+	}
+	if !reflect.DeepEqual(changed.ocsConfig.Workload, []string{"app", "cart"}) {
+		t.Errorf("reloaded workload = %v, want [app cart]", changed.ocsConfig.Workload)
+	}
+	if !reflect.DeepEqual(changed.profiles["search"].ocsConfig.Workload, []string{"app", "cart"}) {
+		t.Errorf("reloaded search profile workload = %v, want the new top-level workload", changed.profiles["search"].ocsConfig.Workload)
+	}
+	if _, ok := cache.Get("prompt"); ok {
+		t.Error("reloadConfig() kept prompts cached for the previous configuration")
+	}
+	if server.configFilesChanged() {
+		t.Error("configFilesChanged() = true once the change is active")
+	}
+
+	// An invalid file keeps the active configuration and is not retried until it changes again
+	writeTestConfigFile(t, server.configPaths.OCSConfig, strings.Replace(testProfilesConfig, "providers: [istio]", "providers: [unknown]", 1))
+	if err := server.reloadConfig("test"); err == nil {
+		t.Fatal("reloadConfig() of an invalid file succeeded")
+	}
+	if server.activeConfig() != changed {
+		t.Error("reloadConfig() of an invalid file swapped the configuration")
+	}
+	if server.reloadStatus.err == nil {
+		t.Error("reloadConfig() did not record the failure")
+	}
+	if server.configFilesChanged() {
+		t.Error("configFilesChanged() = true for the file that already failed")
+	}
+	writeTestConfigFile(t, server.configPaths.OCSConfig, testProfilesConfig)
+	if !server.configFilesChanged() {
+		t.Error("configFilesChanged() = false after the failed file changed again")
+	}
+}
+
+func TestRuntimeVersionChanged(t *testing.T) {
+	server, _ := newTestReloadServer(t)
+	cfg := *server.activeConfig()
+	cfg.runtime = &RuntimeConfigDocument{Version: 3}
+	server.config.Store(&cfg)
+
+	// Without MongoDB there are no stored versions to pick up
+	if server.runtimeConfigChanged() {
+		t.Error("runtimeConfigChanged() = true without MongoDB")
+	}
+
+	tests := []struct {
+		name      string
+		attempted int
+		version   int
+		want      bool
+	}{
+		{name: "active version", version: 3},
+		{name: "newer version", version: 4, want: true},
+		{name: "version that failed to apply", attempted: 4, version: 4},
+		{name: "version after a failed one", attempted: 4, version: 5, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.reloadStatus = configReloadStatus{attemptedRuntimeVersion: tt.attempted}
+			if got := server.runtimeVersionChanged(tt.version); got != tt.want {
+				t.Errorf("runtimeVersionChanged(%d) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("OCS_TEST_HOST", "prom.example.com")
+	t.Setenv("OCS_TEST_PORT", "9000")
+	t.Setenv("OCS_TEST_EMPTY", "")
+
+	data := `# Set ${OCS_TEST_UNDOCUMENTED} to change nothing
+port: ${OCS_TEST_PORT}
+quoted_port: "${OCS_TEST_PORT}"
+url: http://${OCS_TEST_HOST}:${OCS_TEST_PORT:-9090}/api
+fallback: ${OCS_TEST_UNSET:-http://localhost:9090}
+empty: "${OCS_TEST_EMPTY:-unused}"
+${OCS_TEST_HOST}: key
+items:
+  - ${OCS_TEST_MISSING}
+nested:
+  token: Bearer ${OCS_TEST_ALSO_MISSING}
+`
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &document); err != nil {
+		t.Fatal(err)
+	}
+	issues := interpolateEnv("test.yaml", &document)
+
+	wantIssues := []configIssue{
+		{File: "test.yaml", Line: 9, Path: "items[0]", Message: "environment variable OCS_TEST_MISSING is not set and has no default"},
+		{File: "test.yaml", Line: 11, Path: "nested.token", Message: "environment variable OCS_TEST_ALSO_MISSING is not set and has no default"},
+	}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("interpolateEnv() issues = %+v, want %+v", issues, wantIssues)
+	}
+
+	var got map[string]interface{}
+	if err := document.Decode(&got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"port":             9000,
+		"quoted_port":      "9000",
+		"url":              "http://prom.example.com:9000/api",
+		"fallback":         "http://localhost:9090",
+		"empty":            "",
+		"${OCS_TEST_HOST}": "key",
+		"items":            []interface{}{"${OCS_TEST_MISSING}"},
+		"nested":           map[string]interface{}{"token": "Bearer ${OCS_TEST_ALSO_MISSING}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("interpolated document = %v, want %v", got, want)
+	}
+	written, err := yaml.Marshal(&document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "# Set ${OCS_TEST_UNDOCUMENTED} to change nothing") {
+		t.Errorf("comment was changed:\n%s", written)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	type instance struct {
+		Name    string `yaml:"name"`
+		BaseURL string `yaml:"base_url"`
+	}
+	type inlined struct {
+		Cluster string `yaml:"cluster"`
+	}
+	type settings struct {
+		Window    int               `yaml:"time_window_minutes"`
+		Ratio     float64           `yaml:"ratio"`
+		Enabled   bool              `yaml:"enabled"`
+		Limit     *int              `yaml:"limit"`
+		Workloads []string          `yaml:"workload"`
+		Instances []instance        `yaml:"prometheus_instances"`
+		Headers   map[string]string `yaml:"headers"`
+		Inlined   inlined           `yaml:",inline"`
+		Untagged  string
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    settings
+		wantErr string
+	}{
+		{
+			name: "every kind of field",
+			env: map[string]string{
+				"OCS_TIME_WINDOW_MINUTES":             "15",
+				"OCS_RATIO":                           "0.5",
+				"OCS_ENABLED":                         "true",
+				"OCS_LIMIT":                           "3",
+				"OCS_WORKLOAD":                        "app, database,",
+				"OCS_PROMETHEUS_INSTANCES_0_BASE_URL": "http://prom:9090",
+				"OCS_CLUSTER":                         "prod",
+				"OCS_HEADERS":                         "ignored",
+				"OCS_UNTAGGED":                        "ignored",
+			},
+			want: settings{
+				Window:    15,
+				Ratio:     0.5,
+				Enabled:   true,
+				Limit:     intPointer(3),
+				Workloads: []string{"app", "database"},
+				Instances: []instance{{Name: "main", BaseURL: "http://prom:9090"}},
+				Inlined:   inlined{Cluster: "prod"},
+			},
+		},
+		{
+			name: "no overrides keep the file values",
+			env:  map[string]string{},
+			want: settings{Window: 5, Instances: []instance{{Name: "main", BaseURL: "http://localhost:9090"}}},
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"OCS_TIME_WINDOW_MINUTES": "soon"},
+			wantErr: `OCS_TIME_WINDOW_MINUTES: invalid integer "soon"`,
+		},
+		{
+			name:    "invalid boolean",
+			env:     map[string]string{"OCS_ENABLED": "sometimes"},
+			wantErr: `OCS_ENABLED: invalid boolean "sometimes"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settings{Window: 5, Instances: []instance{{Name: "main", BaseURL: "http://localhost:9090"}}}
+			lookup := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+			err := applyEnvOverrides(reflect.ValueOf(&got).Elem(), envPrefix, lookup)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("applyEnvOverrides() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEnvOverrides() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyEnvOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigReportsEveryIssue(t *testing.T) {
+	t.Setenv("OCS_TIME_WINDOW_MINUTES", "soon")
+	paths := ConfigPaths{OCSConfig: "ocs.yaml", PrometheusConfig: "prom.yaml"}
+	ocsData := `# Set ${OCS_TEST_UNDOCUMENTED} in comments freely
+workload: [app]
+metrics:
+  - name: cpu
+    type: gaugee
+    unit: percentage
+    description: CPU usage
+    aggregation_logic: average
+server:
+  import_topology: ${OCS_TEST_TOPOLOGY}
+  colour: blue
+  trusted_proxies: [proxy.internal]
+`
+	promData := `prometheus_instances:
+  - name: main
+    base_url: ${OCS_TEST_PROMETHEUS_URL}
+`
+
+	_, err := parseConfig(paths, []byte(ocsData), []byte(promData))
+	validationErr, ok := err.(*ConfigValidationError)
+	if !ok {
+		t.Fatalf("parseConfig() error = %v, want a ConfigValidationError", err)
+	}
+	want := []string{
+		"ocs.yaml:10: server.import_topology: environment variable OCS_TEST_TOPOLOGY is not set and has no default",
+		"ocs.yaml:11: unknown field colour",
+		"prom.yaml:3: prometheus_instances[0].base_url: environment variable OCS_TEST_PROMETHEUS_URL is not set and has no default",
+		`environment: OCS_TIME_WINDOW_MINUTES: invalid integer "soon"`,
+		`ocs.yaml:5: metrics[0].type: unknown value "gaugee"`,
+		`ocs.yaml:12: server.trusted_proxies[0]: must be an IP address or CIDR range, got "proxy.internal"`,
+	}
+	message := validationErr.Error()
+	for _, issue := range want {
+		if !strings.Contains(message, issue) {
+			t.Errorf("parseConfig() error is missing %q:\n%s", issue, message)
+		}
+	}
+}
+
+func intPointer(value int) *int {
+	return &value
+}
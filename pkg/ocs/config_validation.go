@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Allowed values for the enumerated metric fields in ocs_config.yaml
+var (
+	metricTypes       = []string{"gauge", "counter", "histogram", "summary"}
+	metricPolarities  = []string{"high_is_bad", "low_is_bad"}
+	aggregationLogics = []string{"average", "sum", "min", "max", "count", "rate", "p50", "p90", "p95", "p99"}
+	outputSortKeys    = []string{SortByResourceID, SortByWorkload, SortByDomain}
+	resourceTypeNames = []string{ResourceTypeWorkload, ResourceTypeDatabase, ResourceTypeExternalHost, ResourceTypeService, ResourceTypeNamespace, ResourceTypeCluster}
+)
+
+// configIssue is one problem found in a configuration file. Line is 0 when the problem cannot be
+// placed, e.g. a required key that is missing from an empty file.
+type configIssue struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (i configIssue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	if i.Path == "" {
+		return fmt.Sprintf("%s: %s", location, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, i.Path, i.Message)
+}
+
+// ConfigValidationError reports every problem found in the configuration files at once
+type ConfigValidationError struct {
+	Issues []configIssue
+}
+
+func (e *ConfigValidationError) Error() string {
+	lines := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		lines = append(lines, issue.String())
+	}
+	if len(lines) == 1 {
+		return "invalid config: " + lines[0]
+	}
+	return fmt.Sprintf("invalid config, %d errors:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// yamlLinePrefix matches the line number yaml.v3 puts in decoding errors
+var yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// yamlUnknownField matches yaml.v3's error for a key that no struct field accepts
+var yamlUnknownField = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// decodeConfigFile strictly decodes one configuration file into target, rejecting unknown keys,
+// after expanding its ${ENV} references. It returns the parsed document, used to find the line
+// of later validation issues, and every interpolation and decoding issue with its line. The
+// document is nil if the file is not valid YAML.
+func decodeConfigFile(file string, data []byte, target interface{}) (*yaml.Node, []configIssue) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, yamlIssues(file, err)
+	}
+	issues := interpolateEnv(file, &document)
+
+	// A document cannot be decoded strictly, so unknown keys are found by decoding the file as
+	// written. Its values are decoded from the expanded document.
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	strict := reflect.New(reflect.TypeOf(target).Elem()).Interface()
+	if err := decoder.Decode(strict); err != nil && !errors.Is(err, io.EOF) {
+		for _, issue := range yamlIssues(file, err) {
+			if strings.HasPrefix(issue.Message, "unknown field ") {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	if document.Kind == yaml.DocumentNode {
+		if err := document.Decode(target); err != nil {
+			issues = append(issues, yamlIssues(file, err)...)
+		}
+	}
+	return &document, issues
+}
+
+// yamlIssues splits a yaml.v3 error, which may hold several decoding errors, into issues
+func yamlIssues(file string, err error) []configIssue {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	var issues []configIssue
+	for _, message := range messages {
+		issue := configIssue{File: file, Message: strings.TrimPrefix(message, "yaml: ")}
+		if match := yamlLinePrefix.FindStringSubmatch(message); match != nil {
+			issue.Line, _ = strconv.Atoi(match[1])
+			issue.Message = message[len(match[0]):]
+		}
+		issue.Message = yamlUnknownField.ReplaceAllString(issue.Message, "unknown field $1")
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// configPathElement matches one key or [index] of a path such as metrics[0].type
+var configPathElement = regexp.MustCompile(`[^.\[\]]+|\[\d+\]`)
+
+// lineOf returns the line of the value at path in a parsed document, or of its closest parent
+// present in the file when the value was not set there. Top-level keys missing from the file
+// have no line.
+func lineOf(document *yaml.Node, path string) int {
+	if document == nil || len(document.Content) == 0 {
+		return 0
+	}
+	node, line := document.Content[0], 0
+	for _, element := range configPathElement.FindAllString(path, -1) {
+		var next *yaml.Node
+		switch {
+		case strings.HasPrefix(element, "[") && node.Kind == yaml.SequenceNode:
+			index, _ := strconv.Atoi(strings.Trim(element, "[]"))
+			if index < len(node.Content) {
+				next = node.Content[index]
+			}
+		case node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == element {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		}
+		if next == nil {
+			return line
+		}
+		node, line = next, next.Line
+	}
+	return line
+}
+
+// configValidator collects the issues found in one configuration file. prefix locates the
+// settings being checked within the file, e.g. profiles.team-a. for a profile.
+type configValidator struct {
+	file     string
+	document *yaml.Node
+	prefix   string
+	issues   []configIssue
+}
+
+func (v *configValidator) errorf(path, format string, args ...interface{}) {
+	path = v.prefix + path
+	v.issues = append(v.issues, configIssue{
+		File:    v.file,
+		Line:    lineOf(v.document, path),
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// oneOf reports an issue unless value is one of allowed. Empty values are left to the caller.
+func (v *configValidator) oneOf(path, value string, allowed []string) {
+	if value == "" {
+		return
+	}
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	v.errorf(path, "unknown value %q, expected one of %s", value, strings.Join(allowed, ", "))
+}
+
+// validateConfig checks the decoded configuration for missing, out-of-range, duplicate and
+// unknown values that strict decoding cannot catch. Values set by environment overrides are
+// checked too, and reported at the closest line of the file.
+func validateConfig(config *Config, paths ConfigPaths, ocsDocument, promDocument *yaml.Node) []configIssue {
+	ocs := &configValidator{file: paths.OCSConfig, document: ocsDocument}
+	ocs.validateOCSConfig(&config.OCSConfig)
+	ocs.validateServerConfig(config)
+	ocs.validateProfiles(config)
+	ocs.validateAuthConfig(config)
+	ocs.validateCollectionLimits(&config.CollectionLimits)
+
+	prom := &configValidator{file: paths.PrometheusConfig, document: promDocument}
+	prom.validatePrometheusConfig(&config.Prometheus)
+
+	return append(ocs.issues, prom.issues...)
+}
+
+// validateOCSConfig checks the settings of ocs_config.yaml
+func (v *configValidator) validateOCSConfig(config *OCSConfig) {
+	if len(config.Metrics) == 0 {
+		v.errorf("metrics", "at least one metric is required")
+	}
+	metricNames := make(map[string]int)
+	for i, metric := range config.Metrics {
+		path := fmt.Sprintf("metrics[%d]", i)
+		if metric.Name == "" {
+			v.errorf(path+".name", "is required")
+		} else if first, ok := metricNames[metric.Name]; ok {
+			v.errorf(path+".name", "duplicate metric %q, first defined at metrics[%d]", metric.Name, first)
+		} else {
+			metricNames[metric.Name] = i
+		}
+		if metric.Type == "" {
+			v.errorf(path+".type", "is required")
+		}
+		v.oneOf(path+".type", metric.Type, metricTypes)
+		v.oneOf(path+".aggregation_logic", metric.AggregationLogic, aggregationLogics)
+
+		if polarity, ok := metric.HealthConfig["polarity"]; ok {
+			value, isString := polarity.(string)
+			if !isString {
+				v.errorf(path+".health_config.polarity", "must be a string")
+			}
+			v.oneOf(path+".health_config.polarity", value, metricPolarities)
+		}
+		if threshold, ok := metric.HealthConfig["critical_threshold"]; ok {
+			if _, isNumber := toFloat(threshold); !isNumber {
+				v.errorf(path+".health_config.critical_threshold", "must be a number")
+			}
+		}
+	}
+
+	if len(config.Workload) == 0 {
+		v.errorf("workload", "at least one workload is required")
+	}
+	workloads := make(map[string]int)
+	for i, workload := range config.Workload {
+		path := fmt.Sprintf("workload[%d]", i)
+		if workload == "" {
+			v.errorf(path, "must not be empty")
+		} else if first, ok := workloads[workload]; ok {
+			v.errorf(path, "duplicate workload %q, first listed at workload[%d]", workload, first)
+		} else {
+			workloads[workload] = i
+		}
+	}
+
+	if config.TimeWindowMinutes != nil && *config.TimeWindowMinutes <= 0 {
+		v.errorf("time_window_minutes", "must be greater than 0, got %d", *config.TimeWindowMinutes)
+	}
+	if config.StalenessThresholdMinutes != nil && *config.StalenessThresholdMinutes <= 0 {
+		v.errorf("staleness_threshold_minutes", "must be greater than 0, got %d", *config.StalenessThresholdMinutes)
+	}
+	v.oneOf("output_sort_key", config.OutputSortKey, outputSortKeys)
+	v.oneOf("latest_snapshot", config.LatestSnapshot, latestSnapshotOrders)
+
+	resourceTypes := make([]string, 0, len(config.ResourceTypes))
+	for name := range config.ResourceTypes {
+		resourceTypes = append(resourceTypes, name)
+	}
+	sort.Strings(resourceTypes)
+	for _, name := range resourceTypes {
+		v.oneOf("resource_types."+name, name, resourceTypeNames)
+	}
+
+	registered := registeredProviders()
+	providers := make(map[string]bool)
+	for i, provider := range config.Providers {
+		path := fmt.Sprintf("providers[%d]", i)
+		if providers[provider] {
+			v.errorf(path, "duplicate provider %q", provider)
+		}
+		providers[provider] = true
+		if provider == "" {
+			v.errorf(path, "must not be empty")
+		}
+		v.oneOf(path, provider, registered)
+	}
+	if providers[SourceStatic] && config.StaticTopology == "" {
+		v.errorf("static_topology", "is required when providers includes %s", SourceStatic)
+	}
+
+	if config.IstioConfig.Enabled {
+		v.oneOf("istio_config.source", config.IstioConfig.Source, []string{IstioConfigSourceKubernetes, IstioConfigSourceDirectory})
+		if config.IstioConfig.Source == IstioConfigSourceDirectory && config.IstioConfig.Directory == "" {
+			v.errorf("istio_config.directory", "is required when source is %s", IstioConfigSourceDirectory)
+		}
+	}
+}
+
+// validateProfiles checks each profile's name and its settings merged with the top level
+func (v *configValidator) validateProfiles(config *Config) {
+	for _, name := range config.profileNames() {
+		path := "profiles." + name
+		if name == DefaultProfile || !profileNamePattern.MatchString(name) {
+			v.errorf(path, "invalid profile name %q: use lowercase letters, digits, - and _, and not %s", name, DefaultProfile)
+			continue
+		}
+
+		profile := config.profileConfig(name)
+		scoped := &configValidator{file: v.file, document: v.document, prefix: path + "."}
+		scoped.validateOCSConfig(&profile.OCSConfig)
+		if len(config.Profiles[name].PrometheusInstances) > 0 {
+			scoped.validatePrometheusConfig(&profile.Prometheus)
+		}
+		v.issues = append(v.issues, scoped.issues...)
+	}
+}
+
+// validateAuthConfig checks the auth section and the TLS settings it depends on
+func (v *configValidator) validateAuthConfig(config *Config) {
+	auth := config.Auth
+	if auth.Enabled && len(auth.APIKeys) == 0 && auth.JWT.JWKSFile == "" && len(auth.MTLS.Clients) == 0 && config.Server.AdminToken == "" {
+		v.errorf("auth.enabled", "no api_keys, jwt, mtls clients or server.admin_token are configured, so no request could authenticate")
+	}
+
+	keyNames := make(map[string]bool)
+	for i, key := range auth.APIKeys {
+		path := fmt.Sprintf("auth.api_keys[%d]", i)
+		if key.Name == "" {
+			v.errorf(path+".name", "is required")
+		} else if keyNames[key.Name] {
+			v.errorf(path+".name", "duplicate API key %q", key.Name)
+		}
+		keyNames[key.Name] = true
+		if (key.Key == "") == (key.KeySHA256 == "") {
+			v.errorf(path, "exactly one of key and key_sha256 is required")
+		}
+		if decoded, err := hex.DecodeString(key.KeySHA256); key.KeySHA256 != "" && (err != nil || len(decoded) != sha256.Size) {
+			v.errorf(path+".key_sha256", "must be a hex-encoded SHA-256 hash")
+		}
+		v.validateScopes(path+".scopes", key.Scopes)
+	}
+
+	if auth.JWT.JWKSFile == "" && (auth.JWT.Issuer != "" || auth.JWT.Audience != "" || auth.JWT.ScopesClaim != "") {
+		v.errorf("auth.jwt.jwks_file", "is required when other jwt settings are set")
+	}
+
+	commonNames := make(map[string]bool)
+	for i, client := range auth.MTLS.Clients {
+		path := fmt.Sprintf("auth.mtls.clients[%d]", i)
+		if client.CommonName == "" {
+			v.errorf(path+".common_name", "is required")
+		} else if commonNames[client.CommonName] {
+			v.errorf(path+".common_name", "duplicate client %q", client.CommonName)
+		}
+		commonNames[client.CommonName] = true
+		v.validateScopes(path+".scopes", client.Scopes)
+	}
+	if len(auth.MTLS.Clients) > 0 && config.Server.ClientCAFile == "" {
+		v.errorf("auth.mtls.clients", "require server.client_ca_file to verify client certificates")
+	}
+}
+
+// validateScopes checks that a list of granted scopes is non-empty and only names known scopes
+func (v *configValidator) validateScopes(path string, scopes []string) {
+	if len(scopes) == 0 {
+		v.errorf(path, "at least one scope is required")
+	}
+	for i, scope := range scopes {
+		v.oneOf(fmt.Sprintf("%s[%d]", path, i), scope, authScopes)
+	}
+}
+
+// validateCollectionLimits checks the collection_limits section of ocs_config.yaml
+func (v *configValidator) validateCollectionLimits(limits *CollectionLimitsConfig) {
+	if limits.RequestsPerMinute < 0 {
+		v.errorf("collection_limits.requests_per_minute", "must not be negative")
+	}
+	if limits.Burst < 0 {
+		v.errorf("collection_limits.burst", "must not be negative")
+	}
+	if limits.Burst > 0 && limits.RequestsPerMinute == 0 {
+		v.errorf("collection_limits.burst", "requires requests_per_minute")
+	}
+	if limits.MaxConcurrent < 0 {
+		v.errorf("collection_limits.max_concurrent", "must not be negative")
+	}
+}
+
+// validateServerConfig checks the server and mongodb sections of ocs_config.yaml
+func (v *configValidator) validateServerConfig(config *Config) {
+	if port, err := strconv.Atoi(config.Server.Port); err != nil || port < 1 || port > 65535 {
+		v.errorf("server.port", "must be a port number between 1 and 65535, got %q", config.Server.Port)
+	}
+	if (config.Server.TLSCertFile == "") != (config.Server.TLSKeyFile == "") {
+		v.errorf("server.tls_cert_file", "tls_cert_file and tls_key_file must be set together")
+	}
+	if config.Server.ClientCAFile != "" && config.Server.TLSCertFile == "" {
+		v.errorf("server.client_ca_file", "requires tls_cert_file and tls_key_file, as client certificates are only sent over TLS")
+	}
+	for i, proxy := range config.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.errorf(fmt.Sprintf("server.trusted_proxies[%d]", i), "must be an IP address or CIDR range, got %q", proxy)
+		}
+	}
+	if config.MongoDB.URI == "" {
+		v.errorf("mongodb.uri", "is required")
+	}
+	if config.MongoDB.Database == "" {
+		v.errorf("mongodb.database", "is required")
+	}
+}
+
+// validatePrometheusConfig checks the Prometheus config
+func (v *configValidator) validatePrometheusConfig(config *PrometheusConfig) {
+	if len(config.PrometheusInstances) == 0 {
+		v.errorf("prometheus_instances", "at least one Prometheus instance is required")
+	}
+	var connectors []string
+	for _, name := range registeredProviders() {
+		if name != SourceStatic && name != ConnectorKubernetes {
+			connectors = append(connectors, name)
+		}
+	}
+
+	names := make(map[string]int)
+	for i, instance := range config.PrometheusInstances {
+		path := fmt.Sprintf("prometheus_instances[%d]", i)
+		if instance.Name == "" {
+			v.errorf(path+".name", "is required")
+		} else if first, ok := names[instance.Name]; ok {
+			v.errorf(path+".name", "duplicate instance %q, first defined at prometheus_instances[%d]", instance.Name, first)
+		} else {
+			names[instance.Name] = i
+		}
+		if err := validateBaseURL(instance.BaseURL); err != nil {
+			v.errorf(path+".base_url", "%v", err)
+		}
+		v.oneOf(path+".connector", instance.Connector, connectors)
+	}
+}
+
+// validateBaseURL checks that a Prometheus base URL is an absolute http or https URL
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return fmt.Errorf("is required")
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", baseURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: scheme must be http or https", baseURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q: host is required", baseURL)
+	}
+	return nil
+}
+
+// registeredProviders returns the names of the registered provider types, sorted
+func registeredProviders() []string {
+	providerFactoriesMu.RLock()
+	defer providerFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(providerFactories))
+	for name := range providerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runValidateConfig implements the validate-config subcommand: it loads and validates the
+// configuration files without starting the server, and returns the process exit code
+func runValidateConfig(args []string) int {
+	paths, err := parseConfigFlags(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ocsData, promData, _, err := readConfigFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := parseConfig(paths, ocsData, promData); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s and %s are valid\n", paths.OCSConfig, paths.PrometheusConfig)
+	return 0
+}
@@ -1,51 +1,121 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Server holds the server state
 type Server struct {
-	ocsConfig      *OCSConfig
-	istioConnector *IstioConnector
-	mongoRepo      *MongoDBRepository
+	configPaths ConfigPaths
+	// config is swapped atomically when the configuration files are reloaded
+	config       atomic.Pointer[ActiveConfig]
+	reloadMu     sync.Mutex
+	reloadStatus configReloadStatus
+	mongoRepo    *MongoDBRepository
+	// collectionLimiter enforces collection_limits on collect_istio_metrics
+	collectionLimiter *collectionLimiter
+	// jobs holds the collections started with async=true
+	jobs *jobManager
+	// stores holds the topology store of each profile that has been used
+	storesMu sync.Mutex
+	stores   map[string]*profileStore
+	// validateResponses checks every generated response against the published OCS schema
+	validateResponses bool
 }
 
 // NewServer creates a new server instance
-func NewServer() (*Server, error) {
-	// Load configurations
-	ocsConfig, err := loadOCSConfig()
+func NewServer(paths ConfigPaths) (*Server, error) {
+	// Load configurations, along with the providers and connectors they describe
+	cfg, err := loadActiveConfig(paths)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load OCS config: %w", err)
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
-	log.Printf("Loaded OCS config")
+	cfg.version = 1
+	log.Printf("Loaded config version 1 from %s and %s with %d Prometheus instances and %d providers",
+		paths.OCSConfig, paths.PrometheusConfig, len(cfg.config.Prometheus.PrometheusInstances), len(cfg.providers))
 
-	promConfig, err := loadPrometheusConfig()
+	// Initialize MongoDB repository
+	mongoRepo, err := NewMongoDBRepository(cfg.config.MongoDB)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load Prometheus config: %w", err)
+		return nil, fmt.Errorf("failed to initialize MongoDB: %w", err)
 	}
-	log.Printf("Loaded Prometheus config, using URL: %s", promConfig.PrometheusInstances[0].BaseURL)
 
-	// Initialize Istio connector
-	istioConnector := NewIstioConnector(promConfig.PrometheusInstances[0].BaseURL)
-
-	// Initialize MongoDB repository
-	mongoRepo, err := NewMongoDBRepository()
+	// Merge the changes made through the runtime configuration API over the files
+	runtime, err := mongoRepo.GetLatestRuntimeConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize MongoDB: %w", err)
+		return nil, fmt.Errorf("failed to load runtime config: %w", err)
+	}
+	// A runtime config that no longer fits the files, e.g. because they dropped a workload it
+	// changes, must not keep the server from starting. The files are used alone, as a reload
+	// would keep them, and the error is reported by GET /config/version.
+	var reloadStatus configReloadStatus
+	if runtime != nil {
+		if next, err := cfg.withRuntimeConfig(runtime); err != nil {
+			log.Printf("Failed to apply runtime config version %d, starting with the config files alone: %v", runtime.Version, err)
+			cfg.skippedRuntimeVersion = runtime.Version
+			reloadStatus = configReloadStatus{
+				attemptedAt:             time.Now(),
+				trigger:                 "startup",
+				err:                     err,
+				attemptedHash:           cfg.hash,
+				attemptedRuntimeVersion: runtime.Version,
+			}
+		} else {
+			cfg = next
+			log.Printf("Applied runtime config version %d", runtime.Version)
+		}
 	}
 
-	return &Server{
-		ocsConfig:      ocsConfig,
-		istioConnector: istioConnector,
-		mongoRepo:      mongoRepo,
-	}, nil
+	// Seed the store from a static topology file, e.g. for demos without Prometheus. A topology
+	// imported before is not saved again, so restarts neither pile up copies nor put an old
+	// import ahead of newer collections.
+	if path := cfg.config.Server.ImportTopology; path != "" {
+		topology, err := loadStaticTopology(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import static topology: %w", err)
+		}
+		imported, err := mongoRepo.HasImportedSnapshot(topology.hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for imported static topology: %w", err)
+		}
+		if imported {
+			log.Printf("Static topology from %s is already imported", path)
+		} else {
+			docID, err := mongoRepo.SaveSnapshot(topology.toSnapshot())
+			if err != nil {
+				return nil, fmt.Errorf("failed to save static topology: %w", err)
+			}
+			log.Printf("Imported static topology from %s as %s", path, docID.Hex())
+		}
+	}
+
+	server := &Server{
+		configPaths:       paths,
+		mongoRepo:         mongoRepo,
+		collectionLimiter: newCollectionLimiter(),
+		jobs:              newJobManager(),
+		stores: map[string]*profileStore{
+			DefaultProfile: {repo: mongoRepo, promptCache: NewPromptCache()},
+		},
+		validateResponses: cfg.config.Server.ValidateResponses,
+		reloadStatus:      reloadStatus,
+	}
+	server.config.Store(cfg)
+	return server, nil
 }
 
 // Close closes all connections
@@ -53,10 +123,54 @@ func (s *Server) Close() error {
 	return s.mongoRepo.Close()
 }
 
+// latestSnapshot returns a profile's latest topology snapshot by order, served from the prompt
+// cache when possible
+func (s *Server) latestSnapshot(cfg *ActiveConfig, order string) (*AdjacencyListDocument, error) {
+	store := s.store(cfg.profile)
+	if snapshot, loaded := store.promptCache.Snapshot(order); loaded {
+		return snapshot, nil
+	}
+
+	snapshot, err := store.repo.GetLatestSnapshot(order)
+	if err != nil {
+		return nil, err
+	}
+	store.promptCache.SetSnapshot(order, snapshot)
+	return snapshot, nil
+}
+
+// saveSnapshot saves a new topology snapshot for a profile and invalidates its prompt cache
+func (s *Server) saveSnapshot(cfg *ActiveConfig, doc AdjacencyListDocument) (primitive.ObjectID, error) {
+	store := s.store(cfg.profile)
+	docID, err := store.repo.SaveSnapshot(doc)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	store.promptCache.Invalidate()
+	return docID, nil
+}
+
 // getOCSPromptHandler handles the get_ocs_prompt endpoint
 func (s *Server) getOCSPromptHandler(c *gin.Context) {
-	// Get latest topology from MongoDB
-	adjacencyList, err := s.mongoRepo.GetLatestAdjacencyList()
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+	specVersion := c.DefaultQuery("spec_version", DefaultSpecVersion)
+	if !isSupportedSpecVersion(specVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Unsupported spec_version %s, supported versions: %s", specVersion, strings.Join(supportedSpecVersions, ", ")),
+		})
+		return
+	}
+
+	// Get latest topology, from the cache if nothing was saved since it was loaded
+	order, ok := requestSnapshotOrder(c, cfg)
+	if !ok {
+		return
+	}
+	snapshot, err := s.latestSnapshot(cfg, order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -65,26 +179,90 @@ func (s *Server) getOCSPromptHandler(c *gin.Context) {
 		return
 	}
 
-	// Initialize empty map if nil
-	if adjacencyList == nil {
-		adjacencyList = make(map[string][]string)
+	promptCache := s.store(cfg.profile).promptCache
+	cacheKey := promptCacheKey(snapshot, cfg.version, c.Request.URL.Query())
+	entry, cached := promptCache.Get(cacheKey)
+	if !cached {
+		entry, err = s.buildOCSPrompt(cfg, snapshot, specVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		promptCache.Put(cacheKey, entry)
 	}
 
-	// Build context definitions
-	contextDefinitions := buildContextDefinitions(adjacencyList, s.ocsConfig)
+	c.Header("ETag", entry.etag)
+	setFreshnessHeaders(c, entry.temporal, time.Now())
+	if !entry.lastModified.IsZero() {
+		c.Header("Last-Modified", entry.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if isNotModified(c.Request, entry) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 
-	// Build response
-	response := OCSPromptResponse{
-		SpecVersion:        "0.1",
+	c.JSON(http.StatusOK, entry.response)
+}
+
+// buildOCSPrompt builds the OCS prompt response for a snapshot in the requested spec version,
+// along with its cache validators
+func (s *Server) buildOCSPrompt(cfg *ActiveConfig, snapshot *AdjacencyListDocument, specVersion string) (*cachedPrompt, error) {
+	lastModified := cfg.loadedAt
+	if snapshot != nil && snapshot.collectionTime().After(lastModified) {
+		lastModified = snapshot.collectionTime()
+	}
+
+	// Build context definitions, each carrying when and where its facts were collected
+	contextDefinitions := buildContextDefinitions(snapshot, cfg.ocsConfig)
+	decorateContextDefinitions(contextDefinitions, snapshot, cfg.ocsConfig)
+	annotateReconciliation(contextDefinitions, reconcileTopology(cfg.declaredTopology, snapshotAdjacencyList(snapshot), cfg.ocsConfig.Workload))
+
+	// Build response for the latest spec, then project it onto the requested version
+	temporal := buildTemporalContext(snapshot, cfg.ocsConfig)
+	response, err := convertToSpecVersion(OCSPromptResponse{
+		SpecVersion:        LatestSpecVersion,
 		ContextDefinitions: contextDefinitions,
+		Temporal:           temporal,
+	}, specVersion, cfg.ocsConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Hash the content so clients can skip prompts that have not changed
+	contentHash, err := computeContentHash(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash OCS prompt: %w", err)
+	}
+	if latest, ok := response.(OCSPromptResponse); ok {
+		latest.ContentHash = contentHash
+		response = latest
+	}
+
+	if s.validateResponses {
+		if err := validateOCSResponse(specVersion, response); err != nil {
+			log.Printf("Generated OCS prompt failed schema validation: %v", err)
+			return nil, err
+		}
+	}
+
+	return &cachedPrompt{
+		response:     response,
+		temporal:     temporal,
+		etag:         fmt.Sprintf(`"%s"`, contentHash),
+		lastModified: lastModified,
+	}, nil
 }
 
 // collectIstioMetricsHandler handles the collect_istio_metrics endpoint
 func (s *Server) collectIstioMetricsHandler(c *gin.Context) {
-	if len(s.ocsConfig.Workload) == 0 {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+	if len(cfg.ocsConfig.Workload) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": "No source workloads configured in ocs_config.yaml",
@@ -93,7 +271,7 @@ func (s *Server) collectIstioMetricsHandler(c *gin.Context) {
 	}
 
 	// Parse and validate timestamps
-	fromTimestamp, toTimestamp, err := parseTimestampParams(c, s.ocsConfig)
+	fromTimestamp, toTimestamp, err := parseTimestampParams(c, cfg.ocsConfig)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
@@ -102,25 +280,51 @@ func (s *Server) collectIstioMetricsHandler(c *gin.Context) {
 		return
 	}
 
-	// Query Prometheus via Istio connector
-	result, err := s.istioConnector.QueryMetrics(s.ocsConfig.Workload, fromTimestamp, toTimestamp)
+	async, err := strconv.ParseBool(c.DefaultQuery("async", "false"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to query Prometheus: %v", err),
+			"message": fmt.Sprintf("Invalid async parameter %q", c.Query("async")),
 		})
 		return
 	}
 
-	// Extract source and destination
-	adjacencyList := ExtractAdjacencyList(result)
-
-	// Save to MongoDB
-	docID, err := s.mongoRepo.SaveAdjacencyList(adjacencyList)
+	// Rate limit each client, then run at most one collection per distinct request at a time
+	limits := cfg.config.CollectionLimits
+	if !s.allowCollection(c, limits) {
+		return
+	}
+	key := fmt.Sprintf("%s|%d|%s|%s|%s", cfg.profile, cfg.version, strings.Join(cfg.ocsConfig.Workload, ","),
+		c.Query("from_timestamp"), c.Query("to_timestamp"))
+	if async {
+		s.startCollectionJob(c, cfg, key, fromTimestamp, toTimestamp)
+		return
+	}
+	query := snapshotQuery(c, cfg)
+	// The collection may be shared with other requests, so it is not cancelled with this one
+	result, shared, err := s.collectionLimiter.do(context.Background(), key, limits, false, func() (*collectionResult, error) {
+		return s.collect(context.Background(), cfg, query, fromTimestamp, toTimestamp, nil)
+	})
+	if errors.Is(err, errCollectionBusy) {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(collectionBusyRetryAfter)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Too many collections are running (max_concurrent %d)", limits.MaxConcurrent),
+		})
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Only jobs are cancelled, so this request shared the collection of a cancelled job
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"message": "The collection this request waited for was cancelled; retry the request",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to save to MongoDB: %v", err),
+			"message": err.Error(),
 		})
 		return
 	}
@@ -128,9 +332,13 @@ func (s *Server) collectIstioMetricsHandler(c *gin.Context) {
 	response := gin.H{
 		"status":         "success",
 		"message":        "Metrics collected and saved to MongoDB",
-		"adjacency_list": adjacencyList,
-		"document_id":    docID.Hex(),
-		"timestamp":      time.Now().Format(time.RFC3339),
+		"profile":        cfg.profile,
+		"adjacency_list": result.doc.AdjacencyList,
+		"providers":      result.providers,
+		"document_id":    result.docID.Hex(),
+		"timestamp":      result.doc.Timestamp.Format(time.RFC3339),
+		"collected_at":   result.doc.CollectedAt.Format(time.RFC3339),
+		"shared":         shared,
 	}
 
 	if fromTimestamp != nil && toTimestamp != nil {
@@ -140,21 +348,286 @@ func (s *Server) collectIstioMetricsHandler(c *gin.Context) {
 		// If time window was used from config, include that info
 		fromStr := c.Query("from_timestamp")
 		toStr := c.Query("to_timestamp")
-		if s.ocsConfig.TimeWindowMinutes != nil && fromStr == "" && toStr == "" {
-			response["time_window_minutes"] = *s.ocsConfig.TimeWindowMinutes
+		if cfg.ocsConfig.TimeWindowMinutes != nil && fromStr == "" && toStr == "" {
+			response["time_window_minutes"] = *cfg.ocsConfig.TimeWindowMinutes
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// collectionResult is a saved topology snapshot, shared by every request that waited on its collection
+type collectionResult struct {
+	doc       AdjacencyListDocument
+	docID     primitive.ObjectID
+	providers []string
+}
+
+// collect collects a profile's topology from every configured provider, enriches it and saves it
+// along with the query it answers. Nothing is saved if ctx is cancelled first.
+func (s *Server) collect(ctx context.Context, cfg *ActiveConfig, query *SnapshotQuery, fromTimestamp, toTimestamp *time.Time, progress collectionProgress) (*collectionResult, error) {
+	// Collect and merge topology from every configured provider
+	graph, err := collectContextGraph(ctx, cfg.providers, CollectionRequest{
+		Workloads: cfg.ocsConfig.Workload,
+		From:      fromTimestamp,
+		To:        toTimestamp,
+		StartedAt: time.Now(),
+	}, progress)
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to collect topology: %w", err)
+	}
+
+	doc := graph.toSnapshot()
+	if cfg.istioConfigConnector != nil {
+		mesh, err := cfg.istioConfigConnector.Load(ctx)
+		if err != nil {
+			log.Printf("Failed to load Istio configuration: %v", err)
+		} else {
+			doc.EdgePolicies = BuildEdgePolicies(mesh, &doc)
+		}
+	}
+
+	// A ranged snapshot's data is as of the end of its window, however long ago that was
+	doc.Query = query
+	doc.CollectedAt = time.Now()
+	doc.Timestamp = doc.CollectedAt
+	if fromTimestamp != nil && toTimestamp != nil {
+		doc.WindowStart = fromTimestamp
+		doc.WindowEnd = toTimestamp
+		doc.Step = defaultQueryStep
+		doc.Timestamp = *toTimestamp
+	}
+
+	// Save to MongoDB
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	docID, err := s.saveSnapshot(cfg, doc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to save to MongoDB: %w", err)
+	}
+	return &collectionResult{doc: doc, docID: docID, providers: graph.Providers}, nil
+}
+
+// impactAnalysisHandler handles the impact_analysis endpoint
+func (s *Server) impactAnalysisHandler(c *gin.Context) {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+
+	workload := c.Query("workload")
+	if workload == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "workload query parameter is required",
+		})
+		return
+	}
+
+	order, ok := requestSnapshotOrder(c, cfg)
+	if !ok {
+		return
+	}
+	snapshot, err := s.latestSnapshot(cfg, order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to retrieve topology from MongoDB: %v", err),
+		})
+		return
+	}
+	if snapshot == nil || !hasWorkload(snapshot.AdjacencyList, workload) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Workload %s not found in topology", workload),
+		})
+		return
+	}
+
+	// An optional source narrows the analysis to the failing source -> workload edge
+	var failingEdge *Edge
+	if source := c.Query("source"); source != "" {
+		if !hasEdge(snapshot.AdjacencyList, source, workload) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Edge %s -> %s not found in topology", source, workload),
+			})
+			return
+		}
+		failingEdge = &Edge{Source: source, Destination: workload}
+	}
+
+	response := ImpactAnalysisResponse{
+		Workload:          workload,
+		FailingEdge:       failingEdge,
+		ImpactedWorkloads: analyzeImpact(snapshot.AdjacencyList, snapshot.EdgeTraffic, workload, failingEdge),
+		TrafficKnown:      len(snapshot.EdgeTraffic) > 0,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// rootCauseAnalysisHandler handles the root_cause_analysis endpoint
+func (s *Server) rootCauseAnalysisHandler(c *gin.Context) {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+	var request RootCauseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if len(request.UnhealthyWorkloads) == 0 && len(request.MetricValues) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "unhealthy_workloads or metric_values must be provided",
+		})
+		return
+	}
+
+	order, ok := requestSnapshotOrder(c, cfg)
+	if !ok {
+		return
+	}
+	snapshot, err := s.latestSnapshot(cfg, order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to retrieve topology from MongoDB: %v", err),
+		})
+		return
+	}
+	adjacencyList := snapshotAdjacencyList(snapshot)
+
+	// Emit one context definition per candidate, in rank order
+	candidates := rankRootCauses(adjacencyList, cfg.ocsConfig, request.UnhealthyWorkloads, request.MetricValues)
+	contextDefinitions := make([]OCSContextDefinition, 0, len(candidates))
+	for i := range candidates {
+		contextDef := buildContextDefinition(snapshot, cfg.ocsConfig, candidates[i].Workload)
+		contextDef.RootCause = &candidates[i]
+		contextDefinitions = append(contextDefinitions, contextDef)
+	}
+	decorateContextDefinitions(contextDefinitions, snapshot, cfg.ocsConfig)
+
+	response := OCSPromptResponse{
+		SpecVersion:        LatestSpecVersion,
+		ContextDefinitions: contextDefinitions,
+		Temporal:           buildTemporalContext(snapshot, cfg.ocsConfig),
+	}
+	setFreshnessHeaders(c, response.Temporal, time.Now())
+
+	if s.validateResponses {
+		if err := validateOCSResponse(response.SpecVersion, response); err != nil {
+			log.Printf("Generated root cause analysis failed schema validation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
 		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// importTopologyHandler handles the topology/import endpoint. The body is a static topology in
+// YAML or JSON, saved as the latest snapshot tagged as static.
+func (s *Server) importTopologyHandler(c *gin.Context) {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+
+	topology, err := parseStaticTopology(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	doc := topology.toSnapshot()
+	docID, err := s.saveSnapshot(cfg, doc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to save to MongoDB: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message":        "Static topology imported and saved to MongoDB",
+		"source":         SourceStatic,
+		"adjacency_list": doc.AdjacencyList,
+		"document_id":    docID.Hex(),
+		"timestamp":      time.Now().Format(time.RFC3339),
+	})
+}
+
+// topologyReconciliationHandler handles the topology/reconciliation endpoint
+func (s *Server) topologyReconciliationHandler(c *gin.Context) {
+	cfg, ok := s.requestProfile(c)
+	if !ok {
+		return
+	}
+	order, ok := requestSnapshotOrder(c, cfg)
+	if !ok {
+		return
+	}
+	snapshot, err := s.latestSnapshot(cfg, order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to retrieve topology from MongoDB: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, reconcileTopology(cfg.declaredTopology, snapshotAdjacencyList(snapshot), cfg.ocsConfig.Workload))
+}
+
+// schemaHandler handles the ocs/schema endpoint
+func (s *Server) schemaHandler(c *gin.Context) {
+	schema, err := loadSpecSchema(c.DefaultQuery("spec_version", DefaultSpecVersion))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
+
 // healthCheckHandler handles health check endpoint
 func (s *Server) healthCheckHandler(c *gin.Context) {
+	cfg := s.activeConfig()
 	response := gin.H{
-		"status":     "healthy",
-		"prometheus": s.istioConnector.prometheusURL != "",
-		"mongodb":    s.mongoRepo != nil,
-		"timestamp":  time.Now().Format(time.RFC3339),
+		"status":    "healthy",
+		"providers": len(cfg.providers),
+		"mongodb":   s.mongoRepo != nil,
+		"timestamp": time.Now().Format(time.RFC3339),
 	}
 	c.JSON(http.StatusOK, response)
 }
@@ -221,9 +694,9 @@ func parseTimestamp(timestampStr string) (*time.Time, error) {
 	return nil, fmt.Errorf("unable to parse timestamp")
 }
 
-// buildContextDefinitions builds context definitions from adjacency list and config
-func buildContextDefinitions(adjacencyList map[string][]string, config *OCSConfig) []OCSContextDefinition {
-	var contextDefinitions []OCSContextDefinition
+// buildContextDefinitions builds context definitions from a topology snapshot and config
+func buildContextDefinitions(snapshot *AdjacencyListDocument, config *OCSConfig) []OCSContextDefinition {
+	adjacencyList := snapshotAdjacencyList(snapshot)
 
 	// Create a context definition for each workload
 	workloadSet := make(map[string]bool)
@@ -242,27 +715,77 @@ func buildContextDefinitions(adjacencyList map[string][]string, config *OCSConfi
 	}
 
 	// Create context definition for each workload
+	contextDefinitions := make([]OCSContextDefinition, 0, len(workloadSet))
 	for workload := range workloadSet {
-		contextDef := OCSContextDefinition{
-			ResourceID: fmt.Sprintf("workload-%s", workload),
-			Domain:     "compute.k8s",
-			Identity: map[string]interface{}{
-				"workload": workload,
-			},
-			Metrics: config.Metrics,
-			Policy:  config.Policy,
-		}
+		contextDefinitions = append(contextDefinitions, buildContextDefinition(snapshot, config, workload))
+	}
+
+	// Services, namespaces and clusters are described only when enabled in config
+	contextDefinitions = append(contextDefinitions, buildDerivedContextDefinitions(snapshot, config)...)
+
+	// Map iteration order is random, so sort to keep the output deterministic
+	sortContextDefinitions(contextDefinitions, config.OutputSortKey)
+
+	return contextDefinitions
+}
 
-		// Build topology from adjacency list
-		topology := buildTopology(adjacencyList, workload)
-		if len(topology) > 0 {
-			contextDef.Topology = topology
+// buildContextDefinition builds the context definition for a single node of the topology graph,
+// described according to its resource type
+func buildContextDefinition(snapshot *AdjacencyListDocument, config *OCSConfig, node string) OCSContextDefinition {
+	kind := classifyNode(snapshot, config, node)
+	resourceType := config.resourceType(kind)
+
+	contextDef := OCSContextDefinition{
+		Domain: resourceType.Domain,
+		node:   node,
+	}
+	if kind == ResourceTypeExternalHost {
+		contextDef.ResourceID = resourceID(resourceType, node, "", "")
+		contextDef.Identity = map[string]interface{}{
+			"host":          node,
+			"resource_type": kind,
+		}
+	} else {
+		var origin WorkloadOrigin
+		if snapshot != nil {
+			origin = snapshot.WorkloadOrigins[node]
+		}
+		contextDef.ResourceID = resourceID(resourceType, node, origin.Namespace, origin.Cluster)
+		contextDef.Identity = map[string]interface{}{
+			"workload":      node,
+			"resource_type": kind,
 		}
+		contextDef.Metrics = config.Metrics
+		contextDef.Policy = config.Policy
+		contextDef.Kubernetes = lookupKubernetesWorkload(snapshot, node)
+	}
 
-		contextDefinitions = append(contextDefinitions, contextDef)
+	if snapshot != nil {
+		contextDef.Attributes = snapshot.EntityAttributes[node]
+		contextDef.ObservedMetrics = snapshot.MetricValues[node]
 	}
 
-	return contextDefinitions
+	// Build topology from adjacency list, with the configured policy of each outgoing edge
+	topology := buildTopology(snapshotAdjacencyList(snapshot), node)
+	if snapshot != nil && len(snapshot.EdgePolicies[node]) > 0 {
+		topology["dependency_policies"] = snapshot.EdgePolicies[node]
+	}
+	if snapshot != nil && len(snapshot.EdgeAttributes[node]) > 0 {
+		topology["dependency_attributes"] = snapshot.EdgeAttributes[node]
+	}
+	if len(topology) > 0 {
+		contextDef.Topology = topology
+	}
+
+	return contextDef
+}
+
+// snapshotAdjacencyList returns a snapshot's adjacency list, or an empty one if there is no snapshot
+func snapshotAdjacencyList(snapshot *AdjacencyListDocument) map[string][]string {
+	if snapshot == nil || snapshot.AdjacencyList == nil {
+		return make(map[string][]string)
+	}
+	return snapshot.AdjacencyList
 }
 
 // buildTopology builds topology information for a specific workload
@@ -271,7 +794,7 @@ func buildTopology(adjacencyList map[string][]string, workload string) map[strin
 
 	// Add dependencies (destinations this workload connects to)
 	if destinations, exists := adjacencyList[workload]; exists && len(destinations) > 0 {
-		topology["dependencies"] = destinations
+		topology["dependencies"] = sortedCopy(destinations)
 	}
 
 	// Add reverse dependencies (workloads that connect to this one)
@@ -284,6 +807,7 @@ func buildTopology(adjacencyList map[string][]string, workload string) map[strin
 		}
 	}
 	if len(reverseDeps) > 0 {
+		sort.Strings(reverseDeps)
 		topology["dependents"] = reverseDeps
 	}
 
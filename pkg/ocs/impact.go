@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sort"
+)
+
+// analyzeImpact walks the adjacency list in reverse from a degraded workload and returns all
+// transitively impacted workloads. If failingEdge is set, only the edge's source (and everything
+// upstream of it) is considered impacted rather than every dependent of the workload.
+func analyzeImpact(adjacencyList map[string][]string, edgeTraffic map[string]map[string]float64, workload string, failingEdge *Edge) []ImpactedWorkload {
+	dependents := reverseAdjacencyList(adjacencyList)
+
+	// Breadth-first search so the first visit of a workload gives its shortest hop distance
+	hops := make(map[string]int)
+	var queue []string
+	if failingEdge != nil {
+		hops[failingEdge.Source] = 1
+		queue = append(queue, failingEdge.Source)
+	} else {
+		hops[workload] = 0
+		queue = append(queue, workload)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[current] {
+			if _, visited := hops[dependent]; visited {
+				continue
+			}
+			hops[dependent] = hops[current] + 1
+			queue = append(queue, dependent)
+		}
+	}
+
+	impacted := make([]ImpactedWorkload, 0, len(hops))
+	for name, distance := range hops {
+		if failingEdge == nil && name == workload {
+			continue
+		}
+
+		// Dependencies of this workload that are themselves degraded or impacted
+		var via []string
+		for _, dest := range adjacencyList[name] {
+			if dest == name {
+				continue
+			}
+			_, isImpacted := hops[dest]
+			onFailingEdge := failingEdge != nil && name == failingEdge.Source && dest == failingEdge.Destination
+			if isImpacted || onFailingEdge {
+				via = append(via, dest)
+			}
+		}
+		sort.Strings(via)
+
+		entry := ImpactedWorkload{
+			Workload: name,
+			Hops:     distance,
+			Via:      via,
+		}
+		if fraction, ok := trafficFraction(edgeTraffic[name], via); ok {
+			entry.TrafficFractionAffected = &fraction
+		}
+		impacted = append(impacted, entry)
+	}
+
+	sort.Slice(impacted, func(i, j int) bool {
+		if impacted[i].Hops != impacted[j].Hops {
+			return impacted[i].Hops < impacted[j].Hops
+		}
+		return impacted[i].Workload < impacted[j].Workload
+	})
+
+	return impacted
+}
+
+// reverseAdjacencyList maps each destination to the sorted list of sources that call it
+func reverseAdjacencyList(adjacencyList map[string][]string) map[string][]string {
+	dependents := make(map[string][]string)
+	for source, destinations := range adjacencyList {
+		for _, dest := range destinations {
+			dependents[dest] = append(dependents[dest], source)
+		}
+	}
+	for dest := range dependents {
+		sort.Strings(dependents[dest])
+	}
+	return dependents
+}
+
+// trafficFraction returns the share of outbound traffic that goes to the given destinations.
+// It reports false when no traffic is known for the source.
+func trafficFraction(outbound map[string]float64, destinations []string) (float64, bool) {
+	var total float64
+	for _, value := range outbound {
+		total += value
+	}
+	if total <= 0 {
+		return 0, false
+	}
+
+	var affected float64
+	for _, dest := range destinations {
+		affected += outbound[dest]
+	}
+	return affected / total, true
+}
+
+// hasWorkload reports whether a workload appears in the adjacency list as a source or destination
+func hasWorkload(adjacencyList map[string][]string, workload string) bool {
+	if _, exists := adjacencyList[workload]; exists {
+		return true
+	}
+	return hasEdgeTo(adjacencyList, workload)
+}
+
+// hasEdgeTo reports whether any source in the adjacency list calls the given destination
+func hasEdgeTo(adjacencyList map[string][]string, destination string) bool {
+	for _, destinations := range adjacencyList {
+		for _, dest := range destinations {
+			if dest == destination {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasEdge reports whether the adjacency list contains the source -> destination edge
+func hasEdge(adjacencyList map[string][]string, source, destination string) bool {
+	for _, dest := range adjacencyList[source] {
+		if dest == destination {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeImpact(t *testing.T) {
+	// proxy -> app -> database, worker -> database, app -> cache
+	adjacencyList := map[string][]string{
+		"proxy":  {"app"},
+		"app":    {"database", "cache"},
+		"worker": {"database"},
+	}
+	edgeTraffic := map[string]map[string]float64{
+		"app": {"database": 75, "cache": 25},
+	}
+	fraction := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name        string
+		workload    string
+		failingEdge *Edge
+		want        []ImpactedWorkload
+	}{
+		{
+			name:     "transitive dependents",
+			workload: "database",
+			want: []ImpactedWorkload{
+				{Workload: "app", Hops: 1, Via: []string{"database"}, TrafficFractionAffected: fraction(0.75)},
+				{Workload: "worker", Hops: 1, Via: []string{"database"}},
+				{Workload: "proxy", Hops: 2, Via: []string{"app"}},
+			},
+		},
+		{
+			name:     "no dependents",
+			workload: "proxy",
+			want:     []ImpactedWorkload{},
+		},
+		{
+			name:        "failing edge only impacts its source",
+			workload:    "database",
+			failingEdge: &Edge{Source: "worker", Destination: "database"},
+			want: []ImpactedWorkload{
+				{Workload: "worker", Hops: 1, Via: []string{"database"}},
+			},
+		},
+		{
+			name:        "failing edge impacts upstream of its source",
+			workload:    "database",
+			failingEdge: &Edge{Source: "app", Destination: "database"},
+			want: []ImpactedWorkload{
+				{Workload: "app", Hops: 1, Via: []string{"database"}, TrafficFractionAffected: fraction(0.75)},
+				{Workload: "proxy", Hops: 2, Via: []string{"app"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := analyzeImpact(adjacencyList, edgeTraffic, tt.workload, tt.failingEdge)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("analyzeImpact() = %s, want %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestAnalyzeImpactCycle(t *testing.T) {
+	adjacencyList := map[string][]string{
+		"a": {"b"},
+		"b": {"a"},
+	}
+	got := analyzeImpact(adjacencyList, nil, "a", nil)
+	want := []ImpactedWorkload{{Workload: "b", Hops: 1, Via: []string{"a"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("analyzeImpact() = %s, want %s", mustJSON(t, got), mustJSON(t, want))
+	}
+}
+
+func TestImpactedWorkloadOmitsEmptyVia(t *testing.T) {
+	data := mustJSON(t, ImpactedWorkload{Workload: "app", Hops: 1})
+	if strings.Contains(data, "via") {
+		t.Errorf("ImpactedWorkload without via serialized as %s", data)
+	}
+}
+
+// mustJSON renders a value for test failure messages
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConnectorIstioConfig identifies facts read from Istio routing and security resources
+const ConnectorIstioConfig = "istio_config"
+
+// Sources the Istio config connector can read resources from
+const (
+	IstioConfigSourceKubernetes = "kubernetes"
+	IstioConfigSourceDirectory  = "directory"
+)
+
+// istioRootNamespace holds mesh-wide PeerAuthentication policies
+const istioRootNamespace = "istio-system"
+
+// istioMeshConfig holds the Istio resources that shape calls between workloads
+type istioMeshConfig struct {
+	VirtualServices     []istioVirtualService
+	DestinationRules    []istioDestinationRule
+	PeerAuthentications []istioPeerAuthentication
+}
+
+// IstioConfigConnector reads VirtualServices, DestinationRules and PeerAuthentications from the
+// Kubernetes API or from a directory of YAML manifests
+type IstioConfigConnector struct {
+	source    string
+	directory string
+	kube      *KubernetesConnector
+}
+
+// NewIstioConfigConnector creates an Istio config connector. Reading from the Kubernetes API
+// uses the credentials of the kubernetes section of ocs_config.yaml.
+func NewIstioConfigConnector(config IstioConfigSourceConfig, kubeConfig KubernetesConfig) (*IstioConfigConnector, error) {
+	switch config.Source {
+	case IstioConfigSourceDirectory:
+		if config.Directory == "" {
+			return nil, fmt.Errorf("istio_config.directory is required when source is %s", IstioConfigSourceDirectory)
+		}
+		return &IstioConfigConnector{source: config.Source, directory: config.Directory}, nil
+	case IstioConfigSourceKubernetes, "":
+		kube, err := NewKubernetesConnector(kubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &IstioConfigConnector{source: IstioConfigSourceKubernetes, kube: kube}, nil
+	default:
+		return nil, fmt.Errorf("unknown istio_config.source %q, expected %s or %s", config.Source, IstioConfigSourceKubernetes, IstioConfigSourceDirectory)
+	}
+}
+
+// Load reads the current Istio resources from the configured source
+func (icc *IstioConfigConnector) Load(ctx context.Context) (*istioMeshConfig, error) {
+	if icc.source == IstioConfigSourceDirectory {
+		return icc.loadDirectory()
+	}
+
+	var mesh istioMeshConfig
+	var virtualServices struct {
+		Items []istioVirtualService `json:"items"`
+	}
+	if err := icc.kube.list(ctx, "/apis/networking.istio.io/v1beta1", "virtualservices", &virtualServices); err != nil {
+		return nil, err
+	}
+	var destinationRules struct {
+		Items []istioDestinationRule `json:"items"`
+	}
+	if err := icc.kube.list(ctx, "/apis/networking.istio.io/v1beta1", "destinationrules", &destinationRules); err != nil {
+		return nil, err
+	}
+	var peerAuthentications struct {
+		Items []istioPeerAuthentication `json:"items"`
+	}
+	if err := icc.kube.list(ctx, "/apis/security.istio.io/v1beta1", "peerauthentications", &peerAuthentications); err != nil {
+		return nil, err
+	}
+
+	mesh.VirtualServices = virtualServices.Items
+	mesh.DestinationRules = destinationRules.Items
+	mesh.PeerAuthentications = peerAuthentications.Items
+	log.Printf("Loaded %d VirtualServices, %d DestinationRules and %d PeerAuthentications from Kubernetes API",
+		len(mesh.VirtualServices), len(mesh.DestinationRules), len(mesh.PeerAuthentications))
+	return &mesh, nil
+}
+
+// loadDirectory reads every YAML manifest in the directory tree, which may contain several
+// documents separated by ---. Resources of other kinds are ignored.
+func (icc *IstioConfigConnector) loadDirectory() (*istioMeshConfig, error) {
+	var mesh istioMeshConfig
+
+	err := filepath.WalkDir(icc.directory, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+
+		decoder := yaml.NewDecoder(file)
+		for {
+			var node yaml.Node
+			if err := decoder.Decode(&node); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+
+			var header struct {
+				Kind string `yaml:"kind"`
+			}
+			if err := node.Decode(&header); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+
+			switch header.Kind {
+			case "VirtualService":
+				var resource istioVirtualService
+				if err := node.Decode(&resource); err != nil {
+					return fmt.Errorf("failed to parse VirtualService in %s: %w", path, err)
+				}
+				mesh.VirtualServices = append(mesh.VirtualServices, resource)
+			case "DestinationRule":
+				var resource istioDestinationRule
+				if err := node.Decode(&resource); err != nil {
+					return fmt.Errorf("failed to parse DestinationRule in %s: %w", path, err)
+				}
+				mesh.DestinationRules = append(mesh.DestinationRules, resource)
+			case "PeerAuthentication":
+				var resource istioPeerAuthentication
+				if err := node.Decode(&resource); err != nil {
+					return fmt.Errorf("failed to parse PeerAuthentication in %s: %w", path, err)
+				}
+				mesh.PeerAuthentications = append(mesh.PeerAuthentications, resource)
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Istio manifests: %w", err)
+	}
+
+	// Manifests in a namespace-less file belong to the default namespace
+	for i := range mesh.VirtualServices {
+		defaultNamespace(&mesh.VirtualServices[i].Metadata)
+	}
+	for i := range mesh.DestinationRules {
+		defaultNamespace(&mesh.DestinationRules[i].Metadata)
+	}
+	for i := range mesh.PeerAuthentications {
+		defaultNamespace(&mesh.PeerAuthentications[i].Metadata)
+	}
+
+	log.Printf("Loaded %d VirtualServices, %d DestinationRules and %d PeerAuthentications from %s",
+		len(mesh.VirtualServices), len(mesh.DestinationRules), len(mesh.PeerAuthentications), icc.directory)
+	return &mesh, nil
+}
+
+// defaultNamespace sets the namespace of a manifest without one to default
+func defaultNamespace(meta *istioResourceMeta) {
+	if meta.Namespace == "" {
+		meta.Namespace = "default"
+	}
+}
+
+// BuildEdgePolicies resolves the Istio resources that apply to each edge of a snapshot. An edge's
+// destination workload is mapped to its services through the snapshot's observed services.
+func BuildEdgePolicies(mesh *istioMeshConfig, snapshot *AdjacencyListDocument) map[string]map[string]EdgePolicy {
+	edgePolicies := make(map[string]map[string]EdgePolicy)
+
+	for source, destinations := range snapshot.AdjacencyList {
+		for _, destination := range destinations {
+			policy, ok := buildEdgePolicy(mesh, snapshot, destination)
+			if !ok {
+				continue
+			}
+			policy.Summary = fmt.Sprintf("%s→%s: %s", source, destination, policy.Summary)
+			if edgePolicies[source] == nil {
+				edgePolicies[source] = make(map[string]EdgePolicy)
+			}
+			edgePolicies[source][destination] = policy
+		}
+	}
+
+	return edgePolicies
+}
+
+// buildEdgePolicy collects the settings that apply to calls to a destination, and reports
+// whether any Istio resource applies
+func buildEdgePolicy(mesh *istioMeshConfig, snapshot *AdjacencyListDocument, destination string) (EdgePolicy, bool) {
+	var policy EdgePolicy
+	hosts := destinationHosts(snapshot, destination)
+
+	if vs, route, ok := virtualServiceRouteFor(mesh, hosts); ok {
+		policy.Timeout = route.Timeout
+		if route.Retries != nil {
+			policy.Retries = &RetryPolicy{
+				Attempts:      route.Retries.Attempts,
+				PerTryTimeout: route.Retries.PerTryTimeout,
+				RetryOn:       route.Retries.RetryOn,
+			}
+		}
+		if len(route.Route) > 1 {
+			for _, target := range route.Route {
+				policy.TrafficSplit = append(policy.TrafficSplit, TrafficSplitTarget{
+					Host:   target.Destination.Host,
+					Subset: target.Destination.Subset,
+					Weight: target.Weight,
+				})
+			}
+		}
+		policy.Resources = append(policy.Resources, istioResourceName("VirtualService", vs.Metadata))
+	}
+
+	if dr, ok := destinationRuleFor(mesh, snapshot, destination, hosts); ok {
+		if tp := dr.Spec.TrafficPolicy; tp != nil {
+			breaker := &CircuitBreaker{}
+			if tp.ConnectionPool != nil && tp.ConnectionPool.TCP != nil {
+				breaker.MaxConnections = tp.ConnectionPool.TCP.MaxConnections
+			}
+			if tp.ConnectionPool != nil && tp.ConnectionPool.HTTP != nil {
+				breaker.MaxPendingRequests = tp.ConnectionPool.HTTP.HTTP1MaxPendingRequests
+			}
+			if od := tp.OutlierDetection; od != nil {
+				breaker.Consecutive5xxErrors = od.Consecutive5xxErrors
+				breaker.OutlierInterval = od.Interval
+				breaker.BaseEjectionTime = od.BaseEjectionTime
+				breaker.MaxEjectionPercentage = od.MaxEjectionPercent
+			}
+			if *breaker != (CircuitBreaker{}) {
+				policy.CircuitBreaker = breaker
+			}
+		}
+		policy.Resources = append(policy.Resources, istioResourceName("DestinationRule", dr.Metadata))
+	}
+
+	if pa := peerAuthenticationFor(mesh, snapshot, destination); pa != nil && pa.Spec.MTLS != nil {
+		policy.MTLSMode = pa.Spec.MTLS.Mode
+		policy.Resources = append(policy.Resources, istioResourceName("PeerAuthentication", pa.Metadata))
+	}
+
+	if len(policy.Resources) == 0 {
+		return policy, false
+	}
+	policy.Summary = summarizeEdgePolicy(policy)
+	return policy, true
+}
+
+// virtualServiceRouteFor returns the HTTP route that sends traffic to one of the hosts. Routes
+// are tried in order within a VirtualService, as Istio does, and VirtualServices declared for
+// the hosts themselves are tried before those that only route to them.
+func virtualServiceRouteFor(mesh *istioMeshConfig, hosts []string) (*istioVirtualService, *istioHTTPRoute, bool) {
+	virtualServices := make([]*istioVirtualService, 0, len(mesh.VirtualServices))
+	for i := range mesh.VirtualServices {
+		virtualServices = append(virtualServices, &mesh.VirtualServices[i])
+	}
+	sort.SliceStable(virtualServices, func(i, j int) bool {
+		a, b := virtualServices[i], virtualServices[j]
+		aDeclared := hostSpecificity(a.Spec.Hosts, a.Metadata.Namespace, hosts) > 0
+		bDeclared := hostSpecificity(b.Spec.Hosts, b.Metadata.Namespace, hosts) > 0
+		if aDeclared != bDeclared {
+			return aDeclared
+		}
+		return istioResourceName("", a.Metadata) < istioResourceName("", b.Metadata)
+	})
+
+	for _, vs := range virtualServices {
+		for i := range vs.Spec.HTTP {
+			route := &vs.Spec.HTTP[i]
+			for _, target := range route.Route {
+				if hostSpecificity([]string{target.Destination.Host}, vs.Metadata.Namespace, hosts) > 0 {
+					return vs, route, true
+				}
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// destinationRuleFor returns the DestinationRule for the hosts with the most specific host: an
+// exact host, then the longest wildcard. Ties go to a rule in the destination's namespace, then
+// to the first by namespace and name.
+func destinationRuleFor(mesh *istioMeshConfig, snapshot *AdjacencyListDocument, destination string, hosts []string) (*istioDestinationRule, bool) {
+	namespace := snapshot.WorkloadOrigins[destination].Namespace
+	var best *istioDestinationRule
+	bestSpecificity := 0
+	for i := range mesh.DestinationRules {
+		dr := &mesh.DestinationRules[i]
+		specificity := hostSpecificity([]string{dr.Spec.Host}, dr.Metadata.Namespace, hosts)
+		if specificity == 0 {
+			continue
+		}
+		if best == nil || specificity > bestSpecificity {
+			best, bestSpecificity = dr, specificity
+			continue
+		}
+		if specificity < bestSpecificity {
+			continue
+		}
+		inNamespace, bestInNamespace := dr.Metadata.Namespace == namespace, best.Metadata.Namespace == namespace
+		if inNamespace != bestInNamespace {
+			if inNamespace {
+				best = dr
+			}
+			continue
+		}
+		if istioResourceName("", dr.Metadata) < istioResourceName("", best.Metadata) {
+			best = dr
+		}
+	}
+	return best, best != nil
+}
+
+// peerAuthenticationFor returns the most specific PeerAuthentication for a destination workload:
+// workload selector, then namespace-wide, then mesh-wide in the root namespace
+func peerAuthenticationFor(mesh *istioMeshConfig, snapshot *AdjacencyListDocument, destination string) *istioPeerAuthentication {
+	namespace := snapshot.WorkloadOrigins[destination].Namespace
+	var labels map[string]string
+	if workload := lookupKubernetesWorkload(snapshot, destination); workload != nil {
+		labels = workload.Labels
+		namespace = workload.Namespace
+	}
+
+	var namespaceWide, meshWide *istioPeerAuthentication
+	for i := range mesh.PeerAuthentications {
+		pa := &mesh.PeerAuthentications[i]
+		hasSelector := pa.Spec.Selector != nil && len(pa.Spec.Selector.MatchLabels) > 0
+		switch {
+		case hasSelector && namespace != "" && pa.Metadata.Namespace == namespace && matchesSelector(pa.Spec.Selector.MatchLabels, labels):
+			return pa
+		case !hasSelector && namespace != "" && pa.Metadata.Namespace == namespace:
+			namespaceWide = pa
+		case !hasSelector && pa.Metadata.Namespace == istioRootNamespace:
+			meshWide = pa
+		}
+	}
+	if namespaceWide != nil {
+		return namespaceWide
+	}
+	return meshWide
+}
+
+// destinationHosts returns the hosts a destination is reachable at: its observed services, or the
+// host itself for destinations outside the mesh
+func destinationHosts(snapshot *AdjacencyListDocument, destination string) []string {
+	for _, host := range snapshot.ExternalHosts {
+		if host == destination {
+			return []string{destination}
+		}
+	}
+
+	var hosts []string
+	for service, workloads := range snapshot.Services {
+		for _, workload := range workloads {
+			if workload == destination {
+				hosts = append(hosts, service)
+				break
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// hostSpecificity reports how specifically any Istio host, resolved in the resource's namespace,
+// matches one of the destination hosts: 0 for no match, the host's length plus one for an exact
+// match and the suffix's length for a wildcard. Short names resolve to
+// <name>.<namespace>.svc.cluster.local and *.suffix wildcards match by suffix.
+func hostSpecificity(istioHosts []string, namespace string, hosts []string) int {
+	best := 0
+	for _, istioHost := range istioHosts {
+		if istioHost == "" || istioHost == "*" {
+			continue
+		}
+		resolved := istioHost
+		if !strings.Contains(istioHost, ".") {
+			resolved = fmt.Sprintf("%s.%s.svc.cluster.local", istioHost, namespace)
+		}
+		for _, host := range hosts {
+			switch {
+			case resolved == host:
+				best = max(best, len(resolved)+1)
+			case strings.HasPrefix(resolved, "*.") && strings.HasSuffix(host, resolved[1:]):
+				best = max(best, len(resolved)-1)
+			}
+		}
+	}
+	return best
+}
+
+// istioResourceName formats a resource reference as kind/namespace/name
+func istioResourceName(kind string, meta istioResourceMeta) string {
+	return fmt.Sprintf("%s/%s/%s", kind, meta.Namespace, meta.Name)
+}
+
+// summarizeEdgePolicy describes an edge policy in one line, e.g. "2s timeout, 3 retries, mTLS STRICT"
+func summarizeEdgePolicy(policy EdgePolicy) string {
+	var parts []string
+	if policy.Timeout != "" {
+		parts = append(parts, policy.Timeout+" timeout")
+	}
+	if policy.Retries != nil {
+		retries := fmt.Sprintf("%d retries", policy.Retries.Attempts)
+		if policy.Retries.PerTryTimeout != "" {
+			retries += fmt.Sprintf(" (%s per try)", policy.Retries.PerTryTimeout)
+		}
+		parts = append(parts, retries)
+	}
+	if len(policy.TrafficSplit) > 0 {
+		var targets []string
+		for _, target := range policy.TrafficSplit {
+			name := target.Host
+			if target.Subset != "" {
+				name += "/" + target.Subset
+			}
+			targets = append(targets, fmt.Sprintf("%s %d%%", name, target.Weight))
+		}
+		parts = append(parts, "traffic split "+strings.Join(targets, ", "))
+	}
+	if cb := policy.CircuitBreaker; cb != nil {
+		var limits []string
+		if cb.MaxConnections > 0 {
+			limits = append(limits, fmt.Sprintf("max %d connections", cb.MaxConnections))
+		}
+		if cb.MaxPendingRequests > 0 {
+			limits = append(limits, fmt.Sprintf("max %d pending requests", cb.MaxPendingRequests))
+		}
+		if cb.Consecutive5xxErrors > 0 {
+			limits = append(limits, fmt.Sprintf("ejects after %d consecutive 5xx", cb.Consecutive5xxErrors))
+		}
+		if len(limits) > 0 {
+			parts = append(parts, "circuit breaker "+strings.Join(limits, ", "))
+		}
+	}
+	if policy.MTLSMode != "" {
+		parts = append(parts, "mTLS "+policy.MTLSMode)
+	}
+	if len(parts) == 0 {
+		return "no explicit settings"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testIstioManifests = `apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: catalog
+  namespace: shop
+spec:
+  hosts: [reviews, ratings]
+  http:
+  - route:
+    - destination: {host: reviews}
+    timeout: 3s
+  - route:
+    - destination: {host: ratings, subset: v1}
+      weight: 90
+    - destination: {host: ratings, subset: v2}
+      weight: 10
+    timeout: 1s
+    retries: {attempts: 2}
+---
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: mesh-default
+  namespace: istio-system
+spec:
+  host: "*.svc.cluster.local"
+  trafficPolicy:
+    connectionPool:
+      tcp: {maxConnections: 100}
+---
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: ratings
+  namespace: shop
+spec:
+  host: ratings
+  trafficPolicy:
+    connectionPool:
+      tcp: {maxConnections: 5}
+`
+
+func TestBuildEdgePolicies(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "mesh.yaml"), []byte(testIstioManifests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mesh, err := (&IstioConfigConnector{source: IstioConfigSourceDirectory, directory: directory}).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	snapshot := &AdjacencyListDocument{
+		AdjacencyList: map[string][]string{"frontend": {"reviews", "ratings", "cart"}},
+		Services: map[string][]string{
+			"reviews.shop.svc.cluster.local": {"reviews"},
+			"ratings.shop.svc.cluster.local": {"ratings"},
+			"cart.shop.svc.cluster.local":    {"cart"},
+		},
+		WorkloadOrigins: map[string]WorkloadOrigin{
+			"reviews": {Namespace: "shop"},
+			"ratings": {Namespace: "shop"},
+			"cart":    {Namespace: "shop"},
+		},
+	}
+	policies := BuildEdgePolicies(mesh, snapshot)["frontend"]
+
+	tests := []struct {
+		destination string
+		want        EdgePolicy
+	}{
+		{
+			destination: "reviews",
+			want: EdgePolicy{
+				Timeout:        "3s",
+				CircuitBreaker: &CircuitBreaker{MaxConnections: 100},
+				Resources:      []string{"VirtualService/shop/catalog", "DestinationRule/istio-system/mesh-default"},
+				Summary:        "frontend→reviews: 3s timeout, circuit breaker max 100 connections",
+			},
+		},
+		{
+			// The second route sends traffic to ratings, and the exact DestinationRule beats the wildcard
+			destination: "ratings",
+			want: EdgePolicy{
+				Timeout: "1s",
+				Retries: &RetryPolicy{Attempts: 2},
+				TrafficSplit: []TrafficSplitTarget{
+					{Host: "ratings", Subset: "v1", Weight: 90},
+					{Host: "ratings", Subset: "v2", Weight: 10},
+				},
+				CircuitBreaker: &CircuitBreaker{MaxConnections: 5},
+				Resources:      []string{"VirtualService/shop/catalog", "DestinationRule/shop/ratings"},
+				Summary:        "frontend→ratings: 1s timeout, 2 retries, traffic split ratings/v1 90%, ratings/v2 10%, circuit breaker max 5 connections",
+			},
+		},
+		{
+			// No route sends traffic to cart, so only the mesh-wide rule applies
+			destination: "cart",
+			want: EdgePolicy{
+				CircuitBreaker: &CircuitBreaker{MaxConnections: 100},
+				Resources:      []string{"DestinationRule/istio-system/mesh-default"},
+				Summary:        "frontend→cart: circuit breaker max 100 connections",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			if got := policies[tt.destination]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("edge policy = %s, want %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestHostSpecificity(t *testing.T) {
+	hosts := []string{"ratings.shop.svc.cluster.local"}
+	tests := []struct {
+		istioHost string
+		namespace string
+		match     bool
+	}{
+		{"ratings", "shop", true},
+		{"ratings", "other", false},
+		{"ratings.shop.svc.cluster.local", "other", true},
+		{"*.shop.svc.cluster.local", "shop", true},
+		{"*.other.svc.cluster.local", "shop", false},
+		{"*", "shop", false},
+	}
+	for _, tt := range tests {
+		if got := hostSpecificity([]string{tt.istioHost}, tt.namespace, hosts) > 0; got != tt.match {
+			t.Errorf("hostSpecificity(%s in %s) matched = %v, want %v", tt.istioHost, tt.namespace, got, tt.match)
+		}
+	}
+
+	exact := hostSpecificity([]string{"ratings"}, "shop", hosts)
+	narrow := hostSpecificity([]string{"*.shop.svc.cluster.local"}, "shop", hosts)
+	wide := hostSpecificity([]string{"*.svc.cluster.local"}, "shop", hosts)
+	if !(exact > narrow && narrow > wide) {
+		t.Errorf("hostSpecificity() ranks exact %d, narrow wildcard %d, wide wildcard %d", exact, narrow, wide)
+	}
+}
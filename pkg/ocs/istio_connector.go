@@ -1,35 +1,41 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ConnectorIstio identifies topology collected by the IstioConnector
+const ConnectorIstio = "istio"
+
+// unknownLabelValue is what Istio reports for workloads it cannot identify, such as hosts outside the mesh
+const unknownLabelValue = "unknown"
+
 // IstioConnector handles Istio metrics queries via Prometheus
 type IstioConnector struct {
-	prometheusURL string
-	httpClient    *http.Client
+	prometheus *PrometheusClient
+
+	// The last query result is kept so the discovery calls of one collection share one query
+	mu         sync.Mutex
+	lastKey    string
+	lastResult *PrometheusQueryResult
 }
 
-// NewIstioConnector creates a new Istio connector
-func NewIstioConnector(prometheusURL string) *IstioConnector {
+// NewIstioConnector creates a new Istio connector for the named Prometheus instance
+func NewIstioConnector(prometheusName, prometheusURL string) *IstioConnector {
 	return &IstioConnector{
-		prometheusURL: prometheusURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		prometheus: NewPrometheusClient(prometheusName, prometheusURL),
 	}
 }
 
 // QueryMetrics queries Prometheus for istio_requests_total filtered by source workload
 // If fromTimestamp and toTimestamp are provided, uses range query, otherwise uses instant query
-func (ic *IstioConnector) QueryMetrics(sourceWorkloads []string, fromTimestamp, toTimestamp *time.Time) (*PrometheusQueryResult, error) {
+func (ic *IstioConnector) QueryMetrics(ctx context.Context, sourceWorkloads []string, fromTimestamp, toTimestamp *time.Time) (*PrometheusQueryResult, error) {
 	if len(sourceWorkloads) == 0 {
 		return nil, fmt.Errorf("no source workloads provided")
 	}
@@ -38,125 +44,85 @@ func (ic *IstioConnector) QueryMetrics(sourceWorkloads []string, fromTimestamp,
 	workloadFilter := strings.Join(sourceWorkloads, "|")
 	query := fmt.Sprintf(`istio_requests_total{source_workload=~"%s"}`, workloadFilter)
 
-	if fromTimestamp != nil && toTimestamp != nil {
-		return ic.queryRange(query, fromTimestamp, toTimestamp)
-	}
-	return ic.queryInstant(query)
+	return ic.prometheus.Query(ctx, query, fromTimestamp, toTimestamp)
 }
 
-// queryRange executes a Prometheus range query
-func (ic *IstioConnector) queryRange(query string, fromTimestamp, toTimestamp *time.Time) (*PrometheusQueryResult, error) {
-	start := fromTimestamp.Unix()
-	end := toTimestamp.Unix()
-	step := "15s" // Default step, can be made configurable
-
-	queryURL := fmt.Sprintf("%s/api/v1/query_range?query=%s&start=%d&end=%d&step=%s",
-		ic.prometheusURL, url.QueryEscape(query), start, end, step)
-	log.Printf("Querying Prometheus (range): %s from %s to %s", query, fromTimestamp.Format(time.RFC3339), toTimestamp.Format(time.RFC3339))
+// Name returns the provider name recorded on the facts this connector contributes
+func (ic *IstioConnector) Name() string {
+	return ConnectorIstio
+}
 
-	req, err := http.NewRequest("GET", queryURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+// Instance returns the name of the Prometheus instance the connector queries
+func (ic *IstioConnector) Instance() string {
+	return ic.prometheus.name
+}
 
-	resp, err := ic.httpClient.Do(req)
+// DiscoverEntities returns the workloads, external hosts and services seen in istio_requests_total
+func (ic *IstioConnector) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	result, err := ic.collect(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Prometheus returned status %d: %s", resp.StatusCode, string(body))
+	var entities []Entity
+	for workload, origin := range ExtractWorkloadOrigins(result) {
+		entities = append(entities, Entity{
+			Name:      workload,
+			Type:      ResourceTypeWorkload,
+			Namespace: origin.Namespace,
+			Cluster:   origin.Cluster,
+		})
 	}
-
-	var rangeResult PrometheusQueryRangeResult
-	if err := json.NewDecoder(resp.Body).Decode(&rangeResult); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	for _, host := range ExtractExternalHosts(result) {
+		entities = append(entities, Entity{Name: host, Type: ResourceTypeExternalHost})
 	}
-
-	if rangeResult.Status != "success" {
-		return nil, fmt.Errorf("Prometheus query failed with status: %s", rangeResult.Status)
+	for service, workloads := range ExtractServices(result) {
+		entities = append(entities, Entity{Name: service, Type: ResourceTypeService, Members: workloads})
 	}
-
-	// Convert range result to instant query result format
-	return ic.convertRangeToInstantResult(&rangeResult), nil
+	return entities, nil
 }
 
-// queryInstant executes a Prometheus instant query
-func (ic *IstioConnector) queryInstant(query string) (*PrometheusQueryResult, error) {
-	queryURL := fmt.Sprintf("%s/api/v1/query?query=%s", ic.prometheusURL, url.QueryEscape(query))
-	log.Printf("Querying Prometheus (instant): %s", query)
-
-	req, err := http.NewRequest("GET", queryURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := ic.httpClient.Do(req)
+// DiscoverRelationships returns the observed source -> destination edges with their request volume
+func (ic *IstioConnector) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	result, err := ic.collect(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Prometheus returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result PrometheusQueryResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if result.Status != "success" {
-		return nil, fmt.Errorf("Prometheus query failed with status: %s", result.Status)
+	edgeTraffic := ExtractEdgeTraffic(result)
+	var relationships []Relationship
+	for source, destinations := range ExtractAdjacencyList(result) {
+		for _, destination := range destinations {
+			relationship := Relationship{Source: source, Destination: destination}
+			if traffic, ok := edgeTraffic[source][destination]; ok {
+				relationship.Traffic = &traffic
+			}
+			relationships = append(relationships, relationship)
+		}
 	}
-
-	log.Printf("Retrieved %d results from Prometheus", len(result.Data.Result))
-	return &result, nil
+	return relationships, nil
 }
 
-// convertRangeToInstantResult converts a range query result to instant query format
-// by extracting unique source-destination pairs from all time series values
-func (ic *IstioConnector) convertRangeToInstantResult(rangeResult *PrometheusQueryRangeResult) *PrometheusQueryResult {
-	instantResult := &PrometheusQueryResult{
-		Status: rangeResult.Status,
-	}
+// FetchMetrics returns no samples: Istio request volume is already reported as edge traffic
+func (ic *IstioConnector) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	return nil, nil
+}
 
-	// Use a map to track unique metric combinations
-	uniqueMetrics := make(map[string]struct {
-		Metric map[string]string
-		Seen   bool
-	})
+// collect runs QueryMetrics once per collection request and reuses the result for later calls
+func (ic *IstioConnector) collect(ctx context.Context, req CollectionRequest) (*PrometheusQueryResult, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
 
-	for _, r := range rangeResult.Data.Result {
-		// Create a key from the metric labels (excluding timestamp values)
-		metricKey := fmt.Sprintf("%v", r.Metric)
-		if _, exists := uniqueMetrics[metricKey]; !exists {
-			uniqueMetrics[metricKey] = struct {
-				Metric map[string]string
-				Seen   bool
-			}{
-				Metric: r.Metric,
-				Seen:   true,
-			}
-		}
+	key := req.key()
+	if ic.lastResult != nil && ic.lastKey == key {
+		return ic.lastResult, nil
 	}
-
-	// Convert to result format
-	for _, v := range uniqueMetrics {
-		instantResult.Data.Result = append(instantResult.Data.Result, struct {
-			Metric map[string]string `json:"metric"`
-			Value  []interface{}      `json:"value"`
-		}{
-			Metric: v.Metric,
-			Value:  []interface{}{time.Now().Unix(), "1"}, // Dummy value for compatibility
-		})
+	result, err := ic.QueryMetrics(ctx, req.Workloads, req.From, req.To)
+	if err != nil {
+		return nil, err
 	}
-
-	log.Printf("Retrieved %d unique metrics from Prometheus range query", len(instantResult.Data.Result))
-	return instantResult
+	ic.lastKey, ic.lastResult = key, result
+	return result, nil
 }
 
 // ExtractAdjacencyList extracts source and destination workloads from Prometheus results
@@ -165,7 +131,7 @@ func ExtractAdjacencyList(result *PrometheusQueryResult) map[string][]string {
 
 	for _, r := range result.Data.Result {
 		source := r.Metric["source_workload"]
-		destination := r.Metric["destination_workload"]
+		destination := destinationNode(r.Metric)
 
 		if source != "" && destination != "" {
 			if adjacencyList[source] == nil {
@@ -191,3 +157,114 @@ func ExtractAdjacencyList(result *PrometheusQueryResult) map[string][]string {
 	return adjacencyList
 }
 
+// ExtractEdgeTraffic extracts the observed request volume for each source-destination pair
+// from Prometheus results. Series without a parseable value are skipped.
+func ExtractEdgeTraffic(result *PrometheusQueryResult) map[string]map[string]float64 {
+	edgeTraffic := make(map[string]map[string]float64)
+
+	for _, r := range result.Data.Result {
+		source := r.Metric["source_workload"]
+		destination := destinationNode(r.Metric)
+		if source == "" || destination == "" {
+			continue
+		}
+
+		value, ok := sampleValue(r.Value)
+		if !ok {
+			continue
+		}
+
+		if edgeTraffic[source] == nil {
+			edgeTraffic[source] = make(map[string]float64)
+		}
+		edgeTraffic[source][destination] += value
+	}
+
+	return edgeTraffic
+}
+
+// ExtractWorkloadOrigins extracts the namespace and cluster of each workload from the
+// source_* and destination_* labels of Prometheus results
+func ExtractWorkloadOrigins(result *PrometheusQueryResult) map[string]WorkloadOrigin {
+	origins := make(map[string]WorkloadOrigin)
+
+	record := func(workload, namespace, cluster string) {
+		if workload == "" || workload == unknownLabelValue || (namespace == "" && cluster == "") {
+			return
+		}
+		origin := origins[workload]
+		if origin.Namespace == "" {
+			origin.Namespace = namespace
+		}
+		if origin.Cluster == "" {
+			origin.Cluster = cluster
+		}
+		origins[workload] = origin
+	}
+
+	for _, r := range result.Data.Result {
+		record(r.Metric["source_workload"], r.Metric["source_workload_namespace"], r.Metric["source_cluster"])
+		record(r.Metric["destination_workload"], r.Metric["destination_workload_namespace"], r.Metric["destination_cluster"])
+	}
+
+	return origins
+}
+
+// ExtractServices maps each in-mesh destination service to the workloads backing it
+func ExtractServices(result *PrometheusQueryResult) map[string][]string {
+	services := make(map[string][]string)
+
+	for _, r := range result.Data.Result {
+		service := r.Metric["destination_service"]
+		workload := r.Metric["destination_workload"]
+		if service == "" || workload == "" || workload == unknownLabelValue {
+			continue
+		}
+
+		exists := false
+		for _, existing := range services[service] {
+			if existing == workload {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			services[service] = append(services[service], workload)
+		}
+	}
+
+	return services
+}
+
+// ExtractExternalHosts returns the sorted destination services that point outside the mesh
+func ExtractExternalHosts(result *PrometheusQueryResult) []string {
+	hostSet := make(map[string]bool)
+	for _, r := range result.Data.Result {
+		if isExternalDestination(r.Metric) {
+			hostSet[r.Metric["destination_service"]] = true
+		}
+	}
+
+	hosts := make([]string, 0, len(hostSet))
+	for host := range hostSet {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// destinationNode returns the graph node a series points at: the destination workload, or the
+// destination service for hosts outside the mesh
+func destinationNode(metric map[string]string) string {
+	if isExternalDestination(metric) {
+		return metric["destination_service"]
+	}
+	return metric["destination_workload"]
+}
+
+// isExternalDestination reports whether a series points at a host outside the mesh, which
+// Istio reports with an unknown destination workload
+func isExternalDestination(metric map[string]string) bool {
+	workload := metric["destination_workload"]
+	return (workload == "" || workload == unknownLabelValue) && metric["destination_service"] != ""
+}
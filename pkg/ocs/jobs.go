@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of collection job
+const (
+	JobKindCollection = "collection"
+	JobKindBackfill   = "backfill"
+)
+
+// Collection job and provider states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// maxJobHistory is how many finished jobs are kept. Older ones are forgotten.
+const maxJobHistory = 100
+
+// maxPendingJobs is how many jobs may be queued or running at once
+const maxPendingJobs = 100
+
+// errTooManyJobs is returned when maxPendingJobs jobs are queued or running
+var errTooManyJobs = errors.New("too many collection jobs are pending")
+
+// jobManager runs collection jobs in the background and keeps their status in memory
+type jobManager struct {
+	mu       sync.Mutex
+	jobs     map[string]*collectionJob
+	finished []string // IDs of finished jobs, oldest first
+	pending  int
+}
+
+// collectionJob is a job's status along with the means to cancel it
+type collectionJob struct {
+	status CollectionJob
+	cancel context.CancelFunc
+}
+
+// newJobManager creates a job manager with no jobs
+func newJobManager() *jobManager {
+	return &jobManager{jobs: make(map[string]*collectionJob)}
+}
+
+// jobFunc runs a job until it finishes or ctx is cancelled. It returns the ID of the snapshot it
+// saved, if it saved a single one, and whether it shared another collection's result.
+type jobFunc func(ctx context.Context) (documentID string, shared bool, err error)
+
+// start registers a queued job and runs it in the background
+func (m *jobManager) start(job CollectionJob, run jobFunc) (CollectionJob, error) {
+	m.mu.Lock()
+	if m.pending >= maxPendingJobs {
+		m.mu.Unlock()
+		return CollectionJob{}, errTooManyJobs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.jobs[job.ID] = &collectionJob{status: job.copy(), cancel: cancel}
+	m.pending++
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		documentID, shared, err := runJob(ctx, run)
+		m.finish(job.ID, documentID, shared, err)
+	}()
+	return job, nil
+}
+
+// runJob runs a job, turning a panic into an error so it fails the job rather than the server
+func runJob(ctx context.Context, run jobFunc) (documentID string, shared bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collection panicked: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+// update changes a job's status
+func (m *jobManager) update(id string, change func(job *CollectionJob)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		change(&job.status)
+	}
+}
+
+// markRunning records that a job has started, unless it already has
+func (m *jobManager) markRunning(id string) {
+	m.update(id, func(job *CollectionJob) {
+		if job.StartedAt == nil {
+			now := time.Now()
+			job.Status, job.StartedAt = JobRunning, &now
+		}
+	})
+}
+
+// finish records a job's outcome and forgets the oldest finished jobs beyond maxJobHistory
+func (m *jobManager) finish(id string, documentID string, shared bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := &m.jobs[id].status
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Shared = shared
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Status, job.Error = JobCancelled, "cancelled"
+	case err != nil:
+		job.Status, job.Error = JobFailed, err.Error()
+		log.Printf("Collection job %s failed: %v", id, err)
+	default:
+		job.Status = JobSucceeded
+		job.DocumentID = documentID
+	}
+	// Settle providers that did not report their last chunk, including all of a shared job's
+	for i := range job.Progress.Providers {
+		provider := &job.Progress.Providers[i]
+		switch {
+		case job.Status == JobSucceeded:
+			job.Progress.ChunksDone += provider.ChunksTotal - provider.ChunksDone
+			provider.ChunksDone, provider.Status = provider.ChunksTotal, JobSucceeded
+		case provider.Status == JobRunning && job.Status == JobFailed:
+			provider.Status, provider.Error = JobFailed, job.Error
+		case provider.Status == JobRunning || provider.Status == JobQueued:
+			provider.Status = JobCancelled
+		}
+	}
+
+	m.pending--
+	m.finished = append(m.finished, id)
+	if len(m.finished) > maxJobHistory {
+		delete(m.jobs, m.finished[0])
+		m.finished = m.finished[1:]
+	}
+}
+
+// get returns a copy of a job's status
+func (m *jobManager) get(id string) (CollectionJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return CollectionJob{}, false
+	}
+	return job.status.copy(), true
+}
+
+// list returns copies of every job's status, newest first
+func (m *jobManager) list() []CollectionJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]CollectionJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.status.copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// cancel asks a queued or running job to stop, returning false if it does not exist. A running
+// job stops once the query in progress returns.
+func (m *jobManager) cancel(id string) (CollectionJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return CollectionJob{}, false
+	}
+	job.cancel()
+	return job.status.copy(), true
+}
+
+// runningBackfill returns the ID of the queued or running job of a backfill, if there is one
+func (m *jobManager) runningBackfill(backfillID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		if job.status.BackfillID == backfillID && job.status.FinishedAt == nil {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// copy returns a copy of the job that does not share its progress
+func (j CollectionJob) copy() CollectionJob {
+	j.Progress.Providers = append([]ProviderProgress(nil), j.Progress.Providers...)
+	return j
+}
+
+// newCollectionJob describes a queued job of a profile started by a request
+func newCollectionJob(c *gin.Context, cfg *ActiveConfig, kind string, fromTimestamp, toTimestamp *time.Time) CollectionJob {
+	job := CollectionJob{
+		ID:            primitive.NewObjectID().Hex(),
+		Kind:          kind,
+		Profile:       cfg.profile,
+		Status:        JobQueued,
+		Principal:     anonymousPrincipal.Name,
+		FromTimestamp: fromTimestamp,
+		ToTimestamp:   toTimestamp,
+		CreatedAt:     time.Now(),
+	}
+	if principal, ok := c.Get(principalContextKey); ok {
+		job.Principal = principal.(*Principal).Name
+	}
+	return job
+}
+
+// startCollectionJob queues a collection of a profile and responds with the job
+func (s *Server) startCollectionJob(c *gin.Context, cfg *ActiveConfig, key string, fromTimestamp, toTimestamp *time.Time) {
+	req := CollectionRequest{Workloads: cfg.ocsConfig.Workload, From: fromTimestamp, To: toTimestamp}
+	job := newCollectionJob(c, cfg, JobKindCollection, fromTimestamp, toTimestamp)
+	for _, provider := range cfg.providers {
+		chunks := len(providerChunks(provider, req))
+		job.Progress.ChunksTotal += chunks
+		job.Progress.Providers = append(job.Progress.Providers, ProviderProgress{
+			Provider:    provider.Name(),
+			Instance:    provider.Instance(),
+			Status:      JobQueued,
+			ChunksTotal: chunks,
+		})
+	}
+
+	id, limits, query := job.ID, cfg.config.CollectionLimits, snapshotQuery(c, cfg)
+	job, err := s.jobs.start(job, func(ctx context.Context) (string, bool, error) {
+		result, shared, err := s.collectionLimiter.do(ctx, key, limits, true, func() (*collectionResult, error) {
+			s.jobs.markRunning(id)
+			return s.collect(ctx, cfg, query, fromTimestamp, toTimestamp, func(provider, done, total int) {
+				s.jobs.update(id, func(job *CollectionJob) {
+					progress := &job.Progress.Providers[provider]
+					job.Progress.ChunksDone += done - progress.ChunksDone
+					progress.ChunksDone, progress.ChunksTotal, progress.Status = done, total, JobRunning
+					if done == total {
+						progress.Status = JobSucceeded
+					}
+				})
+			})
+		})
+		if shared {
+			// The job waited for another job's collection, so it never ran its own
+			s.jobs.markRunning(id)
+		}
+		if err != nil {
+			return "", shared, err
+		}
+		return result.docID.Hex(), shared, nil
+	})
+	if err != nil {
+		respondTooManyJobs(c)
+		return
+	}
+
+	c.Header("Location", "/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "accepted",
+		"message": "Collection job started",
+		"job":     job,
+	})
+}
+
+// respondTooManyJobs turns a job away because maxPendingJobs jobs are queued or running
+func respondTooManyJobs(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(collectionBusyRetryAfter)))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"status":  "error",
+		"message": fmt.Sprintf("Too many collection jobs are pending (%d)", maxPendingJobs),
+	})
+}
+
+// listJobsHandler handles the jobs endpoint
+func (s *Server) listJobsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"jobs":   s.jobs.list(),
+	})
+}
+
+// getJobHandler handles the jobs/:id endpoint
+func (s *Server) getJobHandler(c *gin.Context) {
+	job, ok := s.jobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Unknown job %s", c.Param("id")),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"job":    job,
+	})
+}
+
+// cancelJobHandler handles the jobs/:id/cancel endpoint
+func (s *Server) cancelJobHandler(c *gin.Context) {
+	job, ok := s.jobs.cancel(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Unknown job %s", c.Param("id")),
+		})
+		return
+	}
+	if job.FinishedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Job %s has already %s", job.ID, job.Status),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "accepted",
+		"message": "Cancellation requested",
+		"job":     job,
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitForJob waits for a job to finish and returns its status
+func waitForJob(t *testing.T, jobs *jobManager, id string) CollectionJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := jobs.get(id); ok && job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return CollectionJob{}
+}
+
+// cancelTestJob requests the cancellation of a job through the jobs/:id/cancel endpoint
+func cancelTestJob(t *testing.T, jobs *jobManager, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := &Server{jobs: jobs}
+	router := gin.New()
+	router.POST("/jobs/:id/cancel", server.cancelJobHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/cancel", nil))
+	return w
+}
+
+func TestJobManagerStart(t *testing.T) {
+	jobs := newJobManager()
+	job, err := jobs.start(CollectionJob{ID: "ok", Status: JobQueued, Progress: JobProgress{
+		ChunksTotal: 2,
+		Providers:   []ProviderProgress{{Provider: ConnectorIstio, Status: JobQueued, ChunksTotal: 2}},
+	}}, func(ctx context.Context) (string, bool, error) {
+		return "doc", true, nil
+	})
+	if err != nil || job.ID != "ok" {
+		t.Fatalf("start() = %+v, %v", job, err)
+	}
+	got := waitForJob(t, jobs, "ok")
+	if got.Status != JobSucceeded || got.DocumentID != "doc" || !got.Shared {
+		t.Errorf("finished job = %+v, want a shared success saving doc", got)
+	}
+	// A successful job's providers are settled even if they did not report their last chunk
+	if got.Progress.ChunksDone != 2 || got.Progress.Providers[0].Status != JobSucceeded {
+		t.Errorf("finished job progress = %+v, want every chunk done", got.Progress)
+	}
+	if jobs.pending != 0 {
+		t.Errorf("job manager has %d pending jobs, want 0", jobs.pending)
+	}
+}
+
+func TestJobManagerStartRejectsTooManyJobs(t *testing.T) {
+	jobs := newJobManager()
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < maxPendingJobs; i++ {
+		if _, err := jobs.start(CollectionJob{ID: fmt.Sprint(i)}, func(ctx context.Context) (string, bool, error) {
+			<-release
+			return "", false, nil
+		}); err != nil {
+			t.Fatalf("start() of job %d error = %v", i, err)
+		}
+	}
+	if _, err := jobs.start(CollectionJob{ID: "over"}, nil); !errors.Is(err, errTooManyJobs) {
+		t.Errorf("start() over the limit error = %v, want errTooManyJobs", err)
+	}
+	if _, ok := jobs.get("over"); ok {
+		t.Error("a rejected job was registered")
+	}
+}
+
+func TestJobManagerFinishForgetsOldestJobs(t *testing.T) {
+	jobs := newJobManager()
+	for i := 0; i <= maxJobHistory; i++ {
+		id := fmt.Sprint(i)
+		jobs.jobs[id] = &collectionJob{status: CollectionJob{ID: id, Status: JobRunning}, cancel: func() {}}
+		jobs.pending++
+		jobs.finish(id, "", false, nil)
+	}
+	if _, ok := jobs.get("0"); ok {
+		t.Error("the oldest finished job is still kept")
+	}
+	if _, ok := jobs.get(fmt.Sprint(maxJobHistory)); !ok {
+		t.Error("the newest finished job was forgotten")
+	}
+	if len(jobs.jobs) != maxJobHistory || len(jobs.finished) != maxJobHistory {
+		t.Errorf("job manager keeps %d jobs and %d finished IDs, want %d", len(jobs.jobs), len(jobs.finished), maxJobHistory)
+	}
+}
+
+func TestJobManagerRecoversPanics(t *testing.T) {
+	jobs := newJobManager()
+	if _, err := jobs.start(CollectionJob{ID: "panics"}, func(ctx context.Context) (string, bool, error) {
+		panic("boom")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitForJob(t, jobs, "panics"); got.Status != JobFailed || got.Error != "collection panicked: boom" {
+		t.Errorf("panicking job = %s, %q, want failed with the panic", got.Status, got.Error)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	jobs := newJobManager()
+	limiter := newCollectionLimiter()
+	limits := CollectionLimitsConfig{MaxConcurrent: 1}
+
+	// A running job holds the only collection slot until it is cancelled
+	if _, err := jobs.start(CollectionJob{ID: "running", Status: JobQueued, Progress: JobProgress{
+		Providers: []ProviderProgress{{Provider: ConnectorIstio, Status: JobQueued}},
+	}}, func(ctx context.Context) (string, bool, error) {
+		_, shared, err := limiter.do(ctx, "a", limits, true, func() (*collectionResult, error) {
+			jobs.markRunning("running")
+			jobs.update("running", func(job *CollectionJob) { job.Progress.Providers[0].Status = JobRunning })
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		return "", shared, err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if job, _ := jobs.get("running"); job.StartedAt != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A queued job waits for the slot
+	if _, err := jobs.start(CollectionJob{ID: "queued", Status: JobQueued}, func(ctx context.Context) (string, bool, error) {
+		_, shared, err := limiter.do(ctx, "b", limits, true, func() (*collectionResult, error) {
+			t.Error("cancelled queued job ran its collection")
+			return nil, nil
+		})
+		return "", shared, err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"queued", "running"} {
+		if w := cancelTestJob(t, jobs, id); w.Code != http.StatusAccepted {
+			t.Errorf("cancel of %s job status = %d, want 202: %s", id, w.Code, w.Body.String())
+		}
+		got := waitForJob(t, jobs, id)
+		if got.Status != JobCancelled {
+			t.Errorf("%s job status = %s, want cancelled", id, got.Status)
+		}
+		if (got.StartedAt != nil) != (id == "running") {
+			t.Errorf("%s job started_at = %v", id, got.StartedAt)
+		}
+		if id == "running" && got.Progress.Providers[0].Status != JobCancelled {
+			t.Errorf("running job provider status = %s, want cancelled", got.Progress.Providers[0].Status)
+		}
+	}
+
+	// Finished jobs cannot be cancelled, and unknown ones are not found
+	if w := cancelTestJob(t, jobs, "running"); w.Code != http.StatusConflict {
+		t.Errorf("cancel of a finished job status = %d, want 409", w.Code)
+	}
+	if w := cancelTestJob(t, jobs, "unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("cancel of an unknown job status = %d, want 404", w.Code)
+	}
+}
+
+func TestJobManagerMarkRunning(t *testing.T) {
+	jobs := newJobManager()
+	jobs.jobs["job"] = &collectionJob{status: CollectionJob{ID: "job", Status: JobQueued}, cancel: func() {}}
+
+	jobs.markRunning("job")
+	first, _ := jobs.get("job")
+	if first.Status != JobRunning || first.StartedAt == nil {
+		t.Fatalf("job after markRunning() = %+v, want running with started_at", first)
+	}
+	// A job sharing a collection it already started keeps its start time
+	jobs.markRunning("job")
+	if again, _ := jobs.get("job"); !again.StartedAt.Equal(*first.StartedAt) {
+		t.Errorf("markRunning() moved started_at from %v to %v", first.StartedAt, again.StartedAt)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtClockSkew is how far exp and nbf may be off before a token is rejected
+const jwtClockSkew = time.Minute
+
+// defaultScopesClaim is the claim holding a token's scopes when jwt.scopes_claim is unset
+const defaultScopesClaim = "scope"
+
+// jwtVerifier validates RS256 bearer tokens against the keys of a JWKS file
+type jwtVerifier struct {
+	keys        map[string]*rsa.PublicKey // by kid
+	issuer      string
+	audience    string
+	scopesClaim string
+}
+
+// jsonWebKey is the subset of a JWK needed for RSA signature verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// newJWTVerifier loads the RSA signing keys of a JWKS file
+func newJWTVerifier(config JWTConfig) (*jwtVerifier, error) {
+	data, err := os.ReadFile(config.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS %s: %w", config.JWKSFile, err)
+	}
+
+	verifier := &jwtVerifier{
+		keys:        make(map[string]*rsa.PublicKey),
+		issuer:      config.Issuer,
+		audience:    config.Audience,
+		scopesClaim: config.ScopesClaim,
+	}
+	if verifier.scopesClaim == "" {
+		verifier.scopesClaim = defaultScopesClaim
+	}
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != "RS256") {
+			continue
+		}
+		publicKey, err := key.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS %s: %w", key.Kid, config.JWKSFile, err)
+		}
+		verifier.keys[key.Kid] = publicKey
+	}
+	if len(verifier.keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no RS256 signing keys", config.JWKSFile)
+	}
+	return verifier, nil
+}
+
+// rsaPublicKey decodes the key's base64url modulus and exponent
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// verify checks a compact JWS token's signature and claims, and returns the principal it identifies
+func (v *jwtVerifier) verify(token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+	key, ok := v.keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(jwtClockSkew)) {
+		return nil, fmt.Errorf("token expired or has no exp claim")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token not yet valid")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, fmt.Errorf("unexpected token issuer")
+	}
+	if v.audience != "" && !containsString(claimStrings(claims["aud"]), v.audience) {
+		return nil, fmt.Errorf("unexpected token audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no sub claim")
+	}
+	return &Principal{Name: subject, Method: AuthMethodJWT, Scopes: claimStrings(claims[v.scopesClaim])}, nil
+}
+
+// decodeJWTSegment decodes a base64url JSON segment of a token
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// claimStrings reads a claim that is either a space-separated string or a list of strings
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
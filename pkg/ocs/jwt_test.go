@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJWTKey signs the tokens of the JWT tests
+func testJWTKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testJWTVerifier writes a JWKS holding key as kid test-key and loads a verifier from it
+func testJWTVerifier(t *testing.T, key *rsa.PrivateKey, config JWTConfig) *jwtVerifier {
+	t.Helper()
+	jwks := map[string]interface{}{"keys": []jsonWebKey{{
+		Kty: "RSA",
+		Kid: "test-key",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	config.JWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(config.JWKSFile, []byte(mustJSON(t, jwks)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := newJWTVerifier(config)
+	if err != nil {
+		t.Fatalf("newJWTVerifier() error = %v", err)
+	}
+	return verifier
+}
+
+// signTestJWT returns a compact RS256 token with the given header and claims
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	t.Helper()
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(mustJSON(t, header))) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(mustJSON(t, claims)))
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifierVerify(t *testing.T) {
+	key, otherKey := testJWTKey(t), testJWTKey(t)
+	verifier := testJWTVerifier(t, key, JWTConfig{Issuer: "https://idp.example.com/", Audience: "ocs"})
+	now := time.Unix(1700000000, 0)
+
+	header := map[string]interface{}{"alg": "RS256", "kid": "test-key"}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "collector",
+			"iss":   "https://idp.example.com/",
+			"aud":   []string{"other", "ocs"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "read collect",
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "valid", token: signTestJWT(t, key, header, validClaims())},
+		{name: "expired within clock skew", token: signTestJWT(t, key, header, with("exp", now.Add(-30*time.Second).Unix()))},
+		{name: "expired", token: signTestJWT(t, key, header, with("exp", now.Add(-2*time.Minute).Unix())), wantErr: "token expired"},
+		{name: "no exp", token: signTestJWT(t, key, header, with("exp", nil)), wantErr: "token expired or has no exp claim"},
+		{name: "not yet valid", token: signTestJWT(t, key, header, with("nbf", now.Add(time.Hour).Unix())), wantErr: "token not yet valid"},
+		{name: "wrong issuer", token: signTestJWT(t, key, header, with("iss", "https://evil.example.com/")), wantErr: "unexpected token issuer"},
+		{name: "wrong audience", token: signTestJWT(t, key, header, with("aud", "other")), wantErr: "unexpected token audience"},
+		{name: "no subject", token: signTestJWT(t, key, header, with("sub", nil)), wantErr: "token has no sub claim"},
+		{name: "signed by another key", token: signTestJWT(t, otherKey, header, validClaims()), wantErr: "invalid token signature"},
+		{name: "unknown kid", token: signTestJWT(t, key, map[string]interface{}{"alg": "RS256", "kid": "rotated"}, validClaims()), wantErr: `unknown signing key "rotated"`},
+		{name: "alg none", token: signTestJWT(t, key, map[string]interface{}{"alg": "none", "kid": "test-key"}, validClaims()), wantErr: `unsupported token algorithm "none"`},
+		{name: "malformed", token: "not-a-token", wantErr: "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.verify(tt.token, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			want := &Principal{Name: "collector", Method: AuthMethodJWT, Scopes: []string{ScopeRead, ScopeCollect}}
+			if !reflect.DeepEqual(principal, want) {
+				t.Errorf("verify() = %+v, want %+v", principal, want)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierTamperedClaims(t *testing.T) {
+	key := testJWTKey(t)
+	verifier := testJWTVerifier(t, key, JWTConfig{ScopesClaim: "roles"})
+	now := time.Unix(1700000000, 0)
+
+	token := signTestJWT(t, key, map[string]interface{}{"alg": "RS256", "kid": "test-key"},
+		map[string]interface{}{"sub": "dashboards", "exp": now.Add(time.Hour).Unix(), "roles": []string{ScopeRead}})
+	principal, err := verifier.verify(token, now)
+	if err != nil {
+		t.Fatalf("verify() error = %v", err)
+	}
+	if !reflect.DeepEqual(principal.Scopes, []string{ScopeRead}) {
+		t.Errorf("verify() scopes = %v, want the roles claim [read]", principal.Scopes)
+	}
+
+	// Swapping in claims with more scopes must break the signature
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(mustJSON(t, map[string]interface{}{
+		"sub": "dashboards", "exp": now.Add(time.Hour).Unix(), "roles": []string{ScopeAdmin},
+	})))
+	if _, err := verifier.verify(strings.Join(parts, "."), now); err == nil || err.Error() != "invalid token signature" {
+		t.Errorf("verify() of tampered claims error = %v, want invalid token signature", err)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConnectorKubernetes identifies facts read from the Kubernetes API
+const ConnectorKubernetes = "kubernetes"
+
+// In-cluster service account credentials
+const (
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ignoredAnnotations are dropped from workload metadata because they add bulk without context
+var ignoredAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+	"deployment.kubernetes.io/revision":                true,
+}
+
+// KubernetesConnector reads workload metadata from the Kubernetes API
+type KubernetesConnector struct {
+	serverURL  string
+	token      string
+	namespaces []string
+	httpClient *http.Client
+}
+
+// NewKubernetesConnector creates a Kubernetes connector from a kubeconfig file, or from the
+// in-cluster service account if no kubeconfig is configured
+func NewKubernetesConnector(config KubernetesConfig) (*KubernetesConnector, error) {
+	tlsConfig := &tls.Config{}
+	connector := &KubernetesConnector{namespaces: config.Namespaces}
+
+	if config.Kubeconfig != "" {
+		if err := connector.loadKubeconfig(config.Kubeconfig, config.Context, tlsConfig); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := connector.loadInCluster(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	connector.httpClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return connector, nil
+}
+
+// loadKubeconfig reads the server, CA and credentials of a kubeconfig context
+func (kc *KubernetesConnector) loadKubeconfig(path, contextName string, tlsConfig *tls.Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	var clusterName, userName string
+	found := false
+	for _, ctx := range config.Contexts {
+		if ctx.Name == contextName {
+			clusterName, userName = ctx.Context.Cluster, ctx.Context.User
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+
+	found = false
+	for _, cluster := range config.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		found = true
+		kc.serverURL = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		caData, err := readInlineOrFile(cluster.Cluster.CertificateAuthorityData, cluster.Cluster.CertificateAuthority)
+		if err != nil {
+			return fmt.Errorf("failed to read cluster CA: %w", err)
+		}
+		if len(caData) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return fmt.Errorf("cluster CA for %q contains no certificates", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		break
+	}
+	if !found {
+		return fmt.Errorf("cluster %q not found in kubeconfig", clusterName)
+	}
+
+	for _, user := range config.Users {
+		if user.Name != userName {
+			continue
+		}
+		kc.token = user.User.Token
+		if kc.token == "" && user.User.TokenFile != "" {
+			token, err := os.ReadFile(user.User.TokenFile)
+			if err != nil {
+				return fmt.Errorf("failed to read token file: %w", err)
+			}
+			kc.token = strings.TrimSpace(string(token))
+		}
+
+		certData, err := readInlineOrFile(user.User.ClientCertificateData, user.User.ClientCertificate)
+		if err != nil {
+			return fmt.Errorf("failed to read client certificate: %w", err)
+		}
+		keyData, err := readInlineOrFile(user.User.ClientKeyData, user.User.ClientKey)
+		if err != nil {
+			return fmt.Errorf("failed to read client key: %w", err)
+		}
+		if len(certData) > 0 && len(keyData) > 0 {
+			cert, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		break
+	}
+
+	log.Printf("Using Kubernetes API %s from kubeconfig context %s", kc.serverURL, contextName)
+	return nil
+}
+
+// loadInCluster reads the API server address and service account credentials of the current pod
+func (kc *KubernetesConnector) loadInCluster(tlsConfig *tls.Config) error {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return fmt.Errorf("no kubeconfig configured and not running inside a Kubernetes cluster")
+	}
+	kc.serverURL = "https://" + net.JoinHostPort(host, port)
+
+	token, err := os.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return fmt.Errorf("failed to read service account token: %w", err)
+	}
+	kc.token = strings.TrimSpace(string(token))
+
+	caData, err := os.ReadFile(serviceAccountCAPath)
+	if err != nil {
+		return fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caData)
+	tlsConfig.RootCAs = pool
+
+	log.Printf("Using in-cluster Kubernetes API %s", kc.serverURL)
+	return nil
+}
+
+// readInlineOrFile returns base64-decoded inline kubeconfig data, or the contents of path
+func readInlineOrFile(inline, path string) ([]byte, error) {
+	if inline != "" {
+		return base64.StdEncoding.DecodeString(inline)
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+// FetchWorkloads reads Deployments and StatefulSets with their pods and autoscalers, keyed by
+// namespace/name
+func (kc *KubernetesConnector) FetchWorkloads(ctx context.Context) (map[string]KubernetesWorkload, error) {
+	workloads := make(map[string]KubernetesWorkload)
+	selectors := make(map[string]map[string]string)
+
+	for _, kind := range []struct {
+		name     string
+		resource string
+	}{
+		{"Deployment", "deployments"},
+		{"StatefulSet", "statefulsets"},
+	} {
+		var list k8sWorkloadList
+		if err := kc.list(ctx, "/apis/apps/v1", kind.resource, &list); err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			workload := KubernetesWorkload{
+				Kind:          kind.name,
+				Name:          item.Metadata.Name,
+				Namespace:     item.Metadata.Namespace,
+				Replicas:      1,
+				ReadyReplicas: item.Status.ReadyReplicas,
+				Labels:        item.Metadata.Labels,
+				Annotations:   filterAnnotations(item.Metadata.Annotations),
+			}
+			if item.Spec.Replicas != nil {
+				workload.Replicas = *item.Spec.Replicas
+			}
+			if len(item.Metadata.OwnerReferences) > 0 {
+				owner := item.Metadata.OwnerReferences[0]
+				workload.Owner = owner.Kind + "/" + owner.Name
+			}
+			for _, container := range item.Spec.Template.Spec.Containers {
+				workload.Containers = append(workload.Containers, KubernetesContainer{
+					Name:     container.Name,
+					Image:    container.Image,
+					Requests: container.Resources.Requests,
+					Limits:   container.Resources.Limits,
+				})
+			}
+
+			key := kubernetesWorkloadKey(workload.Namespace, workload.Name)
+			workloads[key] = workload
+			selectors[key] = item.Spec.Selector.MatchLabels
+		}
+	}
+
+	// Count pods and restarts per workload by matching the workload's selector
+	var pods k8sPodList
+	if err := kc.list(ctx, "/api/v1", "pods", &pods); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for key, selector := range selectors {
+			workload := workloads[key]
+			if workload.Namespace != pod.Metadata.Namespace || !matchesSelector(selector, pod.Metadata.Labels) {
+				continue
+			}
+			workload.Pods++
+			for _, status := range pod.Status.ContainerStatuses {
+				workload.PodRestarts += status.RestartCount
+			}
+			workloads[key] = workload
+		}
+	}
+
+	var hpas k8sHPAList
+	if err := kc.list(ctx, "/apis/autoscaling/v2", "horizontalpodautoscalers", &hpas); err != nil {
+		return nil, err
+	}
+	for _, hpa := range hpas.Items {
+		key := kubernetesWorkloadKey(hpa.Metadata.Namespace, hpa.Spec.ScaleTargetRef.Name)
+		workload, exists := workloads[key]
+		if !exists || workload.Kind != hpa.Spec.ScaleTargetRef.Kind {
+			continue
+		}
+		settings := &KubernetesHPA{
+			Name:        hpa.Metadata.Name,
+			MinReplicas: 1,
+			MaxReplicas: hpa.Spec.MaxReplicas,
+		}
+		if hpa.Spec.MinReplicas != nil {
+			settings.MinReplicas = *hpa.Spec.MinReplicas
+		}
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Resource != nil && metric.Resource.Name == "cpu" {
+				settings.TargetCPUUtilization = metric.Resource.Target.AverageUtilization
+			}
+		}
+		workload.HPA = settings
+		workloads[key] = workload
+	}
+
+	log.Printf("Retrieved %d workloads from Kubernetes API", len(workloads))
+	return workloads, nil
+}
+
+// list fetches a resource from every configured namespace, or cluster-wide if none are configured,
+// and merges the items into out
+func (kc *KubernetesConnector) list(ctx context.Context, apiPrefix, resource string, out interface{}) error {
+	paths := []string{fmt.Sprintf("%s/%s", apiPrefix, resource)}
+	if len(kc.namespaces) > 0 {
+		paths = paths[:0]
+		for _, namespace := range kc.namespaces {
+			paths = append(paths, fmt.Sprintf("%s/namespaces/%s/%s", apiPrefix, namespace, resource))
+		}
+	}
+
+	var items []json.RawMessage
+	for _, path := range paths {
+		var page struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := kc.get(ctx, path, &page); err != nil {
+			return err
+		}
+		items = append(items, page.Items...)
+	}
+
+	merged, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		return fmt.Errorf("failed to merge %s: %w", resource, err)
+	}
+	return json.Unmarshal(merged, out)
+}
+
+// get executes a GET request against the Kubernetes API and decodes the JSON response
+func (kc *KubernetesConnector) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", kc.serverURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if kc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+kc.token)
+	}
+
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Kubernetes API returned status %d for %s: %s", resp.StatusCode, path, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// kubernetesWorkloadKey builds the namespace/name key used to store workload metadata
+func kubernetesWorkloadKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// lookupKubernetesWorkload finds the Kubernetes metadata for a graph node. The node's observed
+// namespace is used when known; otherwise the name must match a single workload.
+func lookupKubernetesWorkload(snapshot *AdjacencyListDocument, node string) *KubernetesWorkload {
+	if snapshot == nil || len(snapshot.KubernetesWorkloads) == 0 {
+		return nil
+	}
+
+	if namespace := snapshot.WorkloadOrigins[node].Namespace; namespace != "" {
+		if workload, exists := snapshot.KubernetesWorkloads[kubernetesWorkloadKey(namespace, node)]; exists {
+			return &workload
+		}
+		return nil
+	}
+
+	var match *KubernetesWorkload
+	for _, workload := range snapshot.KubernetesWorkloads {
+		if workload.Name != node {
+			continue
+		}
+		if match != nil {
+			return nil // Ambiguous across namespaces
+		}
+		w := workload
+		match = &w
+	}
+	return match
+}
+
+// matchesSelector reports whether labels satisfy every key of a matchLabels selector
+func matchesSelector(selector, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// filterAnnotations drops annotations that add bulk without context
+func filterAnnotations(annotations map[string]string) map[string]string {
+	filtered := make(map[string]string)
+	for key, value := range annotations {
+		if !ignoredAnnotations[key] {
+			filtered[key] = value
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+// KubernetesProvider contributes the Kubernetes metadata of workloads to collections. It only
+// describes workloads that other providers observe and adds no nodes or edges of its own.
+type KubernetesProvider struct {
+	connector *KubernetesConnector
+}
+
+// newKubernetesProviders creates the Kubernetes provider from the kubernetes section
+func newKubernetesProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	connector, err := NewKubernetesConnector(config.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	return []ContextProvider{&KubernetesProvider{connector: connector}}, nil
+}
+
+// Name returns the provider name recorded on the facts this provider contributes
+func (kp *KubernetesProvider) Name() string {
+	return ConnectorKubernetes
+}
+
+// Instance returns no Prometheus instance, as the provider reads the Kubernetes API
+func (kp *KubernetesProvider) Instance() string {
+	return ""
+}
+
+// DiscoverEntities returns the metadata of every Deployment and StatefulSet. Enrichment is best
+// effort: a failing Kubernetes API is logged and contributes nothing rather than losing the
+// observed topology. Historical requests get nothing, since the API only describes the present.
+func (kp *KubernetesProvider) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	if req.Historical {
+		return nil, nil
+	}
+	workloads, err := kp.connector.FetchWorkloads(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Failed to fetch Kubernetes workload metadata: %v", err)
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(workloads))
+	for key := range workloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entities := make([]Entity, 0, len(keys))
+	for _, key := range keys {
+		workload := workloads[key]
+		entities = append(entities, Entity{
+			Name:       workload.Name,
+			Type:       ResourceTypeWorkload,
+			Namespace:  workload.Namespace,
+			Kubernetes: &workload,
+		})
+	}
+	return entities, nil
+}
+
+// DiscoverRelationships returns no edges: the Kubernetes API does not show which workloads talk
+func (kp *KubernetesProvider) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	return nil, nil
+}
+
+// FetchMetrics returns no samples: replica and restart counts are part of the workload metadata
+func (kp *KubernetesProvider) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	return nil, nil
+}
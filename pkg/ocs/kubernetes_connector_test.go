@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testKubernetesAPI serves list responses by path, as the Kubernetes API does for the
+// resources the connector reads
+var testKubernetesAPI = map[string]string{
+	"/apis/apps/v1/namespaces/shop/deployments": `{"items": [
+		{
+			"metadata": {
+				"name": "checkout", "namespace": "shop",
+				"labels": {"app": "checkout"},
+				"annotations": {"team": "payments", "deployment.kubernetes.io/revision": "7"},
+				"ownerReferences": [{"kind": "Rollout", "name": "checkout"}]
+			},
+			"spec": {
+				"replicas": 3,
+				"selector": {"matchLabels": {"app": "checkout"}},
+				"template": {"spec": {"containers": [
+					{"name": "app", "image": "checkout:1.2", "resources": {"requests": {"cpu": "100m"}, "limits": {"memory": "256Mi"}}}
+				]}}
+			},
+			"status": {"readyReplicas": 2}
+		},
+		{
+			"metadata": {"name": "cart", "namespace": "shop"},
+			"spec": {"selector": {"matchLabels": {"app": "cart"}}, "template": {"spec": {"containers": []}}}
+		}
+	]}`,
+	"/apis/apps/v1/namespaces/shop/statefulsets": `{"items": [
+		{
+			"metadata": {"name": "database", "namespace": "shop"},
+			"spec": {"replicas": 1, "selector": {"matchLabels": {"app": "database"}}, "template": {"spec": {"containers": []}}},
+			"status": {"readyReplicas": 1}
+		}
+	]}`,
+	"/api/v1/namespaces/shop/pods": `{"items": [
+		{"metadata": {"name": "checkout-1", "namespace": "shop", "labels": {"app": "checkout", "pod-template-hash": "1"}}, "status": {"containerStatuses": [{"restartCount": 2}, {"restartCount": 1}]}},
+		{"metadata": {"name": "checkout-2", "namespace": "shop", "labels": {"app": "checkout"}}, "status": {"containerStatuses": [{"restartCount": 0}]}},
+		{"metadata": {"name": "database-0", "namespace": "shop", "labels": {"app": "database"}}, "status": {}},
+		{"metadata": {"name": "unrelated", "namespace": "shop", "labels": {"app": "other"}}, "status": {}}
+	]}`,
+	"/apis/autoscaling/v2/namespaces/shop/horizontalpodautoscalers": `{"items": [
+		{
+			"metadata": {"name": "checkout", "namespace": "shop"},
+			"spec": {
+				"scaleTargetRef": {"kind": "Deployment", "name": "checkout"},
+				"minReplicas": 2, "maxReplicas": 10,
+				"metrics": [{"resource": {"name": "cpu", "target": {"averageUtilization": 70}}}]
+			}
+		},
+		{
+			"metadata": {"name": "database", "namespace": "shop"},
+			"spec": {"scaleTargetRef": {"kind": "Deployment", "name": "database"}, "maxReplicas": 3}
+		}
+	]}`,
+}
+
+// newTestKubernetesAPI starts a fake Kubernetes API that requires the bearer token "secret" and
+// counts the requests it serves
+func newTestKubernetesAPI(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, `{"reason": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		body, ok := testKubernetesAPI[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"reason": "NotFound"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// writeTestKubeconfig writes a kubeconfig whose current context points at server
+func writeTestKubeconfig(t *testing.T, server, user string) string {
+	t.Helper()
+	data := `apiVersion: v1
+current-context: test
+clusters:
+  - name: test
+    cluster:
+      server: ` + server + `/
+contexts:
+  - name: test
+    context: {cluster: test, user: test}
+  - name: broken
+    context: {cluster: missing, user: test}
+users:
+  - name: test
+    user:
+` + user
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKubernetesConnectorFetchWorkloads(t *testing.T) {
+	server, _ := newTestKubernetesAPI(t)
+	connector, err := NewKubernetesConnector(KubernetesConfig{
+		Kubeconfig: writeTestKubeconfig(t, server.URL, "      token: secret\n"),
+		Namespaces: []string{"shop"},
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesConnector() error = %v", err)
+	}
+
+	workloads, err := connector.FetchWorkloads(context.Background())
+	if err != nil {
+		t.Fatalf("FetchWorkloads() error = %v", err)
+	}
+
+	cpuTarget := int32(70)
+	want := map[string]KubernetesWorkload{
+		"shop/checkout": {
+			Kind: "Deployment", Name: "checkout", Namespace: "shop", Owner: "Rollout/checkout",
+			Replicas: 3, ReadyReplicas: 2, Pods: 2, PodRestarts: 3,
+			Labels:      map[string]string{"app": "checkout"},
+			Annotations: map[string]string{"team": "payments"},
+			Containers: []KubernetesContainer{
+				{Name: "app", Image: "checkout:1.2", Requests: map[string]string{"cpu": "100m"}, Limits: map[string]string{"memory": "256Mi"}},
+			},
+			HPA: &KubernetesHPA{Name: "checkout", MinReplicas: 2, MaxReplicas: 10, TargetCPUUtilization: &cpuTarget},
+		},
+		// Replicas default to 1 when unset
+		"shop/cart": {Kind: "Deployment", Name: "cart", Namespace: "shop", Replicas: 1},
+		// The database HPA targets a Deployment, not the StatefulSet of the same name
+		"shop/database": {Kind: "StatefulSet", Name: "database", Namespace: "shop", Replicas: 1, ReadyReplicas: 1, Pods: 1},
+	}
+	if !reflect.DeepEqual(workloads, want) {
+		t.Errorf("FetchWorkloads() = %s, want %s", mustJSON(t, workloads), mustJSON(t, want))
+	}
+}
+
+func TestKubernetesConnectorFetchWorkloadsErrors(t *testing.T) {
+	server, _ := newTestKubernetesAPI(t)
+
+	unauthorized := &KubernetesConnector{serverURL: server.URL, token: "wrong", namespaces: []string{"shop"}, httpClient: server.Client()}
+	if _, err := unauthorized.FetchWorkloads(context.Background()); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("FetchWorkloads() with a wrong token error = %v, want status 401", err)
+	}
+
+	// Cluster-wide lists are not served by the fake API
+	clusterWide := &KubernetesConnector{serverURL: server.URL, token: "secret", httpClient: server.Client()}
+	if _, err := clusterWide.FetchWorkloads(context.Background()); err == nil || !strings.Contains(err.Error(), "/apis/apps/v1/deployments") {
+		t.Errorf("FetchWorkloads() cluster-wide error = %v, want the cluster-wide deployments path", err)
+	}
+}
+
+func TestNewKubernetesConnector(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		config    func(t *testing.T) KubernetesConfig
+		wantToken string
+		wantErr   string
+	}{
+		{
+			name: "kubeconfig token",
+			config: func(t *testing.T) KubernetesConfig {
+				return KubernetesConfig{Kubeconfig: writeTestKubeconfig(t, "https://k8s.example.com", "      token: secret\n")}
+			},
+			wantToken: "secret",
+		},
+		{
+			name: "kubeconfig token file",
+			config: func(t *testing.T) KubernetesConfig {
+				return KubernetesConfig{Kubeconfig: writeTestKubeconfig(t, "https://k8s.example.com", "      tokenFile: "+tokenFile+"\n")}
+			},
+			wantToken: "from-file",
+		},
+		{
+			name: "unknown context",
+			config: func(t *testing.T) KubernetesConfig {
+				return KubernetesConfig{Kubeconfig: writeTestKubeconfig(t, "https://k8s.example.com", "      token: secret\n"), Context: "staging"}
+			},
+			wantErr: `context "staging" not found in kubeconfig`,
+		},
+		{
+			name: "unknown cluster",
+			config: func(t *testing.T) KubernetesConfig {
+				return KubernetesConfig{Kubeconfig: writeTestKubeconfig(t, "https://k8s.example.com", "      token: secret\n"), Context: "broken"}
+			},
+			wantErr: `cluster "missing" not found in kubeconfig`,
+		},
+		{
+			name: "missing kubeconfig",
+			config: func(t *testing.T) KubernetesConfig {
+				return KubernetesConfig{Kubeconfig: filepath.Join(t.TempDir(), "missing")}
+			},
+			wantErr: "failed to read kubeconfig",
+		},
+		{
+			name: "not in a cluster",
+			config: func(t *testing.T) KubernetesConfig {
+				t.Setenv("KUBERNETES_SERVICE_HOST", "")
+				t.Setenv("KUBERNETES_SERVICE_PORT", "")
+				return KubernetesConfig{}
+			},
+			wantErr: "not running inside a Kubernetes cluster",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector, err := NewKubernetesConnector(tt.config(t))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewKubernetesConnector() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewKubernetesConnector() error = %v", err)
+			}
+			if connector.serverURL != "https://k8s.example.com" || connector.token != tt.wantToken {
+				t.Errorf("connector server = %q, token = %q, want https://k8s.example.com and %q", connector.serverURL, connector.token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestMatchesSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector map[string]string
+		labels   map[string]string
+		want     bool
+	}{
+		{name: "every key matches", selector: map[string]string{"app": "checkout"}, labels: map[string]string{"app": "checkout", "version": "v2"}, want: true},
+		{name: "value differs", selector: map[string]string{"app": "checkout"}, labels: map[string]string{"app": "cart"}},
+		{name: "key missing", selector: map[string]string{"app": "checkout", "tier": "web"}, labels: map[string]string{"app": "checkout"}},
+		{name: "empty selector matches nothing", labels: map[string]string{"app": "checkout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesSelector(tt.selector, tt.labels); got != tt.want {
+				t.Errorf("matchesSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupKubernetesWorkload(t *testing.T) {
+	snapshot := &AdjacencyListDocument{
+		WorkloadOrigins: map[string]WorkloadOrigin{"checkout": {Namespace: "shop"}, "cart": {Namespace: "staging"}},
+		KubernetesWorkloads: map[string]KubernetesWorkload{
+			"shop/checkout":    {Kind: "Deployment", Name: "checkout", Namespace: "shop"},
+			"staging/checkout": {Kind: "Deployment", Name: "checkout", Namespace: "staging"},
+			"shop/cart":        {Kind: "Deployment", Name: "cart", Namespace: "shop"},
+			"shop/database":    {Kind: "StatefulSet", Name: "database", Namespace: "shop"},
+			"jobs/worker":      {Kind: "Deployment", Name: "worker", Namespace: "jobs"},
+			"batch/worker":     {Kind: "Deployment", Name: "worker", Namespace: "batch"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		snapshot      *AdjacencyListDocument
+		node          string
+		wantNamespace string
+	}{
+		{name: "observed namespace", snapshot: snapshot, node: "checkout", wantNamespace: "shop"},
+		{name: "observed namespace without metadata", snapshot: snapshot, node: "cart"},
+		{name: "unique name", snapshot: snapshot, node: "database", wantNamespace: "shop"},
+		{name: "ambiguous name", snapshot: snapshot, node: "worker"},
+		{name: "unknown", snapshot: snapshot, node: "payments"},
+		{name: "no snapshot", node: "checkout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lookupKubernetesWorkload(tt.snapshot, tt.node)
+			switch {
+			case tt.wantNamespace == "" && got != nil:
+				t.Errorf("lookupKubernetesWorkload() = %+v, want none", got)
+			case tt.wantNamespace != "" && (got == nil || got.Namespace != tt.wantNamespace || got.Name != tt.node):
+				t.Errorf("lookupKubernetesWorkload() = %+v, want %s/%s", got, tt.wantNamespace, tt.node)
+			}
+		})
+	}
+}
+
+func TestKubernetesProviderDiscoverEntities(t *testing.T) {
+	server, requests := newTestKubernetesAPI(t)
+	provider := &KubernetesProvider{connector: &KubernetesConnector{
+		serverURL: server.URL, token: "secret", namespaces: []string{"shop"}, httpClient: server.Client(),
+	}}
+
+	entities, err := provider.DiscoverEntities(context.Background(), CollectionRequest{})
+	if err != nil {
+		t.Fatalf("DiscoverEntities() error = %v", err)
+	}
+	var names []string
+	for _, entity := range entities {
+		if entity.Kubernetes == nil || entity.Type != ResourceTypeWorkload || entity.Namespace != "shop" {
+			t.Errorf("entity %+v does not carry its Kubernetes metadata", entity)
+		}
+		names = append(names, entity.Name)
+	}
+	if want := []string{"cart", "checkout", "database"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("DiscoverEntities() names = %v, want %v", names, want)
+	}
+
+	// Historical buckets describe the past, which the Kubernetes API cannot
+	before := atomic.LoadInt32(requests)
+	entities, err = provider.DiscoverEntities(context.Background(), CollectionRequest{Historical: true})
+	if err != nil || entities != nil || atomic.LoadInt32(requests) != before {
+		t.Errorf("DiscoverEntities() for a historical bucket = %v, %v after %d requests, want nothing without requests",
+			entities, err, atomic.LoadInt32(requests)-before)
+	}
+
+	// A failing API is logged and contributes nothing, unless the collection was cancelled
+	provider.connector.token = "wrong"
+	if entities, err := provider.DiscoverEntities(context.Background(), CollectionRequest{}); err != nil || entities != nil {
+		t.Errorf("DiscoverEntities() with a failing API = %v, %v, want nothing and no error", entities, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.DiscoverEntities(ctx, CollectionRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("DiscoverEntities() after cancellation error = %v, want context.Canceled", err)
+	}
+}
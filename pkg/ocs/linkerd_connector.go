@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConnectorLinkerd identifies topology collected by the LinkerdConnector
+const ConnectorLinkerd = "linkerd"
+
+// Metric names of the samples the LinkerdConnector reports per destination workload
+const (
+	LinkerdResponseTotal       = "linkerd_response_total"
+	LinkerdResponseFailedTotal = "linkerd_response_failed_total"
+	LinkerdSuccessRate         = "linkerd_success_rate"
+)
+
+// LinkerdConnector handles Linkerd proxy metrics queries via Prometheus. It produces the same
+// topology as the IstioConnector for clusters running Linkerd.
+type LinkerdConnector struct {
+	prometheus *PrometheusClient
+
+	// The last query results are kept so the discovery calls of one collection share one set of queries
+	mu         sync.Mutex
+	lastKey    string
+	lastResult *linkerdResult
+}
+
+// linkerdResult holds the outbound request and response series for one collection
+type linkerdResult struct {
+	requests  *PrometheusQueryResult
+	responses *PrometheusQueryResult
+}
+
+// NewLinkerdConnector creates a Linkerd connector for the named Prometheus instance
+func NewLinkerdConnector(prometheusName, prometheusURL string) *LinkerdConnector {
+	return &LinkerdConnector{
+		prometheus: NewPrometheusClient(prometheusName, prometheusURL),
+	}
+}
+
+// newLinkerdProviders creates a Linkerd provider for each Prometheus instance selecting it
+func newLinkerdProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	instances, err := promConfig.instancesFor(ConnectorLinkerd)
+	if err != nil {
+		return nil, err
+	}
+	var providers []ContextProvider
+	for _, instance := range instances {
+		providers = append(providers, NewLinkerdConnector(instance.Name, instance.BaseURL))
+	}
+	return providers, nil
+}
+
+// Name returns the provider name recorded on the facts this connector contributes
+func (lc *LinkerdConnector) Name() string {
+	return ConnectorLinkerd
+}
+
+// Instance returns the name of the Prometheus instance the connector queries
+func (lc *LinkerdConnector) Instance() string {
+	return lc.prometheus.name
+}
+
+// DiscoverEntities returns the deployments, external hosts and services seen in request_total
+func (lc *LinkerdConnector) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	result, err := lc.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	origins := make(map[string]string)
+	services := make(map[string][]string)
+	hostSet := make(map[string]bool)
+	for _, r := range result.requests.Data.Result {
+		if source := r.Metric["deployment"]; source != "" && origins[source] == "" {
+			origins[source] = r.Metric["namespace"]
+		}
+		if isLinkerdExternalDestination(r.Metric) {
+			hostSet[linkerdAuthorityHost(r.Metric["authority"])] = true
+			continue
+		}
+		destination := r.Metric["dst_deployment"]
+		if destination == "" {
+			continue
+		}
+		if origins[destination] == "" {
+			origins[destination] = r.Metric["dst_namespace"]
+		}
+		if service := linkerdAuthorityHost(r.Metric["authority"]); service != "" {
+			services[service] = appendUnique(services[service], destination)
+		}
+	}
+
+	var entities []Entity
+	for workload, namespace := range origins {
+		entities = append(entities, Entity{Name: workload, Type: ResourceTypeWorkload, Namespace: namespace})
+	}
+	for host := range hostSet {
+		entities = append(entities, Entity{Name: host, Type: ResourceTypeExternalHost})
+	}
+	for service, workloads := range services {
+		entities = append(entities, Entity{Name: service, Type: ResourceTypeService, Members: workloads})
+	}
+	return entities, nil
+}
+
+// DiscoverRelationships returns the observed deployment -> destination edges with their request volume
+func (lc *LinkerdConnector) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	result, err := lc.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	edgeTraffic := make(map[string]map[string]float64)
+	for _, r := range result.requests.Data.Result {
+		source := r.Metric["deployment"]
+		destination := linkerdDestinationNode(r.Metric)
+		if source == "" || destination == "" {
+			continue
+		}
+		if edgeTraffic[source] == nil {
+			edgeTraffic[source] = make(map[string]float64)
+		}
+		value, _ := sampleValue(r.Value)
+		edgeTraffic[source][destination] += value
+	}
+
+	var relationships []Relationship
+	for source, destinations := range edgeTraffic {
+		for destination, requests := range destinations {
+			traffic := requests
+			relationships = append(relationships, Relationship{Source: source, Destination: destination, Traffic: &traffic})
+		}
+	}
+	return relationships, nil
+}
+
+// FetchMetrics returns each destination's response count, failures and success rate, from the
+// classification label Linkerd puts on response_total
+func (lc *LinkerdConnector) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	result, err := lc.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]float64)
+	failures := make(map[string]float64)
+	for _, r := range result.responses.Data.Result {
+		destination := linkerdDestinationNode(r.Metric)
+		value, ok := sampleValue(r.Value)
+		if destination == "" || !ok {
+			continue
+		}
+		responses[destination] += value
+		if r.Metric["classification"] == "failure" {
+			failures[destination] += value
+		}
+	}
+
+	destinations := make([]string, 0, len(responses))
+	for destination := range responses {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+
+	var samples []MetricSample
+	for _, destination := range destinations {
+		samples = append(samples,
+			MetricSample{Entity: destination, Metric: LinkerdResponseTotal, Value: responses[destination]},
+			MetricSample{Entity: destination, Metric: LinkerdResponseFailedTotal, Value: failures[destination]},
+		)
+		if responses[destination] > 0 {
+			samples = append(samples, MetricSample{
+				Entity: destination,
+				Metric: LinkerdSuccessRate,
+				Value:  (responses[destination] - failures[destination]) / responses[destination],
+			})
+		}
+	}
+	return samples, nil
+}
+
+// collect runs the Linkerd queries once per collection request and reuses the results for later calls
+func (lc *LinkerdConnector) collect(ctx context.Context, req CollectionRequest) (*linkerdResult, error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	key := req.key()
+	if lc.lastResult != nil && lc.lastKey == key {
+		return lc.lastResult, nil
+	}
+	if len(req.Workloads) == 0 {
+		return nil, fmt.Errorf("no source workloads provided")
+	}
+
+	// Outbound series are reported by the calling proxy, so they are filtered by source deployment
+	filter := fmt.Sprintf(`{direction="outbound", deployment=~"%s"}`, strings.Join(req.Workloads, "|"))
+	requests, err := lc.prometheus.Query(ctx, "request_total"+filter, req.From, req.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query request_total: %w", err)
+	}
+	responses, err := lc.prometheus.Query(ctx, "response_total"+filter, req.From, req.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query response_total: %w", err)
+	}
+
+	result := &linkerdResult{requests: requests, responses: responses}
+	lc.lastKey, lc.lastResult = key, result
+	return result, nil
+}
+
+// linkerdDestinationNode returns the graph node a series points at: the destination deployment,
+// or the authority's host for destinations outside the mesh
+func linkerdDestinationNode(metric map[string]string) string {
+	if isLinkerdExternalDestination(metric) {
+		return linkerdAuthorityHost(metric["authority"])
+	}
+	return metric["dst_deployment"]
+}
+
+// isLinkerdExternalDestination reports whether a series points at a host outside the mesh,
+// which Linkerd reports without destination deployment labels
+func isLinkerdExternalDestination(metric map[string]string) bool {
+	return metric["dst_deployment"] == "" && metric["authority"] != ""
+}
+
+// linkerdAuthorityHost strips the port from a request authority such as db.default.svc.cluster.local:5432
+func linkerdAuthorityHost(authority string) string {
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		return host
+	}
+	return authority
+}
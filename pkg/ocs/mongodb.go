@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,24 +13,21 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// errRuntimeConfigConflict is returned when another change saved the same runtime config version first
+var errRuntimeConfigConflict = errors.New("runtime config was changed concurrently")
+
 // MongoDBRepository handles all MongoDB operations
 type MongoDBRepository struct {
-	client     *mongo.Client
-	database   *mongo.Database
-	collection *mongo.Collection
+	client        *mongo.Client
+	database      *mongo.Database
+	collection    *mongo.Collection
+	runtimeConfig *mongo.Collection
+	backfills     *mongo.Collection
 }
 
 // NewMongoDBRepository creates a new MongoDB repository
-func NewMongoDBRepository() (*MongoDBRepository, error) {
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017/"
-	}
-
-	dbName := os.Getenv("MONGODB_DB_NAME")
-	if dbName == "" {
-		dbName = "ocs"
-	}
+func NewMongoDBRepository(config MongoDBConfig) (*MongoDBRepository, error) {
+	mongoURI, dbName := config.URI, config.Database
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -46,17 +43,55 @@ func NewMongoDBRepository() (*MongoDBRepository, error) {
 	}
 
 	database := client.Database(dbName)
-	collection := database.Collection("workload_adjacency")
+	collection := database.Collection(profileCollection(DefaultProfile))
+
+	// Versions are unique so that concurrent changes cannot both save the same version
+	runtimeConfig := database.Collection("runtime_config")
+	_, err = runtimeConfig.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create runtime config index: %w", err)
+	}
 
 	log.Printf("Connected to MongoDB: %s, database: %s", mongoURI, dbName)
 
 	return &MongoDBRepository{
-		client:     client,
-		database:   database,
-		collection: collection,
+		client:        client,
+		database:      database,
+		collection:    collection,
+		runtimeConfig: runtimeConfig,
+		backfills:     database.Collection("backfills"),
 	}, nil
 }
 
+// snapshotIndexes are the indexes every topology snapshot collection needs. The latest snapshot
+// by data time is read on every uncached prompt, and resuming a backfill looks up the windows it
+// already saved by backfill_id.
+var snapshotIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+	{
+		Keys:    bson.D{{Key: "backfill_id", Value: 1}, {Key: "window_start", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.D{{Key: "backfill_id", Value: bson.D{{Key: "$exists", Value: true}}}}),
+	},
+}
+
+// withCollection returns a repository sharing this one's connection that stores topology
+// snapshots in another collection, creating the collection's indexes if they do not exist yet.
+// Queries still work without them, so a failure is only logged.
+func (r *MongoDBRepository) withCollection(name string) *MongoDBRepository {
+	scoped := *r
+	scoped.collection = r.database.Collection(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := scoped.collection.Indexes().CreateMany(ctx, snapshotIndexes); err != nil {
+		log.Printf("Failed to create indexes on %s: %v", name, err)
+	}
+	return &scoped
+}
+
 // Close closes the MongoDB connection
 func (r *MongoDBRepository) Close() error {
 	if r.client != nil {
@@ -69,12 +104,27 @@ func (r *MongoDBRepository) Close() error {
 
 // GetLatestAdjacencyList retrieves the most recent adjacency list from MongoDB
 func (r *MongoDBRepository) GetLatestAdjacencyList() (map[string][]string, error) {
+	doc, err := r.GetLatestSnapshot(LatestByDataTime)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	return doc.AdjacencyList, nil
+}
+
+// GetLatestSnapshot retrieves the most recent adjacency list document from MongoDB, either by
+// the time its data was observed or by the time it was collected
+func (r *MongoDBRepository) GetLatestSnapshot(order string) (*AdjacencyListDocument, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Find the latest document sorted by timestamp
+	// Object IDs begin with their creation time, so they order snapshots by collection time,
+	// including those saved before collected_at was recorded
+	sorting := bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}
+	if order == LatestByCollectionTime {
+		sorting = bson.D{{Key: "_id", Value: -1}}
+	}
 	var doc AdjacencyListDocument
-	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	opts := options.FindOne().SetSort(sorting)
 	err := r.collection.FindOne(ctx, bson.D{}, opts).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -83,22 +133,26 @@ func (r *MongoDBRepository) GetLatestAdjacencyList() (map[string][]string, error
 		return nil, fmt.Errorf("failed to query MongoDB: %w", err)
 	}
 
-	return doc.AdjacencyList, nil
+	return &doc, nil
 }
 
-// SaveAdjacencyList saves the adjacency list to MongoDB
-func (r *MongoDBRepository) SaveAdjacencyList(adjacencyList map[string][]string) (primitive.ObjectID, error) {
+// SaveSnapshot saves an adjacency list document to MongoDB, filling in its ID, counts and
+// collector version and, if unset, its collection time and timestamp
+func (r *MongoDBRepository) SaveSnapshot(doc AdjacencyListDocument) (primitive.ObjectID, error) {
 	totalConnections := 0
-	for _, dests := range adjacencyList {
+	for _, dests := range doc.AdjacencyList {
 		totalConnections += len(dests)
 	}
 
-	doc := AdjacencyListDocument{
-		ID:               primitive.NewObjectID(),
-		AdjacencyList:    adjacencyList,
-		Timestamp:        time.Now(),
-		SourceCount:      len(adjacencyList),
-		TotalConnections: totalConnections,
+	doc.ID = primitive.NewObjectID()
+	doc.SourceCount = len(doc.AdjacencyList)
+	doc.TotalConnections = totalConnections
+	doc.CollectorVersion = collectorVersion
+	if doc.CollectedAt.IsZero() {
+		doc.CollectedAt = time.Now()
+	}
+	if doc.Timestamp.IsZero() {
+		doc.Timestamp = doc.CollectedAt
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -113,3 +167,156 @@ func (r *MongoDBRepository) SaveAdjacencyList(adjacencyList map[string][]string)
 	return result.InsertedID.(primitive.ObjectID), nil
 }
 
+// HasImportedSnapshot reports whether a static topology with the given content hash has been
+// imported already
+func (r *MongoDBRepository) HasImportedSnapshot(importHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.D{{Key: "import_hash", Value: importHash}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to query imported snapshots: %w", err)
+	}
+	return count > 0, nil
+}
+
+// GetLatestRuntimeConfig retrieves the current runtime config version, or nil if the runtime
+// configuration API has never been used
+func (r *MongoDBRepository) GetLatestRuntimeConfig() (*RuntimeConfigDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc RuntimeConfigDocument
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := r.runtimeConfig.FindOne(ctx, bson.D{}, opts).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query runtime config: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// ListRuntimeConfigVersions retrieves up to limit runtime config versions, newest first
+func (r *MongoDBRepository) ListRuntimeConfigVersions(limit int) ([]RuntimeConfigDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.runtimeConfig.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runtime config: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []RuntimeConfigDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode runtime config: %w", err)
+	}
+	return docs, nil
+}
+
+// SaveRuntimeConfig saves a new runtime config version. It returns errRuntimeConfigConflict
+// if the version already exists.
+func (r *MongoDBRepository) SaveRuntimeConfig(doc RuntimeConfigDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc.ID = primitive.NewObjectID()
+	if _, err := r.runtimeConfig.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errRuntimeConfigConflict
+		}
+		return fmt.Errorf("failed to insert runtime config: %w", err)
+	}
+
+	log.Printf("Saved runtime config version %d: %s", doc.Version, doc.Change)
+	return nil
+}
+
+// SaveBackfill saves a new backfill, filling in its ID
+func (r *MongoDBRepository) SaveBackfill(doc *BackfillDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc.ID = primitive.NewObjectID()
+	if _, err := r.backfills.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to insert backfill: %w", err)
+	}
+	return nil
+}
+
+// UpdateBackfill replaces a saved backfill
+func (r *MongoDBRepository) UpdateBackfill(doc BackfillDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.backfills.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}}, doc); err != nil {
+		return fmt.Errorf("failed to update backfill: %w", err)
+	}
+	return nil
+}
+
+// GetBackfill retrieves a backfill, or nil if it does not exist
+func (r *MongoDBRepository) GetBackfill(id primitive.ObjectID) (*BackfillDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc BackfillDocument
+	err := r.backfills.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query backfill: %w", err)
+	}
+	return &doc, nil
+}
+
+// ListBackfills retrieves up to limit backfills, newest first
+func (r *MongoDBRepository) ListBackfills(limit int) ([]BackfillDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.backfills.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backfills: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	docs := []BackfillDocument{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode backfills: %w", err)
+	}
+	return docs, nil
+}
+
+// BackfilledWindows returns the start of every window a backfill has saved a snapshot for, as
+// Unix seconds
+func (r *MongoDBRepository) BackfilledWindows(backfillID primitive.ObjectID) (map[int64]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.D{{Key: "window_start", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.D{{Key: "backfill_id", Value: backfillID}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backfilled snapshots: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	windows := make(map[int64]bool)
+	for cursor.Next(ctx) {
+		var doc AdjacencyListDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode backfilled snapshot: %w", err)
+		}
+		if doc.WindowStart != nil {
+			windows[doc.WindowStart.Unix()] = true
+		}
+	}
+	return windows, cursor.Err()
+}
+
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Supported values for output_sort_key in ocs_config.yaml
+const (
+	SortByResourceID = "resource_id"
+	SortByWorkload   = "workload"
+	SortByDomain     = "domain"
+)
+
+// sortContextDefinitions orders context definitions by the configured sort key so that
+// identical topology always produces byte-identical output. Ties fall back to resource ID, and
+// definitions without a workload, such as namespaces, sort by resource ID among the workloads.
+func sortContextDefinitions(contextDefinitions []OCSContextDefinition, sortKey string) {
+	key := func(def OCSContextDefinition) string {
+		switch sortKey {
+		case SortByWorkload:
+			if workload, ok := def.Identity["workload"].(string); ok {
+				return workload
+			}
+			return def.ResourceID
+		case SortByDomain:
+			return def.Domain
+		default:
+			return def.ResourceID
+		}
+	}
+
+	sort.SliceStable(contextDefinitions, func(i, j int) bool {
+		ki, kj := key(contextDefinitions[i]), key(contextDefinitions[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return contextDefinitions[i].ResourceID < contextDefinitions[j].ResourceID
+	})
+}
+
+// sortedCopy returns a sorted copy of values, leaving the original untouched
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// computeContentHash returns a stable hash of a response's content. It is computed before the
+// response's content_hash is set.
+func computeContentHash(response interface{}) (string, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal response: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortContextDefinitions(t *testing.T) {
+	// A mix of definition types, only some of which have a workload
+	definitions := []OCSContextDefinition{
+		{ResourceID: "workload-shop-zeta", Domain: "compute.k8s", Identity: map[string]interface{}{"workload": "zeta"}},
+		{ResourceID: "namespace-shop", Domain: "tenancy.k8s", Identity: map[string]interface{}{"namespace": "shop"}},
+		{ResourceID: "external-api.example.com", Domain: "network.external", Identity: map[string]interface{}{"host": "api.example.com"}},
+		{ResourceID: "workload-shop-app", Domain: "compute.k8s", Identity: map[string]interface{}{"workload": "app"}},
+		{ResourceID: "service-shop-app", Domain: "network.k8s", Identity: map[string]interface{}{"service": "app"}},
+		{ResourceID: "workload-east-app", Domain: "compute.k8s", Identity: map[string]interface{}{"workload": "app"}},
+	}
+
+	tests := []struct {
+		sortKey string
+		want    []string
+	}{
+		{
+			sortKey: SortByResourceID,
+			want:    []string{"external-api.example.com", "namespace-shop", "service-shop-app", "workload-east-app", "workload-shop-app", "workload-shop-zeta"},
+		},
+		{
+			// Definitions without a workload sort by resource ID; equal workloads tie-break on it
+			sortKey: SortByWorkload,
+			want:    []string{"workload-east-app", "workload-shop-app", "external-api.example.com", "namespace-shop", "service-shop-app", "workload-shop-zeta"},
+		},
+		{
+			sortKey: SortByDomain,
+			want:    []string{"workload-east-app", "workload-shop-app", "workload-shop-zeta", "external-api.example.com", "service-shop-app", "namespace-shop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortKey, func(t *testing.T) {
+			sorted := append([]OCSContextDefinition(nil), definitions...)
+			sortContextDefinitions(sorted, tt.sortKey)
+			var got []string
+			for _, def := range sorted {
+				got = append(got, def.ResourceID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortContextDefinitions(%s) = %v, want %v", tt.sortKey, got, tt.want)
+			}
+		})
+	}
+}
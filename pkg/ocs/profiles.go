@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProfile names the settings at the top level of ocs_config.yaml
+const DefaultProfile = "default"
+
+// profileNamePattern restricts profile names to what can be used in URLs and collection names
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// profileNames returns the names of the configured profiles, sorted
+func (c *Config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileConfig returns the configuration of a named profile: every OCS setting the profile sets
+// replaces the top-level one, even with a zero value such as false or [], and its Prometheus
+// instances replace the Prometheus config's
+func (c *Config) profileConfig(name string) *Config {
+	profile := c.Profiles[name]
+	merged := *c
+	merged.Profiles = nil
+
+	settings := reflect.ValueOf(&merged.OCSConfig).Elem()
+	overrides := reflect.ValueOf(profile.OCSConfig)
+	for i := 0; i < overrides.NumField(); i++ {
+		key := strings.Split(overrides.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if profile.keys[key] {
+			settings.Field(i).Set(overrides.Field(i))
+		}
+	}
+	if len(profile.PrometheusInstances) > 0 {
+		merged.Prometheus = PrometheusConfig{PrometheusInstances: profile.PrometheusInstances}
+	}
+	return &merged
+}
+
+// recordProfileKeys notes which settings each profile sets in the parsed ocs_config.yaml, as
+// the decoded values cannot tell a setting left out from one set to its zero value
+func (c *Config) recordProfileKeys(document *yaml.Node) {
+	var profiles *yaml.Node
+	if document != nil && len(document.Content) > 0 {
+		profiles = mappingValue(document.Content[0], "profiles")
+	}
+	for name, profile := range c.Profiles {
+		profile.keys = make(map[string]bool)
+		addMappingKeys(profile.keys, mappingValue(profiles, name))
+		c.Profiles[name] = profile
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// addMappingKeys adds the keys of a mapping node to keys, including those merged in with <<
+func addMappingKeys(keys map[string]bool, node *yaml.Node) {
+	if node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil {
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "<<" {
+				addMappingKeys(keys, node.Content[i+1])
+				continue
+			}
+			keys[node.Content[i].Value] = true
+		}
+	case yaml.SequenceNode:
+		// A merge of several mappings
+		for _, child := range node.Content {
+			addMappingKeys(keys, child)
+		}
+	}
+}
+
+// profileCollection returns the MongoDB collection holding a profile's topology snapshots
+func profileCollection(profile string) string {
+	if profile == DefaultProfile {
+		return "workload_adjacency"
+	}
+	return "workload_adjacency_" + profile
+}
+
+// profileStore is where a profile's topology snapshots are stored and cached
+type profileStore struct {
+	repo        *MongoDBRepository
+	promptCache *PromptCache
+}
+
+// store returns the topology store of a profile, creating it on first use
+func (s *Server) store(profile string) *profileStore {
+	s.storesMu.Lock()
+	defer s.storesMu.Unlock()
+
+	if store, ok := s.stores[profile]; ok {
+		return store
+	}
+	store := &profileStore{
+		repo:        s.mongoRepo.withCollection(profileCollection(profile)),
+		promptCache: NewPromptCache(),
+	}
+	s.stores[profile] = store
+	return store
+}
+
+// invalidatePromptCaches drops the cached prompts of every profile, e.g. after a config change
+func (s *Server) invalidatePromptCaches() {
+	s.storesMu.Lock()
+	defer s.storesMu.Unlock()
+	for _, store := range s.stores {
+		store.promptCache.Invalidate()
+	}
+}
+
+// requestProfile returns the configuration of the profile named by the request's profile path or
+// query parameter, or of the default profile when it names none. It responds with 404 and returns
+// false if the profile does not exist.
+func (s *Server) requestProfile(c *gin.Context) (*ActiveConfig, bool) {
+	name := c.Param("profile")
+	if name == "" {
+		name = c.Query("profile")
+	}
+	cfg, ok := s.profile(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Unknown profile %s", name),
+		})
+	}
+	return cfg, ok
+}
+
+// profile returns the active configuration of a profile, where an empty name is the default
+// profile, and false if the profile does not exist
+func (s *Server) profile(name string) (*ActiveConfig, bool) {
+	cfg := s.activeConfig()
+	if name == "" || name == DefaultProfile {
+		return cfg, true
+	}
+
+	profile, ok := cfg.profiles[name]
+	if !ok {
+		return nil, false
+	}
+	// Profiles share the version of the configuration they were loaded with, which runtime
+	// changes to the default profile move on
+	scoped := *profile
+	scoped.version = cfg.version
+	return &scoped, true
+}
+
+// profilesHandler handles the profiles endpoint
+func (s *Server) profilesHandler(c *gin.Context) {
+	cfg := s.activeConfig()
+	describe := func(profile *ActiveConfig) gin.H {
+		instances := make([]string, 0, len(profile.config.Prometheus.PrometheusInstances))
+		for _, instance := range profile.config.Prometheus.PrometheusInstances {
+			instances = append(instances, instance.Name)
+		}
+		return gin.H{
+			"name":                 profile.profile,
+			"workloads":            profile.ocsConfig.Workload,
+			"prometheus_instances": instances,
+			"collection":           profileCollection(profile.profile),
+		}
+	}
+
+	profiles := []gin.H{describe(cfg)}
+	for _, name := range cfg.config.profileNames() {
+		profiles = append(profiles, describe(cfg.profiles[name]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"profiles": profiles,
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testProfilesConfig = `workload: [app]
+metrics:
+  - name: cpu
+    type: gauge
+    unit: percentage
+    description: CPU usage
+    aggregation_logic: average
+time_window_minutes: 15
+providers: [istio]
+istio_config:
+  enabled: true
+  source: directory
+  directory: /etc/istio
+profiles:
+  payments:
+    workload: [checkout]
+    time_window_minutes: null
+    providers: []
+    istio_config:
+      enabled: false
+  search:
+    policy: ["page on latency"]
+`
+
+const testProfilesPrometheusConfig = `prometheus_instances:
+  - name: main
+    base_url: http://localhost:9090
+`
+
+var testProfilesPaths = ConfigPaths{OCSConfig: "ocs.yaml", PrometheusConfig: "prom.yaml"}
+
+func TestProfileConfig(t *testing.T) {
+	config, err := parseConfig(testProfilesPaths, []byte(testProfilesConfig), []byte(testProfilesPrometheusConfig))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	payments := config.profileConfig("payments").OCSConfig
+	if !reflect.DeepEqual(payments.Workload, []string{"checkout"}) {
+		t.Errorf("payments workload = %v, want [checkout]", payments.Workload)
+	}
+	if payments.TimeWindowMinutes != nil {
+		t.Errorf("payments time_window_minutes = %d, want it cleared", *payments.TimeWindowMinutes)
+	}
+	if len(payments.Providers) != 0 {
+		t.Errorf("payments providers = %v, want none", payments.Providers)
+	}
+	if payments.IstioConfig.Enabled {
+		t.Error("payments istio_config is enabled, want it disabled")
+	}
+	if len(payments.Metrics) != 1 {
+		t.Errorf("payments metrics = %v, want the top-level metric", payments.Metrics)
+	}
+
+	search := config.profileConfig("search").OCSConfig
+	if !reflect.DeepEqual(search.Workload, []string{"app"}) {
+		t.Errorf("search workload = %v, want the top-level [app]", search.Workload)
+	}
+	if !search.IstioConfig.Enabled || search.TimeWindowMinutes == nil || *search.TimeWindowMinutes != 15 {
+		t.Errorf("search does not inherit the top-level settings: %+v", search)
+	}
+	if !reflect.DeepEqual(search.Policy, []string{"page on latency"}) {
+		t.Errorf("search policy = %v, want [page on latency]", search.Policy)
+	}
+}
+
+func TestWithRuntimeConfigRebuildsProfiles(t *testing.T) {
+	cfg, err := buildActiveConfig(testProfilesPaths, []byte(testProfilesConfig), []byte(testProfilesPrometheusConfig), "hash")
+	if err != nil {
+		t.Fatalf("buildActiveConfig() error = %v", err)
+	}
+
+	runtime := &RuntimeConfigDocument{
+		Version: 1,
+		Config:  RuntimeConfig{Workloads: RuntimeListChanges{Added: []string{"cart"}}},
+	}
+	next, err := cfg.withRuntimeConfig(runtime)
+	if err != nil {
+		t.Fatalf("withRuntimeConfig() error = %v", err)
+	}
+
+	if got, want := next.profiles["search"].ocsConfig.Workload, []string{"app", "cart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search workload = %v, want %v", got, want)
+	}
+	if got, want := next.profiles["payments"].ocsConfig.Workload, []string{"checkout"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payments workload = %v, want %v", got, want)
+	}
+	if got := cfg.profiles["search"].ocsConfig.Workload; !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("withRuntimeConfig() changed the original search workload to %v", got)
+	}
+	if next.profiles["payments"].istioConfigConnector != nil {
+		t.Error("payments has an Istio config connector, want none")
+	}
+}
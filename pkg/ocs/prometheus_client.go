@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultQueryStep is the resolution used for Prometheus range queries
+const defaultQueryStep = "15s"
+
+// PrometheusClient runs PromQL queries against one Prometheus instance
+type PrometheusClient struct {
+	name       string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewPrometheusClient creates a client for the named Prometheus instance
+func NewPrometheusClient(name, baseURL string) *PrometheusClient {
+	return &PrometheusClient{
+		name:    name,
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Query runs a range query if fromTimestamp and toTimestamp are provided, otherwise an instant
+// query. Range results are returned in instant form, with each series' counter increase over
+// the window as its value. Cancelling ctx aborts the request in flight.
+func (pc *PrometheusClient) Query(ctx context.Context, query string, fromTimestamp, toTimestamp *time.Time) (*PrometheusQueryResult, error) {
+	if fromTimestamp != nil && toTimestamp != nil {
+		return pc.queryRange(ctx, query, fromTimestamp, toTimestamp)
+	}
+	return pc.queryInstant(ctx, query)
+}
+
+// queryRange executes a Prometheus range query
+func (pc *PrometheusClient) queryRange(ctx context.Context, query string, fromTimestamp, toTimestamp *time.Time) (*PrometheusQueryResult, error) {
+	start := fromTimestamp.Unix()
+	end := toTimestamp.Unix()
+	step := defaultQueryStep
+
+	queryURL := fmt.Sprintf("%s/api/v1/query_range?query=%s&start=%d&end=%d&step=%s",
+		pc.baseURL, url.QueryEscape(query), start, end, step)
+	log.Printf("Querying Prometheus (range): %s from %s to %s", query, fromTimestamp.Format(time.RFC3339), toTimestamp.Format(time.RFC3339))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Prometheus returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var rangeResult PrometheusQueryRangeResult
+	if err := json.NewDecoder(resp.Body).Decode(&rangeResult); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if rangeResult.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed with status: %s", rangeResult.Status)
+	}
+
+	// Convert range result to instant query result format
+	return pc.convertRangeToInstantResult(&rangeResult), nil
+}
+
+// queryInstant executes a Prometheus instant query
+func (pc *PrometheusClient) queryInstant(ctx context.Context, query string) (*PrometheusQueryResult, error) {
+	queryURL := fmt.Sprintf("%s/api/v1/query?query=%s", pc.baseURL, url.QueryEscape(query))
+	log.Printf("Querying Prometheus (instant): %s", query)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Prometheus returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result PrometheusQueryResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if result.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed with status: %s", result.Status)
+	}
+
+	log.Printf("Retrieved %d results from Prometheus", len(result.Data.Result))
+	return &result, nil
+}
+
+// convertRangeToInstantResult converts a range query result to instant query format
+// by extracting unique source-destination pairs from all time series values
+func (pc *PrometheusClient) convertRangeToInstantResult(rangeResult *PrometheusQueryRangeResult) *PrometheusQueryResult {
+	instantResult := &PrometheusQueryResult{
+		Status: rangeResult.Status,
+	}
+
+	// Use a map to track unique metric combinations
+	uniqueMetrics := make(map[string]struct {
+		Metric   map[string]string
+		Increase float64
+	})
+
+	for _, r := range rangeResult.Data.Result {
+		// Create a key from the metric labels (excluding timestamp values)
+		metricKey := fmt.Sprintf("%v", r.Metric)
+		if _, exists := uniqueMetrics[metricKey]; !exists {
+			uniqueMetrics[metricKey] = struct {
+				Metric   map[string]string
+				Increase float64
+			}{
+				Metric:   r.Metric,
+				Increase: counterIncrease(r.Values),
+			}
+		}
+	}
+
+	// Convert to result format, carrying the counter increase over the window as the value
+	for _, v := range uniqueMetrics {
+		instantResult.Data.Result = append(instantResult.Data.Result, struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}{
+			Metric: v.Metric,
+			Value:  []interface{}{time.Now().Unix(), strconv.FormatFloat(v.Increase, 'f', -1, 64)},
+		})
+	}
+
+	log.Printf("Retrieved %d unique metrics from Prometheus range query", len(instantResult.Data.Result))
+	return instantResult
+}
+
+// sampleValue parses the value of a Prometheus [timestamp, "value"] sample pair
+func sampleValue(sample []interface{}) (float64, bool) {
+	if len(sample) < 2 {
+		return 0, false
+	}
+	str, ok := sample[1].(string)
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// counterIncrease returns how much a counter grew across a range of samples,
+// accounting for counter resets the same way Prometheus' increase() does
+func counterIncrease(values [][]interface{}) float64 {
+	var increase, previous float64
+	seen := false
+	for _, sample := range values {
+		value, ok := sampleValue(sample)
+		if !ok {
+			continue
+		}
+		if seen {
+			if value >= previous {
+				increase += value - previous
+			} else {
+				increase += value
+			}
+		}
+		previous = value
+		seen = true
+	}
+	return increase
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrometheusQueryCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewPrometheusClient("test", server.URL).Query(ctx, "up", nil, nil)
+		done <- err
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Query() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query() did not return after its context was cancelled")
+	}
+}
+
+func TestCounterIncrease(t *testing.T) {
+	samples := func(values ...interface{}) [][]interface{} {
+		var out [][]interface{}
+		for i, value := range values {
+			out = append(out, []interface{}{float64(i * 15), value})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		values [][]interface{}
+		want   float64
+	}{
+		{"steady growth", samples("1", "3", "6"), 5},
+		{"counter reset counts the value after the reset", samples("10", "15", "2", "4"), 9},
+		{"unparsable samples are skipped", samples("1", "NaNx", 7, "4"), 3},
+		{"single sample", samples("42"), 0},
+		{"no samples", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterIncrease(tt.values); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("counterIncrease() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
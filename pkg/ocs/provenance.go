@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// SourceOCSConfig identifies facts that come from ocs_config.yaml rather than a connector
+const SourceOCSConfig = "ocs_config"
+
+// decorateContextDefinitions adds temporal context, origin identity and provenance from the
+// snapshot the definitions were built from. snapshot may be nil if nothing was collected yet.
+func decorateContextDefinitions(contextDefinitions []OCSContextDefinition, snapshot *AdjacencyListDocument, config *OCSConfig) {
+	temporal := buildTemporalContext(snapshot, config)
+
+	for i := range contextDefinitions {
+		def := &contextDefinitions[i]
+		def.Temporal = temporal
+
+		// Graph nodes are observed if they appear in the topology; derived resources such as
+		// namespaces only exist because a snapshot reported them
+		observed := snapshot != nil
+		if def.node != "" {
+			observed = observed && hasWorkload(snapshot.AdjacencyList, def.node)
+		}
+		identitySources := addOriginIdentity(def.Identity, def.node, observed, snapshot, config)
+		def.Provenance = buildProvenance(def, identitySources, snapshot)
+	}
+}
+
+// addOriginIdentity adds where a workload runs and where its data was collected from to the
+// identity map, and returns the source of each added key
+func addOriginIdentity(identity map[string]interface{}, node string, observed bool, snapshot *AdjacencyListDocument, config *OCSConfig) map[string]string {
+	sources := make(map[string]string)
+	set := func(key, value, source string) {
+		if value == "" {
+			return
+		}
+		identity[key] = value
+		sources[key] = source
+	}
+
+	if observed {
+		connector := nodeSource(snapshot, node)
+		origin := snapshot.WorkloadOrigins[node]
+		set("namespace", origin.Namespace, connector)
+		set("cluster", origin.Cluster, connector)
+		set("prometheus_instance", snapshot.PrometheusInstance, connector)
+		set("collection_source", connector, connector)
+	} else {
+		set("collection_source", SourceOCSConfig, SourceOCSConfig)
+	}
+
+	if _, hasCluster := identity["cluster"]; !hasCluster {
+		set("cluster", config.Identity.Cluster, SourceOCSConfig)
+	}
+	set("mesh_id", config.Identity.MeshID, SourceOCSConfig)
+	set("environment", config.Identity.Environment, SourceOCSConfig)
+
+	return sources
+}
+
+// buildProvenance records which connector and snapshot document produced each fact in a definition
+func buildProvenance(def *OCSContextDefinition, identitySources map[string]string, snapshot *AdjacencyListDocument) []ProvenanceEntry {
+	var provenance []ProvenanceEntry
+
+	snapshotID := ""
+	if snapshot != nil {
+		snapshotID = snapshot.ID.Hex()
+	}
+	fromSource := func(fact, source string) ProvenanceEntry {
+		entry := ProvenanceEntry{Fact: fact, Source: source}
+		if source != SourceOCSConfig {
+			entry.SnapshotID = snapshotID
+		}
+		return entry
+	}
+
+	keys := make([]string, 0, len(identitySources))
+	for key := range identitySources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		provenance = append(provenance, fromSource("identity."+key, identitySources[key]))
+	}
+
+	if len(def.Topology) > 0 {
+		provenance = append(provenance, fromSource("topology", nodeSource(snapshot, def.node)))
+	}
+	if _, ok := def.Topology["dependency_attributes"]; ok {
+		provenance = append(provenance, fromSource("topology.dependency_attributes", snapshotSource(snapshot)))
+	}
+	if _, ok := def.Topology["dependency_policies"]; ok {
+		provenance = append(provenance, fromSource("topology.dependency_policies", ConnectorIstioConfig))
+	}
+	if len(def.Attributes) > 0 {
+		provenance = append(provenance, fromSource("attributes", nodeSource(snapshot, def.node)))
+	}
+	if len(def.ObservedMetrics) > 0 {
+		provenance = append(provenance, fromSource("observed_metrics", nodeSource(snapshot, def.node)))
+	}
+	if def.Kubernetes != nil {
+		provenance = append(provenance, fromSource("kubernetes", ConnectorKubernetes))
+	}
+	if def.Temporal != nil {
+		provenance = append(provenance, fromSource("temporal", snapshotSource(snapshot)))
+	}
+	if len(def.Metrics) > 0 {
+		provenance = append(provenance, fromSource("metrics", SourceOCSConfig))
+	}
+	if len(def.Policy) > 0 {
+		provenance = append(provenance, fromSource("policy", SourceOCSConfig))
+	}
+
+	return provenance
+}
+
+// snapshotSource returns the connector that produced a snapshot. Snapshots stored before the
+// connector was recorded were all collected from Istio.
+func snapshotSource(snapshot *AdjacencyListDocument) string {
+	if snapshot == nil || snapshot.Connector == "" {
+		return ConnectorIstio
+	}
+	return snapshot.Connector
+}
+
+// nodeSource returns the providers that reported a node, falling back to the snapshot's
+// connector for derived resources and snapshots stored before providers were recorded per node
+func nodeSource(snapshot *AdjacencyListDocument, node string) string {
+	if snapshot != nil && len(snapshot.NodeSources[node]) > 0 {
+		return strings.Join(snapshot.NodeSources[node], ",")
+	}
+	return snapshotSource(snapshot)
+}
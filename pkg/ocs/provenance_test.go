@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProvenanceMergedProviders(t *testing.T) {
+	// The mesh and a static topology both report app -> database; only the static topology
+	// knows database -> cache and the attributes
+	mesh := &fakeProvider{
+		name:          ConnectorIstio,
+		entities:      []Entity{{Name: "app", Type: ResourceTypeWorkload, Namespace: "shop"}},
+		relationships: []Relationship{{Source: "app", Destination: "database"}},
+	}
+	static := &fakeProvider{
+		name:     SourceStatic,
+		entities: []Entity{{Name: "database", Type: ResourceTypeWorkload, Namespace: "shop", Attributes: map[string]interface{}{"engine": "postgres"}}},
+		relationships: []Relationship{
+			{Source: "app", Destination: "database", Attributes: map[string]interface{}{"protocol": "tcp"}},
+			{Source: "database", Destination: "cache"},
+		},
+	}
+	graph, err := collectContextGraph(context.Background(), []ContextProvider{mesh, static}, CollectionRequest{}, nil)
+	if err != nil {
+		t.Fatalf("collectContextGraph() error = %v", err)
+	}
+	snapshot := graph.toSnapshot()
+	snapshot.ID = primitive.NewObjectID()
+	snapshotID := snapshot.ID.Hex()
+
+	definitions := testPromptResponse(&snapshot, testPromptConfig()).ContextDefinitions
+	provenance := make(map[string][]ProvenanceEntry)
+	for _, def := range definitions {
+		provenance[def.ResourceID] = def.Provenance
+	}
+
+	both := "istio,static"
+	fromConfig := func(fact string) ProvenanceEntry { return ProvenanceEntry{Fact: fact, Source: SourceOCSConfig} }
+	fromSnapshot := func(fact, source string) ProvenanceEntry {
+		return ProvenanceEntry{Fact: fact, Source: source, SnapshotID: snapshotID}
+	}
+	want := map[string][]ProvenanceEntry{
+		// A node reported by both providers credits both with its facts
+		"workload-app": {
+			fromSnapshot("identity.collection_source", both),
+			fromConfig("identity.environment"),
+			fromSnapshot("identity.namespace", both),
+			fromSnapshot("topology", both),
+			fromSnapshot("topology.dependency_attributes", both),
+			fromSnapshot("temporal", both),
+			fromConfig("metrics"),
+			fromConfig("policy"),
+		},
+		"workload-database": {
+			fromSnapshot("identity.collection_source", both),
+			fromConfig("identity.environment"),
+			fromSnapshot("identity.namespace", both),
+			fromSnapshot("topology", both),
+			fromSnapshot("attributes", both),
+			fromSnapshot("temporal", both),
+			fromConfig("metrics"),
+			fromConfig("policy"),
+		},
+		// A node only one provider reported credits that provider alone
+		"workload-cache": {
+			fromSnapshot("identity.collection_source", SourceStatic),
+			fromConfig("identity.environment"),
+			fromSnapshot("topology", SourceStatic),
+			fromSnapshot("temporal", both),
+			fromConfig("metrics"),
+			fromConfig("policy"),
+		},
+		// Derived resources credit the providers of the whole snapshot
+		"namespace-shop": {
+			fromSnapshot("identity.collection_source", both),
+			fromConfig("identity.environment"),
+			fromSnapshot("topology", both),
+			fromSnapshot("temporal", both),
+		},
+	}
+	for id, wantProvenance := range want {
+		if got := provenance[id]; !reflect.DeepEqual(got, wantProvenance) {
+			t.Errorf("%s provenance =\n%s\nwant\n%s", id, mustJSON(t, got), mustJSON(t, wantProvenance))
+		}
+	}
+}
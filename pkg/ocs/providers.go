@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContextProvider contributes entities, relationships and metrics to the context graph.
+// Providers are created from the providers list in ocs_config.yaml through the provider registry.
+type ContextProvider interface {
+	// Name identifies the provider, e.g. "istio", and is recorded as the source of its facts
+	Name() string
+	// Instance identifies where the provider reads from, e.g. a Prometheus instance name
+	Instance() string
+	DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error)
+	DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error)
+	FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error)
+}
+
+// ProviderFactory creates the providers of one type from configuration
+type ProviderFactory func(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error)
+
+var (
+	providerFactoriesMu sync.RWMutex
+	providerFactories   = map[string]ProviderFactory{
+		ConnectorIstio:        newIstioProviders,
+		ConnectorLinkerd:      newLinkerdProviders,
+		ConnectorServiceGraph: newServiceGraphProviders,
+		ConnectorKubernetes:   newKubernetesProviders,
+		SourceStatic:          newStaticProviders,
+	}
+)
+
+// RegisterProviderFactory makes a provider type available to the providers list in ocs_config.yaml
+func RegisterProviderFactory(name string, factory ProviderFactory) {
+	providerFactoriesMu.Lock()
+	defer providerFactoriesMu.Unlock()
+	providerFactories[name] = factory
+}
+
+// newProviders creates the configured providers. When none are configured, the connectors
+// selected by the Prometheus instances are used. kubernetes.enabled adds the Kubernetes provider
+// after them unless the list already places it.
+func newProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	names := append([]string(nil), config.Providers...)
+	if len(names) == 0 {
+		for _, instance := range promConfig.PrometheusInstances {
+			names = appendUnique(names, instanceConnector(instance))
+		}
+	}
+	if config.Kubernetes.Enabled {
+		names = appendUnique(names, ConnectorKubernetes)
+	}
+
+	providerFactoriesMu.RLock()
+	defer providerFactoriesMu.RUnlock()
+
+	var providers []ContextProvider
+	for _, name := range names {
+		factory, ok := providerFactories[name]
+		if !ok {
+			registered := make([]string, 0, len(providerFactories))
+			for registeredName := range providerFactories {
+				registered = append(registered, registeredName)
+			}
+			sort.Strings(registered)
+			return nil, fmt.Errorf("unknown provider %q, registered providers: %s", name, strings.Join(registered, ", "))
+		}
+		created, err := factory(config, promConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s provider: %w", name, err)
+		}
+		providers = append(providers, created...)
+	}
+	return providers, nil
+}
+
+// newIstioProviders creates an Istio provider for each Prometheus instance selecting it
+func newIstioProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	instances, err := promConfig.instancesFor(ConnectorIstio)
+	if err != nil {
+		return nil, err
+	}
+	var providers []ContextProvider
+	for _, instance := range instances {
+		providers = append(providers, NewIstioConnector(instance.Name, instance.BaseURL))
+	}
+	return providers, nil
+}
+
+// instanceConnector returns the connector a Prometheus instance is read by
+func instanceConnector(instance PrometheusInstance) string {
+	if instance.Connector == "" {
+		return ConnectorIstio
+	}
+	return instance.Connector
+}
+
+// instancesFor returns the Prometheus instances a provider reads. A provider that no instance
+// selects explicitly reads the first instance without a connector.
+func (c *PrometheusConfig) instancesFor(provider string) ([]PrometheusInstance, error) {
+	var instances []PrometheusInstance
+	for _, instance := range c.PrometheusInstances {
+		if instanceConnector(instance) == provider {
+			instances = append(instances, instance)
+		}
+	}
+	if len(instances) > 0 {
+		return instances, nil
+	}
+	for _, instance := range c.PrometheusInstances {
+		if instance.Connector == "" {
+			return []PrometheusInstance{instance}, nil
+		}
+	}
+	return nil, fmt.Errorf("no Prometheus instance configured for %s", provider)
+}
+
+// CollectionRequest describes what providers should collect
+type CollectionRequest struct {
+	Workloads []string
+	From      *time.Time
+	To        *time.Time
+	// StartedAt is when the collection began, which tells instant collections apart
+	StartedAt time.Time
+	// Historical is set for backfill buckets, which providers describing only the present skip
+	Historical bool
+}
+
+// collectionChunkSize is the longest range a provider queries at once. Longer collections are
+// split so that no single Prometheus query runs into the client timeout.
+const collectionChunkSize = time.Hour
+
+// chunks splits a range request into consecutive requests of at most size. Instant requests are
+// returned as they are.
+func (r CollectionRequest) chunks(size time.Duration) []CollectionRequest {
+	if r.From == nil || r.To == nil || r.To.Sub(*r.From) <= size {
+		return []CollectionRequest{r}
+	}
+	var chunks []CollectionRequest
+	for start := *r.From; start.Before(*r.To); start = start.Add(size) {
+		from, to := start, start.Add(size)
+		if to.After(*r.To) {
+			to = *r.To
+		}
+		chunk := r
+		chunk.From, chunk.To = &from, &to
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// collectionProgress is told when a provider, by its index, has finished done of its chunks.
+// It is called with done 0 when the provider starts.
+type collectionProgress func(provider, done, total int)
+
+// key identifies a collection request, so providers can reuse one query across discovery calls
+func (r CollectionRequest) key() string {
+	var from, to int64
+	if r.From != nil && r.To != nil {
+		from, to = r.From.Unix(), r.To.Unix()
+	}
+	return fmt.Sprintf("%s|%d|%d|%d", strings.Join(r.Workloads, ","), from, to, r.StartedAt.UnixNano())
+}
+
+// Entity represents a node contributed by a provider
+type Entity struct {
+	Name      string
+	Type      string // Resource type, e.g. workload, external_host or service
+	Namespace string
+	Cluster   string
+	// Members lists the workloads backing a service entity
+	Members    []string
+	Attributes map[string]interface{}
+	// Kubernetes carries a workload's Kubernetes metadata. Such entities describe the workload
+	// without adding it as a node.
+	Kubernetes *KubernetesWorkload
+}
+
+// Relationship represents a directed source -> destination edge contributed by a provider
+type Relationship struct {
+	Source      string
+	Destination string
+	// Traffic is the observed request volume along the edge, nil if unknown
+	Traffic    *float64
+	Attributes map[string]interface{}
+}
+
+// MetricSample represents a metric value a provider observed for an entity
+type MetricSample struct {
+	Entity string
+	Metric string
+	Value  float64
+}
+
+// ContextGraph holds the merged output of every provider for one collection
+type ContextGraph struct {
+	AdjacencyList    map[string][]string
+	EdgeTraffic      map[string]map[string]float64
+	WorkloadOrigins  map[string]WorkloadOrigin
+	Services         map[string][]string
+	ExternalHosts    []string
+	EntityAttributes map[string]map[string]interface{}
+	EdgeAttributes   map[string]map[string]map[string]interface{}
+	MetricValues     map[string]map[string]float64
+	NodeSources      map[string][]string
+	Providers        []string
+	Instances        []string
+	// KubernetesWorkloads holds Kubernetes metadata keyed by namespace/name
+	KubernetesWorkloads map[string]KubernetesWorkload
+}
+
+// collectContextGraph runs every provider and merges their entities, relationships and metrics.
+// Any provider failing fails the collection, so a snapshot never silently misses a provider.
+// Providers reading from a Prometheus instance collect long ranges in chunks. Cancelling ctx
+// aborts the queries in flight and stops the collection. progress may be nil.
+func collectContextGraph(ctx context.Context, providers []ContextProvider, req CollectionRequest, progress collectionProgress) (*ContextGraph, error) {
+	graph := &ContextGraph{
+		AdjacencyList:    make(map[string][]string),
+		EdgeTraffic:      make(map[string]map[string]float64),
+		WorkloadOrigins:  make(map[string]WorkloadOrigin),
+		Services:         make(map[string][]string),
+		EntityAttributes: make(map[string]map[string]interface{}),
+		EdgeAttributes:   make(map[string]map[string]map[string]interface{}),
+		MetricValues:     make(map[string]map[string]float64),
+		NodeSources:      make(map[string][]string),
+	}
+	if progress == nil {
+		progress = func(provider, done, total int) {}
+	}
+
+	for i, provider := range providers {
+		chunks := providerChunks(provider, req)
+		progress(i, 0, len(chunks))
+
+		var entities []Entity
+		var relationships []Relationship
+		var metrics []MetricSample
+		for done, chunk := range chunks {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			chunkEntities, err := provider.DiscoverEntities(ctx, chunk)
+			if err != nil {
+				return nil, fmt.Errorf("%s provider failed to discover entities: %w", provider.Name(), err)
+			}
+			chunkRelationships, err := provider.DiscoverRelationships(ctx, chunk)
+			if err != nil {
+				return nil, fmt.Errorf("%s provider failed to discover relationships: %w", provider.Name(), err)
+			}
+			chunkMetrics, err := provider.FetchMetrics(ctx, chunk)
+			if err != nil {
+				return nil, fmt.Errorf("%s provider failed to fetch metrics: %w", provider.Name(), err)
+			}
+			entities = append(entities, chunkEntities...)
+			relationships = append(relationships, chunkRelationships...)
+			metrics = append(metrics, chunkMetrics...)
+			progress(i, done+1, len(chunks))
+		}
+		if len(chunks) > 1 {
+			relationships = sumChunkTraffic(relationships)
+			metrics = combineChunkMetrics(metrics)
+		}
+
+		graph.mergeEntities(provider.Name(), entities)
+		graph.mergeRelationships(provider.Name(), relationships)
+		graph.mergeMetrics(metrics)
+		graph.Providers = appendUnique(graph.Providers, provider.Name())
+		if instance := provider.Instance(); instance != "" {
+			graph.Instances = appendUnique(graph.Instances, instance)
+		}
+		log.Printf("Provider %s contributed %d entities, %d relationships and %d metric samples in %d chunks",
+			provider.Name(), len(entities), len(relationships), len(metrics), len(chunks))
+	}
+
+	sort.Strings(graph.ExternalHosts)
+	return graph, nil
+}
+
+// providerChunks returns the requests a provider collects: chunks of the range for providers
+// reading from a Prometheus instance, and the whole request for the others, whose output does
+// not depend on the range
+func providerChunks(provider ContextProvider, req CollectionRequest) []CollectionRequest {
+	if provider.Instance() == "" {
+		return []CollectionRequest{req}
+	}
+	return req.chunks(collectionChunkSize)
+}
+
+// sumChunkTraffic combines the relationships a provider found in each chunk into one per edge,
+// adding up their traffic. Other attributes are taken from the first chunk seeing the edge.
+func sumChunkTraffic(relationships []Relationship) []Relationship {
+	var combined []Relationship
+	index := make(map[[2]string]int)
+	for _, rel := range relationships {
+		edge := [2]string{rel.Source, rel.Destination}
+		i, ok := index[edge]
+		if !ok {
+			index[edge] = len(combined)
+			combined = append(combined, rel)
+			continue
+		}
+		if rel.Traffic != nil {
+			total := *rel.Traffic
+			if combined[i].Traffic != nil {
+				total += *combined[i].Traffic
+			}
+			combined[i].Traffic = &total
+		}
+	}
+	return combined
+}
+
+// combineChunkMetrics combines the samples a provider took in each chunk into one per entity and
+// metric. Counts, named *_total as in Prometheus, are added up; other values such as ratios and
+// latencies are averaged over the chunks, which approximates their value over the whole range.
+func combineChunkMetrics(samples []MetricSample) []MetricSample {
+	var combined []MetricSample
+	counts := make(map[[2]string]int)
+	index := make(map[[2]string]int)
+	for _, sample := range samples {
+		key := [2]string{sample.Entity, sample.Metric}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(combined)
+			counts[key] = 1
+			combined = append(combined, sample)
+			continue
+		}
+		counts[key]++
+		if strings.HasSuffix(sample.Metric, "_total") {
+			combined[i].Value += sample.Value
+		} else {
+			combined[i].Value += (sample.Value - combined[i].Value) / float64(counts[key])
+		}
+	}
+	return combined
+}
+
+// mergeEntities adds entities to the graph. Earlier providers win for origin fields; attributes
+// from later providers are added alongside. Kubernetes metadata is kept by namespace/name without
+// adding a node.
+func (g *ContextGraph) mergeEntities(provider string, entities []Entity) {
+	for _, entity := range entities {
+		if entity.Kubernetes != nil {
+			if g.KubernetesWorkloads == nil {
+				g.KubernetesWorkloads = make(map[string]KubernetesWorkload)
+			}
+			g.KubernetesWorkloads[kubernetesWorkloadKey(entity.Namespace, entity.Name)] = *entity.Kubernetes
+			continue
+		}
+		switch entity.Type {
+		case ResourceTypeService:
+			for _, member := range entity.Members {
+				g.Services[entity.Name] = appendUnique(g.Services[entity.Name], member)
+			}
+			continue
+		case ResourceTypeExternalHost:
+			g.ExternalHosts = appendUnique(g.ExternalHosts, entity.Name)
+		}
+
+		g.NodeSources[entity.Name] = appendUnique(g.NodeSources[entity.Name], provider)
+
+		origin := g.WorkloadOrigins[entity.Name]
+		if origin.Namespace == "" {
+			origin.Namespace = entity.Namespace
+		}
+		if origin.Cluster == "" {
+			origin.Cluster = entity.Cluster
+		}
+		if origin != (WorkloadOrigin{}) {
+			g.WorkloadOrigins[entity.Name] = origin
+		}
+
+		for key, value := range entity.Attributes {
+			if g.EntityAttributes[entity.Name] == nil {
+				g.EntityAttributes[entity.Name] = make(map[string]interface{})
+			}
+			if _, exists := g.EntityAttributes[entity.Name][key]; !exists {
+				g.EntityAttributes[entity.Name][key] = value
+			}
+		}
+	}
+}
+
+// mergeRelationships adds edges to the graph. When several providers observe the same edge,
+// they usually see the same requests, so the first provider's traffic is kept.
+func (g *ContextGraph) mergeRelationships(provider string, relationships []Relationship) {
+	for _, rel := range relationships {
+		if !hasEdge(g.AdjacencyList, rel.Source, rel.Destination) {
+			g.AdjacencyList[rel.Source] = append(g.AdjacencyList[rel.Source], rel.Destination)
+		}
+		g.NodeSources[rel.Source] = appendUnique(g.NodeSources[rel.Source], provider)
+		g.NodeSources[rel.Destination] = appendUnique(g.NodeSources[rel.Destination], provider)
+
+		if rel.Traffic != nil {
+			if g.EdgeTraffic[rel.Source] == nil {
+				g.EdgeTraffic[rel.Source] = make(map[string]float64)
+			}
+			if _, exists := g.EdgeTraffic[rel.Source][rel.Destination]; !exists {
+				g.EdgeTraffic[rel.Source][rel.Destination] = *rel.Traffic
+			}
+		}
+
+		for key, value := range rel.Attributes {
+			if g.EdgeAttributes[rel.Source] == nil {
+				g.EdgeAttributes[rel.Source] = make(map[string]map[string]interface{})
+			}
+			if g.EdgeAttributes[rel.Source][rel.Destination] == nil {
+				g.EdgeAttributes[rel.Source][rel.Destination] = make(map[string]interface{})
+			}
+			if _, exists := g.EdgeAttributes[rel.Source][rel.Destination][key]; !exists {
+				g.EdgeAttributes[rel.Source][rel.Destination][key] = value
+			}
+		}
+	}
+}
+
+// mergeMetrics adds metric samples to the graph, keeping the first value for each entity and metric
+func (g *ContextGraph) mergeMetrics(samples []MetricSample) {
+	for _, sample := range samples {
+		if g.MetricValues[sample.Entity] == nil {
+			g.MetricValues[sample.Entity] = make(map[string]float64)
+		}
+		if _, exists := g.MetricValues[sample.Entity][sample.Metric]; !exists {
+			g.MetricValues[sample.Entity][sample.Metric] = sample.Value
+		}
+	}
+}
+
+// toSnapshot converts the merged graph into a topology snapshot document
+func (g *ContextGraph) toSnapshot() AdjacencyListDocument {
+	return AdjacencyListDocument{
+		AdjacencyList:       g.AdjacencyList,
+		EdgeTraffic:         g.EdgeTraffic,
+		Connector:           strings.Join(g.Providers, ","),
+		PrometheusInstance:  strings.Join(g.Instances, ","),
+		WorkloadOrigins:     g.WorkloadOrigins,
+		Services:            g.Services,
+		ExternalHosts:       g.ExternalHosts,
+		EntityAttributes:    g.EntityAttributes,
+		EdgeAttributes:      g.EdgeAttributes,
+		MetricValues:        g.MetricValues,
+		NodeSources:         g.NodeSources,
+		KubernetesWorkloads: g.KubernetesWorkloads,
+	}
+}
+
+// appendUnique appends value to values unless it is already present
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeProvider returns fixed entities and relationships
+type fakeProvider struct {
+	name          string
+	entities      []Entity
+	relationships []Relationship
+}
+
+func (fp *fakeProvider) Name() string     { return fp.name }
+func (fp *fakeProvider) Instance() string { return "" }
+
+func (fp *fakeProvider) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	return fp.entities, nil
+}
+
+func (fp *fakeProvider) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	return fp.relationships, nil
+}
+
+func (fp *fakeProvider) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	return nil, nil
+}
+
+func TestCollectContextGraphKubernetesMetadata(t *testing.T) {
+	mesh := &fakeProvider{
+		name:          ConnectorIstio,
+		entities:      []Entity{{Name: "app", Type: ResourceTypeWorkload, Namespace: "shop"}},
+		relationships: []Relationship{{Source: "app", Destination: "database"}},
+	}
+	kubernetes := &fakeProvider{
+		name: ConnectorKubernetes,
+		entities: []Entity{
+			{Name: "app", Type: ResourceTypeWorkload, Namespace: "shop", Kubernetes: &KubernetesWorkload{Kind: "Deployment", Name: "app", Namespace: "shop"}},
+			{Name: "batch", Type: ResourceTypeWorkload, Namespace: "jobs", Kubernetes: &KubernetesWorkload{Kind: "StatefulSet", Name: "batch", Namespace: "jobs"}},
+		},
+	}
+
+	graph, err := collectContextGraph(context.Background(), []ContextProvider{mesh, kubernetes}, CollectionRequest{}, nil)
+	if err != nil {
+		t.Fatalf("collectContextGraph() error = %v", err)
+	}
+	if len(graph.KubernetesWorkloads) != 2 || graph.KubernetesWorkloads["shop/app"].Kind != "Deployment" {
+		t.Errorf("KubernetesWorkloads = %s", mustJSON(t, graph.KubernetesWorkloads))
+	}
+	if _, ok := graph.NodeSources["batch"]; ok {
+		t.Error("Kubernetes metadata added batch as a node")
+	}
+	if got := graph.NodeSources["app"]; len(got) != 1 || got[0] != ConnectorIstio {
+		t.Errorf("app node sources = %v, want [istio]", got)
+	}
+	if got := graph.toSnapshot().Connector; got != "istio,kubernetes" {
+		t.Errorf("snapshot connector = %q", got)
+	}
+}
+
+func TestCollectContextGraphCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := collectContextGraph(ctx, []ContextProvider{&fakeProvider{name: ConnectorIstio}}, CollectionRequest{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("collectContextGraph() error = %v, want context.Canceled", err)
+	}
+}
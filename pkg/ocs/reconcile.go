@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceCatalog represents a service catalog file declaring expected dependencies
+type serviceCatalog struct {
+	Services []struct {
+		Name      string   `yaml:"name"`
+		DependsOn []string `yaml:"depends_on"`
+	} `yaml:"services"`
+}
+
+// loadDeclaredTopology merges the declared_dependencies from config with the service catalog
+// file, if one is configured. YAML and JSON catalogs are both accepted.
+func loadDeclaredTopology(config *OCSConfig) (map[string][]string, error) {
+	declared := make(map[string][]string)
+	add := func(source string, destinations []string) {
+		if _, exists := declared[source]; !exists {
+			declared[source] = []string{}
+		}
+		for _, dest := range destinations {
+			if !hasEdge(declared, source, dest) {
+				declared[source] = append(declared[source], dest)
+			}
+		}
+	}
+
+	for source, destinations := range config.DeclaredDependencies {
+		add(source, destinations)
+	}
+
+	if config.ServiceCatalog != "" {
+		data, err := os.ReadFile(config.ServiceCatalog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service catalog: %w", err)
+		}
+		var catalog serviceCatalog
+		if err := yaml.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse service catalog: %w", err)
+		}
+		for _, service := range catalog.Services {
+			add(service.Name, service.DependsOn)
+		}
+	}
+
+	return declared, nil
+}
+
+// reconcileTopology compares declared dependencies with the observed adjacency list. Workloads
+// are unknown when observed but neither declared nor listed in config.
+func reconcileTopology(declared, observed map[string][]string, configWorkloads []string) TopologyReconciliation {
+	reconciliation := TopologyReconciliation{
+		Declared:         len(declared) > 0,
+		UndeclaredEdges:  []Edge{},
+		UnobservedEdges:  []Edge{},
+		UnknownWorkloads: []string{},
+	}
+	if !reconciliation.Declared {
+		return reconciliation
+	}
+
+	for source, destinations := range observed {
+		for _, dest := range destinations {
+			if !hasEdge(declared, source, dest) {
+				reconciliation.UndeclaredEdges = append(reconciliation.UndeclaredEdges, Edge{Source: source, Destination: dest})
+			}
+		}
+	}
+	for source, destinations := range declared {
+		for _, dest := range destinations {
+			if !hasEdge(observed, source, dest) {
+				reconciliation.UnobservedEdges = append(reconciliation.UnobservedEdges, Edge{Source: source, Destination: dest})
+			}
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, workload := range configWorkloads {
+		known[workload] = true
+	}
+	for source, destinations := range declared {
+		known[source] = true
+		for _, dest := range destinations {
+			known[dest] = true
+		}
+	}
+	unknown := make(map[string]bool)
+	for source, destinations := range observed {
+		for _, node := range append([]string{source}, destinations...) {
+			if !known[node] {
+				unknown[node] = true
+			}
+		}
+	}
+	for node := range unknown {
+		reconciliation.UnknownWorkloads = append(reconciliation.UnknownWorkloads, node)
+	}
+
+	sortEdges(reconciliation.UndeclaredEdges)
+	sortEdges(reconciliation.UnobservedEdges)
+	sort.Strings(reconciliation.UnknownWorkloads)
+	return reconciliation
+}
+
+// annotateReconciliation flags each graph node's topology with its undeclared and unobserved
+// dependencies and whether the workload itself is unknown
+func annotateReconciliation(contextDefinitions []OCSContextDefinition, reconciliation TopologyReconciliation) {
+	if !reconciliation.Declared {
+		return
+	}
+
+	undeclared := make(map[string][]string)
+	for _, edge := range reconciliation.UndeclaredEdges {
+		undeclared[edge.Source] = append(undeclared[edge.Source], edge.Destination)
+	}
+	unobserved := make(map[string][]string)
+	for _, edge := range reconciliation.UnobservedEdges {
+		unobserved[edge.Source] = append(unobserved[edge.Source], edge.Destination)
+	}
+	unknown := make(map[string]bool)
+	for _, workload := range reconciliation.UnknownWorkloads {
+		unknown[workload] = true
+	}
+
+	for i := range contextDefinitions {
+		def := &contextDefinitions[i]
+		if def.node == "" {
+			continue
+		}
+		flags := make(map[string]interface{})
+		if len(undeclared[def.node]) > 0 {
+			flags["undeclared_dependencies"] = undeclared[def.node]
+		}
+		if len(unobserved[def.node]) > 0 {
+			flags["unobserved_dependencies"] = unobserved[def.node]
+		}
+		if unknown[def.node] {
+			flags["unknown_workload"] = true
+		}
+		if len(flags) == 0 {
+			continue
+		}
+		if def.Topology == nil {
+			def.Topology = make(map[string]interface{})
+		}
+		for key, value := range flags {
+			def.Topology[key] = value
+		}
+	}
+}
+
+// sortEdges orders edges by source, then destination
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Destination < edges[j].Destination
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileTopology(t *testing.T) {
+	tests := []struct {
+		name            string
+		declared        map[string][]string
+		observed        map[string][]string
+		configWorkloads []string
+		want            TopologyReconciliation
+	}{
+		{
+			name:     "nothing declared",
+			observed: map[string][]string{"app": {"database"}},
+			want:     TopologyReconciliation{UndeclaredEdges: []Edge{}, UnobservedEdges: []Edge{}, UnknownWorkloads: []string{}},
+		},
+		{
+			name:     "matching edges",
+			declared: map[string][]string{"app": {"database", "cache"}},
+			observed: map[string][]string{"app": {"cache", "database"}},
+			want:     TopologyReconciliation{Declared: true, UndeclaredEdges: []Edge{}, UnobservedEdges: []Edge{}, UnknownWorkloads: []string{}},
+		},
+		{
+			name:     "declared but unobserved",
+			declared: map[string][]string{"app": {"database", "cache"}, "worker": {"queue"}},
+			observed: map[string][]string{"app": {"database"}},
+			want: TopologyReconciliation{
+				Declared:         true,
+				UndeclaredEdges:  []Edge{},
+				UnobservedEdges:  []Edge{{Source: "app", Destination: "cache"}, {Source: "worker", Destination: "queue"}},
+				UnknownWorkloads: []string{},
+			},
+		},
+		{
+			name:            "observed but undeclared",
+			declared:        map[string][]string{"app": {"database"}},
+			observed:        map[string][]string{"app": {"database", "payments"}, "cron": {"database"}},
+			configWorkloads: []string{"cron"},
+			want: TopologyReconciliation{
+				Declared:         true,
+				UndeclaredEdges:  []Edge{{Source: "app", Destination: "payments"}, {Source: "cron", Destination: "database"}},
+				UnobservedEdges:  []Edge{},
+				UnknownWorkloads: []string{"payments"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconcileTopology(tt.declared, tt.observed, tt.configWorkloads)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reconcileTopology() = %s, want %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestLoadDeclaredTopology(t *testing.T) {
+	catalog := filepath.Join(t.TempDir(), "catalog.yaml")
+	data := `services:
+  - name: app
+    depends_on: [database, cache]
+  - name: worker
+    depends_on: [queue]
+`
+	if err := os.WriteFile(catalog, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	declared, err := loadDeclaredTopology(&OCSConfig{
+		DeclaredDependencies: map[string][]string{"app": {"database"}},
+		ServiceCatalog:       catalog,
+	})
+	if err != nil {
+		t.Fatalf("loadDeclaredTopology() error = %v", err)
+	}
+	want := map[string][]string{"app": {"database", "cache"}, "worker": {"queue"}}
+	if !reflect.DeepEqual(declared, want) {
+		t.Errorf("loadDeclaredTopology() = %v, want %v", declared, want)
+	}
+}
+
+func TestAnnotateReconciliation(t *testing.T) {
+	definitions := []OCSContextDefinition{{node: "app"}, {node: "payments"}, {node: "database"}}
+	annotateReconciliation(definitions, TopologyReconciliation{
+		Declared:         true,
+		UndeclaredEdges:  []Edge{{Source: "app", Destination: "payments"}},
+		UnobservedEdges:  []Edge{{Source: "app", Destination: "cache"}},
+		UnknownWorkloads: []string{"payments"},
+	})
+
+	want := map[string]interface{}{"undeclared_dependencies": []string{"payments"}, "unobserved_dependencies": []string{"cache"}}
+	if !reflect.DeepEqual(definitions[0].Topology, want) {
+		t.Errorf("app topology = %v, want %v", definitions[0].Topology, want)
+	}
+	if !reflect.DeepEqual(definitions[1].Topology, map[string]interface{}{"unknown_workload": true}) {
+		t.Errorf("payments topology = %v, want it flagged unknown", definitions[1].Topology)
+	}
+	if definitions[2].Topology != nil {
+		t.Errorf("database topology = %v, want none", definitions[2].Topology)
+	}
+}
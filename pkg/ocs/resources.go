@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Resource types that context definitions can describe
+const (
+	ResourceTypeWorkload     = "workload"
+	ResourceTypeDatabase     = "database"
+	ResourceTypeExternalHost = "external_host"
+	ResourceTypeService      = "service"
+	ResourceTypeNamespace    = "namespace"
+	ResourceTypeCluster      = "cluster"
+)
+
+// defaultResourceTypes holds the domain and ID scheme of each resource type when
+// resource_types in ocs_config.yaml does not override it
+var defaultResourceTypes = map[string]ResourceTypeConfig{
+	ResourceTypeWorkload:     {Domain: "compute.k8s", IDTemplate: "workload-{name}"},
+	ResourceTypeDatabase:     {Domain: "data.database", IDTemplate: "database-{name}"},
+	ResourceTypeExternalHost: {Domain: "network.external", IDTemplate: "external-{name}"},
+	ResourceTypeService:      {Domain: "network.k8s", IDTemplate: "service-{name}"},
+	ResourceTypeNamespace:    {Domain: "tenancy.k8s", IDTemplate: "namespace-{name}"},
+	ResourceTypeCluster:      {Domain: "infrastructure.k8s", IDTemplate: "cluster-{name}"},
+}
+
+// resourceType returns the configured domain and ID scheme for a resource type, falling back
+// to the defaults for any field left unset
+func (c *OCSConfig) resourceType(name string) ResourceTypeConfig {
+	resolved := defaultResourceTypes[name]
+	if configured, ok := c.ResourceTypes[name]; ok {
+		if configured.Domain != "" {
+			resolved.Domain = configured.Domain
+		}
+		if configured.IDTemplate != "" {
+			resolved.IDTemplate = configured.IDTemplate
+		}
+		resolved.Workloads = configured.Workloads
+	}
+	return resolved
+}
+
+// resourceTypeEnabled reports whether definitions should be emitted for a derived resource
+// type. Services, namespaces and clusters are only described when listed in resource_types.
+func (c *OCSConfig) resourceTypeEnabled(name string) bool {
+	_, ok := c.ResourceTypes[name]
+	return ok
+}
+
+// classifyNode returns the resource type of a node in the topology graph
+func classifyNode(snapshot *AdjacencyListDocument, config *OCSConfig, node string) string {
+	for _, database := range config.resourceType(ResourceTypeDatabase).Workloads {
+		if database == node {
+			return ResourceTypeDatabase
+		}
+	}
+	if snapshot != nil {
+		for _, host := range snapshot.ExternalHosts {
+			if host == node {
+				return ResourceTypeExternalHost
+			}
+		}
+	}
+	return ResourceTypeWorkload
+}
+
+// resourceID renders a resource type's ID template. Supported placeholders are {name},
+// {namespace} and {cluster}.
+func resourceID(resourceType ResourceTypeConfig, name, namespace, cluster string) string {
+	return strings.NewReplacer(
+		"{name}", name,
+		"{namespace}", namespace,
+		"{cluster}", cluster,
+	).Replace(resourceType.IDTemplate)
+}
+
+// buildDerivedContextDefinitions builds context definitions for the services, namespaces and
+// clusters seen in a snapshot, for whichever of those resource types are enabled
+func buildDerivedContextDefinitions(snapshot *AdjacencyListDocument, config *OCSConfig) []OCSContextDefinition {
+	var contextDefinitions []OCSContextDefinition
+	if snapshot == nil {
+		return contextDefinitions
+	}
+
+	if config.resourceTypeEnabled(ResourceTypeService) {
+		resourceType := config.resourceType(ResourceTypeService)
+		for service, workloads := range snapshot.Services {
+			contextDefinitions = append(contextDefinitions, OCSContextDefinition{
+				ResourceID: resourceID(resourceType, service, "", ""),
+				Domain:     resourceType.Domain,
+				Identity: map[string]interface{}{
+					"service":       service,
+					"resource_type": ResourceTypeService,
+				},
+				Topology: map[string]interface{}{
+					"workloads": sortedCopy(workloads),
+				},
+			})
+		}
+	}
+
+	// Group workloads by namespace and namespaces by cluster from the observed origins
+	namespaces := make(map[string][]string)
+	clusters := make(map[string]map[string]bool)
+	namespaceClusters := make(map[string]string)
+	for workload, origin := range snapshot.WorkloadOrigins {
+		if origin.Namespace != "" {
+			namespaces[origin.Namespace] = append(namespaces[origin.Namespace], workload)
+			if origin.Cluster != "" {
+				namespaceClusters[origin.Namespace] = origin.Cluster
+			}
+		}
+		if origin.Cluster != "" {
+			if clusters[origin.Cluster] == nil {
+				clusters[origin.Cluster] = make(map[string]bool)
+			}
+			if origin.Namespace != "" {
+				clusters[origin.Cluster][origin.Namespace] = true
+			}
+		}
+	}
+
+	if config.resourceTypeEnabled(ResourceTypeNamespace) {
+		resourceType := config.resourceType(ResourceTypeNamespace)
+		for namespace, workloads := range namespaces {
+			cluster := namespaceClusters[namespace]
+			identity := map[string]interface{}{
+				"namespace":     namespace,
+				"resource_type": ResourceTypeNamespace,
+			}
+			if cluster != "" {
+				identity["cluster"] = cluster
+			}
+			contextDefinitions = append(contextDefinitions, OCSContextDefinition{
+				ResourceID: resourceID(resourceType, namespace, namespace, cluster),
+				Domain:     resourceType.Domain,
+				Identity:   identity,
+				Topology: map[string]interface{}{
+					"workloads": sortedCopy(workloads),
+				},
+			})
+		}
+	}
+
+	if config.resourceTypeEnabled(ResourceTypeCluster) {
+		resourceType := config.resourceType(ResourceTypeCluster)
+		for cluster, namespaceSet := range clusters {
+			clusterNamespaces := make([]string, 0, len(namespaceSet))
+			for namespace := range namespaceSet {
+				clusterNamespaces = append(clusterNamespaces, namespace)
+			}
+			sort.Strings(clusterNamespaces)
+
+			contextDef := OCSContextDefinition{
+				ResourceID: resourceID(resourceType, cluster, "", cluster),
+				Domain:     resourceType.Domain,
+				Identity: map[string]interface{}{
+					"cluster":       cluster,
+					"resource_type": ResourceTypeCluster,
+				},
+			}
+			if len(clusterNamespaces) > 0 {
+				contextDef.Topology = map[string]interface{}{
+					"namespaces": clusterNamespaces,
+				}
+			}
+			contextDefinitions = append(contextDefinitions, contextDef)
+		}
+	}
+
+	return contextDefinitions
+}
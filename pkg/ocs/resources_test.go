@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContextDefinitionResourceIDs(t *testing.T) {
+	snapshot := &AdjacencyListDocument{
+		AdjacencyList: map[string][]string{"app": {"database", "api.example.com"}},
+		ExternalHosts: []string{"api.example.com"},
+		WorkloadOrigins: map[string]WorkloadOrigin{
+			"app":      {Namespace: "shop", Cluster: "east"},
+			"database": {Namespace: "data", Cluster: "east"},
+		},
+		Services: map[string][]string{"checkout": {"app"}},
+	}
+
+	tests := []struct {
+		name          string
+		resourceTypes map[string]ResourceTypeConfig
+		workloads     []string
+		want          map[string]string // resource ID -> domain
+	}{
+		{
+			name: "defaults describe graph nodes only",
+			want: map[string]string{
+				"workload-app":             "compute.k8s",
+				"workload-database":        "compute.k8s",
+				"external-api.example.com": "network.external",
+			},
+		},
+		{
+			name:          "configured databases",
+			resourceTypes: map[string]ResourceTypeConfig{ResourceTypeDatabase: {Workloads: []string{"database"}}},
+			want: map[string]string{
+				"workload-app":             "compute.k8s",
+				"database-database":        "data.database",
+				"external-api.example.com": "network.external",
+			},
+		},
+		{
+			name: "derived resource types",
+			resourceTypes: map[string]ResourceTypeConfig{
+				ResourceTypeService: {}, ResourceTypeNamespace: {}, ResourceTypeCluster: {},
+			},
+			want: map[string]string{
+				"workload-app":             "compute.k8s",
+				"workload-database":        "compute.k8s",
+				"external-api.example.com": "network.external",
+				"service-checkout":         "network.k8s",
+				"namespace-shop":           "tenancy.k8s",
+				"namespace-data":           "tenancy.k8s",
+				"cluster-east":             "infrastructure.k8s",
+			},
+		},
+		{
+			name: "templates and domains override the defaults",
+			resourceTypes: map[string]ResourceTypeConfig{
+				ResourceTypeWorkload:     {IDTemplate: "{cluster}/{namespace}/{name}"},
+				ResourceTypeExternalHost: {Domain: "network.internet", IDTemplate: "host:{name}"},
+				ResourceTypeNamespace:    {IDTemplate: "namespace-{cluster}-{name}"},
+				ResourceTypeCluster:      {Domain: "infrastructure.cloud"},
+			},
+			want: map[string]string{
+				"east/shop/app":        "compute.k8s",
+				"east/data/database":   "compute.k8s",
+				"host:api.example.com": "network.internet",
+				"namespace-east-shop":  "tenancy.k8s",
+				"namespace-east-data":  "tenancy.k8s",
+				"cluster-east":         "infrastructure.cloud",
+			},
+		},
+		{
+			name:          "configured workload not observed yet has no origin",
+			resourceTypes: map[string]ResourceTypeConfig{ResourceTypeWorkload: {IDTemplate: "{namespace}/{name}"}},
+			workloads:     []string{"payments"},
+			want: map[string]string{
+				"shop/app":                 "compute.k8s",
+				"data/database":            "compute.k8s",
+				"/payments":                "compute.k8s",
+				"external-api.example.com": "network.external",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &OCSConfig{Workload: tt.workloads, ResourceTypes: tt.resourceTypes}
+			got := make(map[string]string)
+			for _, def := range buildContextDefinitions(snapshot, config) {
+				got[def.ResourceID] = def.Domain
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resource IDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
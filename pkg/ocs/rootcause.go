@@ -0,0 +1,160 @@
+package main
+
+import (
+	"sort"
+)
+
+// Weights used to score root-cause candidates
+const (
+	rootCauseCoverageWeight = 0.6
+	rootCauseDepthWeight    = 0.25
+	rootCauseEvidenceWeight = 0.15
+)
+
+// rankRootCauses ranks unhealthy workloads by how well each explains the observed unhealthy set.
+// A candidate scores higher when more unhealthy workloads transitively depend on it, when it has no
+// unhealthy dependencies of its own (the deepest common unhealthy dependency), and when its
+// configured metrics breach their health thresholds.
+func rankRootCauses(adjacencyList map[string][]string, config *OCSConfig, unhealthyWorkloads []string, metricValues map[string]map[string]float64) []RootCauseCandidate {
+	unhealthy := make(map[string]bool)
+	for _, workload := range unhealthyWorkloads {
+		unhealthy[workload] = true
+	}
+
+	// Metric breaches are evidence on their own, so they also mark a workload as unhealthy
+	evidence := make(map[string][]MetricEvidence)
+	for workload, values := range metricValues {
+		evidence[workload] = evaluateMetricHealth(config.Metrics, values)
+		for _, e := range evidence[workload] {
+			if !e.Healthy {
+				unhealthy[workload] = true
+			}
+		}
+	}
+
+	candidates := make([]RootCauseCandidate, 0, len(unhealthy))
+	for workload := range unhealthy {
+		// Unhealthy workloads explained by this one: itself plus everything upstream of it
+		explains := []string{workload}
+		for _, impacted := range analyzeImpact(adjacencyList, nil, workload, nil) {
+			if unhealthy[impacted.Workload] {
+				explains = append(explains, impacted.Workload)
+			}
+		}
+		sort.Strings(explains)
+
+		var unhealthyDeps []string
+		for _, dep := range transitiveDependencies(adjacencyList, workload) {
+			if unhealthy[dep] {
+				unhealthyDeps = append(unhealthyDeps, dep)
+			}
+		}
+
+		coverage := float64(len(explains)) / float64(len(unhealthy))
+		score := rootCauseCoverageWeight * coverage
+		if len(unhealthyDeps) == 0 {
+			score += rootCauseDepthWeight
+		}
+		if len(evidence[workload]) > 0 {
+			breached := 0
+			for _, e := range evidence[workload] {
+				if !e.Healthy {
+					breached++
+				}
+			}
+			score += rootCauseEvidenceWeight * float64(breached) / float64(len(evidence[workload]))
+		}
+
+		candidates = append(candidates, RootCauseCandidate{
+			Workload:              workload,
+			Score:                 score,
+			Explains:              explains,
+			Coverage:              coverage,
+			UnhealthyDependencies: unhealthyDeps,
+			Evidence:              evidence[workload],
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Workload < candidates[j].Workload
+	})
+	for i := range candidates {
+		candidates[i].Rank = i + 1
+	}
+
+	return candidates
+}
+
+// transitiveDependencies returns the sorted set of workloads reachable from workload
+func transitiveDependencies(adjacencyList map[string][]string, workload string) []string {
+	visited := map[string]bool{workload: true}
+	queue := []string{workload}
+	var deps []string
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dest := range adjacencyList[current] {
+			if visited[dest] {
+				continue
+			}
+			visited[dest] = true
+			deps = append(deps, dest)
+			queue = append(queue, dest)
+		}
+	}
+
+	sort.Strings(deps)
+	return deps
+}
+
+// evaluateMetricHealth evaluates observed metric values against each configured metric's
+// health_config. Metrics without a value or without a usable threshold are skipped.
+func evaluateMetricHealth(metrics []MetricConfig, values map[string]float64) []MetricEvidence {
+	var evidence []MetricEvidence
+	for _, metric := range metrics {
+		value, observed := values[metric.Name]
+		if !observed {
+			continue
+		}
+		threshold, ok := toFloat(metric.HealthConfig["critical_threshold"])
+		if !ok {
+			continue
+		}
+		polarity, _ := metric.HealthConfig["polarity"].(string)
+		if polarity == "" {
+			polarity = "high_is_bad"
+		}
+
+		healthy := value < threshold
+		if polarity == "low_is_bad" {
+			healthy = value > threshold
+		}
+
+		evidence = append(evidence, MetricEvidence{
+			Metric:    metric.Name,
+			Value:     value,
+			Threshold: threshold,
+			Polarity:  polarity,
+			Healthy:   healthy,
+		})
+	}
+	return evidence
+}
+
+// toFloat converts a numeric YAML value to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRankRootCauses(t *testing.T) {
+	// proxy -> app -> database, app -> cache
+	adjacencyList := map[string][]string{
+		"proxy": {"app"},
+		"app":   {"database", "cache"},
+	}
+	config := &OCSConfig{Metrics: []MetricConfig{
+		{Name: "cpu", HealthConfig: map[string]interface{}{"critical_threshold": 90, "polarity": "high_is_bad"}},
+	}}
+
+	tests := []struct {
+		name         string
+		unhealthy    []string
+		metricValues map[string]map[string]float64
+		wantOrder    []string
+		wantScores   []float64
+		wantExplains [][]string
+	}{
+		{
+			name:         "deepest common dependency ranks first",
+			unhealthy:    []string{"proxy", "app", "database"},
+			wantOrder:    []string{"database", "app", "proxy"},
+			wantScores:   []float64{0.6 + 0.25, 0.6 * 2 / 3, 0.6 / 3},
+			wantExplains: [][]string{{"app", "database", "proxy"}, {"app", "proxy"}, {"proxy"}},
+		},
+		{
+			name:         "metric breach marks a workload unhealthy and adds evidence",
+			unhealthy:    []string{"proxy", "app"},
+			metricValues: map[string]map[string]float64{"cache": {"cpu": 97}, "app": {"cpu": 40}},
+			wantOrder:    []string{"cache", "app", "proxy"},
+			wantScores:   []float64{0.6 + 0.25 + 0.15, 0.6 * 2 / 3, 0.6 / 3},
+			wantExplains: [][]string{{"app", "cache", "proxy"}, {"app", "proxy"}, {"proxy"}},
+		},
+		{
+			name:         "independent failures tie break by name",
+			unhealthy:    []string{"database", "cache"},
+			wantOrder:    []string{"cache", "database"},
+			wantScores:   []float64{0.6/2 + 0.25, 0.6/2 + 0.25},
+			wantExplains: [][]string{{"cache"}, {"database"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := rankRootCauses(adjacencyList, config, tt.unhealthy, tt.metricValues)
+			if len(candidates) != len(tt.wantOrder) {
+				t.Fatalf("rankRootCauses() returned %d candidates, want %d: %s", len(candidates), len(tt.wantOrder), mustJSON(t, candidates))
+			}
+			for i, candidate := range candidates {
+				if candidate.Workload != tt.wantOrder[i] || candidate.Rank != i+1 {
+					t.Errorf("candidate %d = %s (rank %d), want %s", i, candidate.Workload, candidate.Rank, tt.wantOrder[i])
+				}
+				if math.Abs(candidate.Score-tt.wantScores[i]) > 1e-9 {
+					t.Errorf("%s score = %v, want %v", candidate.Workload, candidate.Score, tt.wantScores[i])
+				}
+				if !reflect.DeepEqual(candidate.Explains, tt.wantExplains[i]) {
+					t.Errorf("%s explains = %v, want %v", candidate.Workload, candidate.Explains, tt.wantExplains[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateMetricHealth(t *testing.T) {
+	metrics := []MetricConfig{
+		{Name: "cpu", HealthConfig: map[string]interface{}{"critical_threshold": 90}},
+		{Name: "availability", HealthConfig: map[string]interface{}{"critical_threshold": 99.5, "polarity": "low_is_bad"}},
+		{Name: "memory"},
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]float64
+		want   []MetricEvidence
+	}{
+		{
+			name:   "breaches in both polarities",
+			values: map[string]float64{"cpu": 95, "availability": 98, "memory": 1},
+			want: []MetricEvidence{
+				{Metric: "cpu", Value: 95, Threshold: 90, Polarity: "high_is_bad", Healthy: false},
+				{Metric: "availability", Value: 98, Threshold: 99.5, Polarity: "low_is_bad", Healthy: false},
+			},
+		},
+		{
+			name:   "healthy values",
+			values: map[string]float64{"cpu": 10, "availability": 99.9},
+			want: []MetricEvidence{
+				{Metric: "cpu", Value: 10, Threshold: 90, Polarity: "high_is_bad", Healthy: true},
+				{Metric: "availability", Value: 99.9, Threshold: 99.5, Polarity: "low_is_bad", Healthy: true},
+			},
+		},
+		{
+			name:   "no observed values",
+			values: map[string]float64{},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluateMetricHealth(metrics, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluateMetricHealth() = %s, want %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
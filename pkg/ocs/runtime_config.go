@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Errors returned by runtime config changes, mapped to 404 and 409 responses
+var (
+	errRuntimeNotFound = errors.New("not found")
+	errRuntimeExists   = errors.New("already exists")
+)
+
+// defaultRuntimeHistoryLimit is how many versions the history endpoint returns by default
+const defaultRuntimeHistoryLimit = 20
+
+// apply merges the runtime changes over the file configuration. Removed entries are dropped,
+// runtime metrics replace file metrics of the same name, and added entries follow the file's.
+func (rc RuntimeConfig) apply(config OCSConfig) OCSConfig {
+	config.Workload = rc.Workloads.apply(config.Workload)
+	config.Policy = rc.Policies.apply(config.Policy)
+
+	runtimeMetrics := make(map[string]MetricConfig, len(rc.Metrics))
+	for _, metric := range rc.Metrics {
+		runtimeMetrics[metric.Name] = metric
+	}
+	removed := make(map[string]bool, len(rc.RemovedMetrics))
+	for _, name := range rc.RemovedMetrics {
+		removed[name] = true
+	}
+
+	var metrics []MetricConfig
+	fileMetrics := make(map[string]bool, len(config.Metrics))
+	for _, metric := range config.Metrics {
+		fileMetrics[metric.Name] = true
+		if removed[metric.Name] {
+			continue
+		}
+		if replacement, ok := runtimeMetrics[metric.Name]; ok {
+			metric = replacement
+		}
+		metrics = append(metrics, metric)
+	}
+	for _, metric := range rc.Metrics {
+		if !fileMetrics[metric.Name] {
+			metrics = append(metrics, metric)
+		}
+	}
+	config.Metrics = metrics
+	return config
+}
+
+// apply returns the file list with the removed entries dropped and the added entries appended
+func (lc RuntimeListChanges) apply(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if !containsString(lc.Removed, value) {
+			result = appendUnique(result, value)
+		}
+	}
+	for _, value := range lc.Added {
+		result = appendUnique(result, value)
+	}
+	return result
+}
+
+// add records value as added to the effective list, or restores it if it was removed from the file
+func (lc *RuntimeListChanges) add(value string, effective []string) error {
+	if containsString(effective, value) {
+		return errRuntimeExists
+	}
+	if containsString(lc.Removed, value) {
+		lc.Removed = removeString(lc.Removed, value)
+	} else {
+		lc.Added = append(lc.Added, value)
+	}
+	return nil
+}
+
+// remove records value as removed from the effective list
+func (lc *RuntimeListChanges) remove(value string, effective, file []string) error {
+	if !containsString(effective, value) {
+		return errRuntimeNotFound
+	}
+	lc.Added = removeString(lc.Added, value)
+	if containsString(file, value) {
+		lc.Removed = append(lc.Removed, value)
+	}
+	return nil
+}
+
+// putMetric adds a metric, or replaces the effective metric of the same name
+func (rc *RuntimeConfig) putMetric(metric MetricConfig) {
+	rc.RemovedMetrics = removeString(rc.RemovedMetrics, metric.Name)
+	for i := range rc.Metrics {
+		if rc.Metrics[i].Name == metric.Name {
+			rc.Metrics[i] = metric
+			return
+		}
+	}
+	rc.Metrics = append(rc.Metrics, metric)
+}
+
+// removeMetric removes the effective metric with the given name
+func (rc *RuntimeConfig) removeMetric(name string, file []MetricConfig) {
+	var metrics []MetricConfig
+	for _, metric := range rc.Metrics {
+		if metric.Name != name {
+			metrics = append(metrics, metric)
+		}
+	}
+	rc.Metrics = metrics
+	for _, metric := range file {
+		if metric.Name == name {
+			rc.RemovedMetrics = append(rc.RemovedMetrics, name)
+			break
+		}
+	}
+}
+
+// copy returns a deep copy, so a change can be prepared without touching the active version
+func (rc RuntimeConfig) copy() RuntimeConfig {
+	return RuntimeConfig{
+		Workloads: RuntimeListChanges{
+			Added:   append([]string(nil), rc.Workloads.Added...),
+			Removed: append([]string(nil), rc.Workloads.Removed...),
+		},
+		Policies: RuntimeListChanges{
+			Added:   append([]string(nil), rc.Policies.Added...),
+			Removed: append([]string(nil), rc.Policies.Removed...),
+		},
+		Metrics:        append([]MetricConfig(nil), rc.Metrics...),
+		RemovedMetrics: append([]string(nil), rc.RemovedMetrics...),
+	}
+}
+
+// findMetric returns the index of the metric with the given name, or -1
+func findMetric(metrics []MetricConfig, name string) int {
+	for i, metric := range metrics {
+		if metric.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns values without any occurrence of value
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// changeRuntimeConfig applies a change to a copy of the current runtime config, validates the
+// merged configuration, saves it as a new version and activates it. The If-Match header may
+// carry the runtime version the change was based on, to reject changes made concurrently.
+func (s *Server) changeRuntimeConfig(c *gin.Context, change string, mutate func(next *RuntimeConfig, effective, file *OCSConfig) error) {
+	if s.mongoRepo == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "MongoDB not initialized",
+		})
+		return
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.activeConfig()
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && strings.Trim(ifMatch, `"`) != strconv.Itoa(current.runtimeVersion()) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Runtime config is at version %d, not %s", current.runtimeVersion(), ifMatch),
+		})
+		return
+	}
+
+	var next RuntimeConfig
+	if current.runtime != nil {
+		next = current.runtime.Config.copy()
+	}
+	if err := mutate(&next, current.ocsConfig, &current.fileConfig.OCSConfig); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errRuntimeNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errRuntimeExists):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	doc := &RuntimeConfigDocument{
+		Version:   current.nextRuntimeVersion(),
+		Timestamp: time.Now().UTC(),
+		Change:    change,
+		Config:    next,
+	}
+	activated, err := current.withRuntimeConfig(doc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := s.mongoRepo.SaveRuntimeConfig(*doc); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errRuntimeConfigConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to save runtime config version %d: %v", doc.Version, err),
+		})
+		return
+	}
+
+	s.activateRuntimeConfig(activated)
+	s.writeRuntimeConfig(c, activated)
+}
+
+// writeRuntimeConfig responds with the effective workloads, metrics and policies and the
+// runtime changes they include
+func (s *Server) writeRuntimeConfig(c *gin.Context, cfg *ActiveConfig) {
+	response := gin.H{
+		"status":          "success",
+		"runtime_version": cfg.runtimeVersion(),
+		"config_version":  cfg.version,
+		"workloads":       cfg.ocsConfig.Workload,
+		"metrics":         cfg.ocsConfig.Metrics,
+		"policies":        cfg.ocsConfig.Policy,
+	}
+	if cfg.runtime != nil {
+		response["changes"] = cfg.runtime.Config
+		response["updated_at"] = cfg.runtime.Timestamp.Format(time.RFC3339)
+		response["change"] = cfg.runtime.Change
+	}
+	c.Header("ETag", fmt.Sprintf(`"%d"`, cfg.runtimeVersion()))
+	c.JSON(http.StatusOK, response)
+}
+
+// getRuntimeConfigHandler handles the config/runtime endpoint
+func (s *Server) getRuntimeConfigHandler(c *gin.Context) {
+	s.writeRuntimeConfig(c, s.activeConfig())
+}
+
+// listWorkloadsHandler handles GET config/workloads
+func (s *Server) listWorkloadsHandler(c *gin.Context) {
+	cfg := s.activeConfig()
+	c.Header("ETag", fmt.Sprintf(`"%d"`, cfg.runtimeVersion()))
+	c.JSON(http.StatusOK, gin.H{"status": "success", "runtime_version": cfg.runtimeVersion(), "workloads": cfg.ocsConfig.Workload})
+}
+
+// listMetricsHandler handles GET config/metrics
+func (s *Server) listMetricsHandler(c *gin.Context) {
+	cfg := s.activeConfig()
+	c.Header("ETag", fmt.Sprintf(`"%d"`, cfg.runtimeVersion()))
+	c.JSON(http.StatusOK, gin.H{"status": "success", "runtime_version": cfg.runtimeVersion(), "metrics": cfg.ocsConfig.Metrics})
+}
+
+// listPoliciesHandler handles GET config/policies
+func (s *Server) listPoliciesHandler(c *gin.Context) {
+	cfg := s.activeConfig()
+	c.Header("ETag", fmt.Sprintf(`"%d"`, cfg.runtimeVersion()))
+	c.JSON(http.StatusOK, gin.H{"status": "success", "runtime_version": cfg.runtimeVersion(), "policies": cfg.ocsConfig.Policy})
+}
+
+// runtimeConfigHistoryHandler handles the config/runtime/history endpoint
+func (s *Server) runtimeConfigHistoryHandler(c *gin.Context) {
+	if s.mongoRepo == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "MongoDB not initialized",
+		})
+		return
+	}
+
+	limit := defaultRuntimeHistoryLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid limit: %s", limitStr),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	versions, err := s.mongoRepo.ListRuntimeConfigVersions(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to retrieve runtime config history: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"versions": versions,
+	})
+}
+
+// addWorkloadHandler handles POST config/workloads
+func (s *Server) addWorkloadHandler(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Request body must be a JSON object with a non-empty name",
+		})
+		return
+	}
+
+	s.changeRuntimeConfig(c, "add workload "+request.Name, func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if err := next.Workloads.add(request.Name, effective.Workload); err != nil {
+			return fmt.Errorf("workload %s %w", request.Name, err)
+		}
+		return nil
+	})
+}
+
+// removeWorkloadHandler handles DELETE config/workloads/:name
+func (s *Server) removeWorkloadHandler(c *gin.Context) {
+	name := c.Param("name")
+	s.changeRuntimeConfig(c, "remove workload "+name, func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if err := next.Workloads.remove(name, effective.Workload, file.Workload); err != nil {
+			return fmt.Errorf("workload %s %w", name, err)
+		}
+		return nil
+	})
+}
+
+// addMetricHandler handles POST config/metrics
+func (s *Server) addMetricHandler(c *gin.Context) {
+	var metric MetricConfig
+	if err := c.ShouldBindJSON(&metric); err != nil || metric.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Request body must be a metric with a non-empty name",
+		})
+		return
+	}
+
+	s.changeRuntimeConfig(c, "add metric "+metric.Name, func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if findMetric(effective.Metrics, metric.Name) >= 0 {
+			return fmt.Errorf("metric %s %w", metric.Name, errRuntimeExists)
+		}
+		next.putMetric(metric)
+		return nil
+	})
+}
+
+// updateMetricHandler handles PUT config/metrics/:name
+func (s *Server) updateMetricHandler(c *gin.Context) {
+	name := c.Param("name")
+	var metric MetricConfig
+	if err := c.ShouldBindJSON(&metric); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Request body must be a metric",
+		})
+		return
+	}
+	if metric.Name != "" && metric.Name != name {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Metric name %s does not match %s; remove and add the metric to rename it", metric.Name, name),
+		})
+		return
+	}
+	metric.Name = name
+
+	s.changeRuntimeConfig(c, "update metric "+name, func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if findMetric(effective.Metrics, name) < 0 {
+			return fmt.Errorf("metric %s %w", name, errRuntimeNotFound)
+		}
+		next.putMetric(metric)
+		return nil
+	})
+}
+
+// removeMetricHandler handles DELETE config/metrics/:name
+func (s *Server) removeMetricHandler(c *gin.Context) {
+	name := c.Param("name")
+	s.changeRuntimeConfig(c, "remove metric "+name, func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if findMetric(effective.Metrics, name) < 0 {
+			return fmt.Errorf("metric %s %w", name, errRuntimeNotFound)
+		}
+		next.removeMetric(name, file.Metrics)
+		return nil
+	})
+}
+
+// addPolicyHandler handles POST config/policies
+func (s *Server) addPolicyHandler(c *gin.Context) {
+	var request struct {
+		Policy string `json:"policy"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Policy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Request body must be a JSON object with a non-empty policy",
+		})
+		return
+	}
+
+	s.changeRuntimeConfig(c, "add policy", func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		if err := next.Policies.add(request.Policy, effective.Policy); err != nil {
+			return fmt.Errorf("policy %w", err)
+		}
+		return nil
+	})
+}
+
+// updatePolicyHandler handles PUT config/policies/:index. The updated policy moves to the end of the list.
+func (s *Server) updatePolicyHandler(c *gin.Context) {
+	var request struct {
+		Policy string `json:"policy"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Policy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Request body must be a JSON object with a non-empty policy",
+		})
+		return
+	}
+
+	s.changeRuntimeConfig(c, "update policy "+c.Param("index"), func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		policy, err := policyAt(effective.Policy, c.Param("index"))
+		if err != nil {
+			return err
+		}
+		if policy == request.Policy {
+			return nil
+		}
+		if err := next.Policies.remove(policy, effective.Policy, file.Policy); err != nil {
+			return err
+		}
+		if err := next.Policies.add(request.Policy, removeString(effective.Policy, policy)); err != nil {
+			return fmt.Errorf("policy %w", err)
+		}
+		return nil
+	})
+}
+
+// removePolicyHandler handles DELETE config/policies/:index
+func (s *Server) removePolicyHandler(c *gin.Context) {
+	s.changeRuntimeConfig(c, "remove policy "+c.Param("index"), func(next *RuntimeConfig, effective, file *OCSConfig) error {
+		policy, err := policyAt(effective.Policy, c.Param("index"))
+		if err != nil {
+			return err
+		}
+		return next.Policies.remove(policy, effective.Policy, file.Policy)
+	})
+}
+
+// policyAt returns the effective policy at an index given as a path parameter
+func policyAt(policies []string, indexStr string) (string, error) {
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid policy index: %s", indexStr)
+	}
+	if index < 0 || index >= len(policies) {
+		return "", fmt.Errorf("policy %d %w", index, errRuntimeNotFound)
+	}
+	return policies[index], nil
+}
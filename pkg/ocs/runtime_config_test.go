@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRuntimeConfigApply(t *testing.T) {
+	cpu := MetricConfig{Name: "cpu", Type: "gauge", Unit: "percentage"}
+	latency := MetricConfig{Name: "latency", Type: "histogram", Unit: "ms"}
+	file := OCSConfig{
+		Workload: []string{"app", "cart"},
+		Policy:   []string{"page on latency"},
+		Metrics:  []MetricConfig{cpu, latency},
+	}
+
+	tests := []struct {
+		name          string
+		runtime       RuntimeConfig
+		wantWorkloads []string
+		wantPolicy    []string
+		wantMetrics   []MetricConfig
+	}{
+		{
+			name:          "no changes",
+			wantWorkloads: []string{"app", "cart"},
+			wantPolicy:    []string{"page on latency"},
+			wantMetrics:   []MetricConfig{cpu, latency},
+		},
+		{
+			name: "added and removed entries",
+			runtime: RuntimeConfig{
+				Workloads: RuntimeListChanges{Added: []string{"payments", "app"}, Removed: []string{"cart"}},
+				Policies:  RuntimeListChanges{Removed: []string{"page on latency"}},
+			},
+			wantWorkloads: []string{"app", "payments"},
+			wantMetrics:   []MetricConfig{cpu, latency},
+		},
+		{
+			name: "metric replaced in place, removed and added",
+			runtime: RuntimeConfig{
+				Metrics:        []MetricConfig{{Name: "errors", Type: "counter"}, {Name: "latency", Type: "histogram", Unit: "s"}},
+				RemovedMetrics: []string{"cpu"},
+			},
+			wantWorkloads: []string{"app", "cart"},
+			wantPolicy:    []string{"page on latency"},
+			wantMetrics:   []MetricConfig{{Name: "latency", Type: "histogram", Unit: "s"}, {Name: "errors", Type: "counter"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.runtime.apply(file)
+			if !reflect.DeepEqual(got.Workload, tt.wantWorkloads) {
+				t.Errorf("apply() workloads = %v, want %v", got.Workload, tt.wantWorkloads)
+			}
+			if !reflect.DeepEqual(got.Policy, tt.wantPolicy) {
+				t.Errorf("apply() policies = %v, want %v", got.Policy, tt.wantPolicy)
+			}
+			if !reflect.DeepEqual(got.Metrics, tt.wantMetrics) {
+				t.Errorf("apply() metrics = %+v, want %+v", got.Metrics, tt.wantMetrics)
+			}
+		})
+	}
+}
+
+func TestRuntimeListChanges(t *testing.T) {
+	file := []string{"app", "cart"}
+
+	tests := []struct {
+		name    string
+		changes RuntimeListChanges
+		add     string
+		remove  string
+		want    RuntimeListChanges
+		wantErr error
+	}{
+		{name: "add new entry", add: "payments", want: RuntimeListChanges{Added: []string{"payments"}}},
+		{name: "add existing entry", add: "app", wantErr: errRuntimeExists},
+		{
+			name:    "add restores removed file entry",
+			changes: RuntimeListChanges{Removed: []string{"cart"}},
+			add:     "cart",
+			want:    RuntimeListChanges{},
+		},
+		{name: "remove file entry", remove: "cart", want: RuntimeListChanges{Removed: []string{"cart"}}},
+		{
+			name:    "remove added entry",
+			changes: RuntimeListChanges{Added: []string{"payments"}},
+			remove:  "payments",
+			want:    RuntimeListChanges{},
+		},
+		{name: "remove unknown entry", remove: "payments", wantErr: errRuntimeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := tt.changes
+			effective := changes.apply(file)
+			var err error
+			if tt.add != "" {
+				err = changes.add(tt.add, effective)
+			} else {
+				err = changes.remove(tt.remove, effective, file)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(changes, tt.want) {
+				t.Errorf("changes = %+v, want %+v", changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfigMetrics(t *testing.T) {
+	file := []MetricConfig{{Name: "cpu", Type: "gauge"}}
+
+	tests := []struct {
+		name    string
+		runtime RuntimeConfig
+		change  func(rc *RuntimeConfig)
+		want    RuntimeConfig
+	}{
+		{
+			name:   "put new metric",
+			change: func(rc *RuntimeConfig) { rc.putMetric(MetricConfig{Name: "errors", Type: "counter"}) },
+			want:   RuntimeConfig{Metrics: []MetricConfig{{Name: "errors", Type: "counter"}}},
+		},
+		{
+			name:    "put replaces runtime metric by name",
+			runtime: RuntimeConfig{Metrics: []MetricConfig{{Name: "errors", Type: "counter"}}},
+			change:  func(rc *RuntimeConfig) { rc.putMetric(MetricConfig{Name: "errors", Type: "gauge"}) },
+			want:    RuntimeConfig{Metrics: []MetricConfig{{Name: "errors", Type: "gauge"}}},
+		},
+		{
+			name:    "put restores removed file metric",
+			runtime: RuntimeConfig{RemovedMetrics: []string{"cpu"}},
+			change:  func(rc *RuntimeConfig) { rc.putMetric(MetricConfig{Name: "cpu", Type: "gauge", Unit: "cores"}) },
+			want:    RuntimeConfig{Metrics: []MetricConfig{{Name: "cpu", Type: "gauge", Unit: "cores"}}},
+		},
+		{
+			name:   "remove file metric",
+			change: func(rc *RuntimeConfig) { rc.removeMetric("cpu", file) },
+			want:   RuntimeConfig{RemovedMetrics: []string{"cpu"}},
+		},
+		{
+			name:    "remove replaced file metric",
+			runtime: RuntimeConfig{Metrics: []MetricConfig{{Name: "cpu", Type: "counter"}}},
+			change:  func(rc *RuntimeConfig) { rc.removeMetric("cpu", file) },
+			want:    RuntimeConfig{RemovedMetrics: []string{"cpu"}},
+		},
+		{
+			name:    "remove runtime metric",
+			runtime: RuntimeConfig{Metrics: []MetricConfig{{Name: "errors", Type: "counter"}}},
+			change:  func(rc *RuntimeConfig) { rc.removeMetric("errors", file) },
+			want:    RuntimeConfig{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := tt.runtime.copy()
+			tt.change(&runtime)
+			if !reflect.DeepEqual(runtime.Metrics, tt.want.Metrics) || !reflect.DeepEqual(runtime.RemovedMetrics, tt.want.RemovedMetrics) {
+				t.Errorf("runtime config = %+v, want %+v", runtime, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeRuntimeConfigRejectsStaleChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, err := buildActiveConfig(testProfilesPaths, []byte(testProfilesConfig), []byte(testProfilesPrometheusConfig), "hash")
+	if err != nil {
+		t.Fatalf("buildActiveConfig() error = %v", err)
+	}
+	cfg, err = cfg.withRuntimeConfig(&RuntimeConfigDocument{Version: 2})
+	if err != nil {
+		t.Fatalf("withRuntimeConfig() error = %v", err)
+	}
+	// Every case is turned away before the change would be saved
+	server := &Server{mongoRepo: &MongoDBRepository{}}
+	server.config.Store(cfg)
+	router := gin.New()
+	router.POST("/config/workloads", server.addWorkloadHandler)
+	router.DELETE("/config/workloads/:name", server.removeWorkloadHandler)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		ifMatch    string
+		wantStatus int
+	}{
+		{name: "stale version", method: http.MethodPost, path: "/config/workloads", body: `{"name": "payments"}`, ifMatch: `"1"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "unquoted stale version", method: http.MethodPost, path: "/config/workloads", body: `{"name": "payments"}`, ifMatch: "3", wantStatus: http.StatusPreconditionFailed},
+		{name: "existing workload", method: http.MethodPost, path: "/config/workloads", body: `{"name": "app"}`, ifMatch: `"2"`, wantStatus: http.StatusConflict},
+		{name: "unknown workload", method: http.MethodDelete, path: "/config/workloads/payments", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if server.activeConfig() != cfg {
+				t.Error("a rejected change replaced the active configuration")
+			}
+		})
+	}
+}
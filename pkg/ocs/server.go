@@ -2,35 +2,102 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(runValidateConfig(os.Args[2:]))
+	}
+
+	paths, err := parseConfigFlags(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to locate config: %v", err)
+	}
+
 	// Initialize server
-	server, err := NewServer()
+	server, err := NewServer(paths)
 	if err != nil {
 		log.Fatalf("Failed to initialize server: %v", err)
 	}
 	defer server.Close()
 
-	// Setup Gin router
+	// Reload the configuration when its files change or on SIGHUP
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go server.watchConfig(stopWatching)
+
+	// Setup Gin router. The port, TLS and proxy settings are read once; changing them takes a restart.
+	serverConfig := server.activeConfig().config.Server
 	router := gin.Default()
+	// Only trust X-Forwarded-For from configured proxies, so clients cannot pick the address
+	// they are rate limited and audited as
+	if err := router.SetTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v", err)
+	}
+
+	// Register routes. Each group requires a scope; see auth.go.
+	read := router.Group("/", server.requireScope(ScopeRead))
+	read.GET("/get_ocs_prompt", server.getOCSPromptHandler)
+	read.GET("/impact_analysis", server.impactAnalysisHandler)
+	read.POST("/root_cause_analysis", server.rootCauseAnalysisHandler)
+	read.GET("/topology/reconciliation", server.topologyReconciliationHandler)
+	read.GET("/ocs/schema", server.schemaHandler)
+	read.GET("/profiles", server.profilesHandler)
+	read.GET("/profiles/:profile/get_ocs_prompt", server.getOCSPromptHandler)
+	read.GET("/config/version", server.configVersionHandler)
+
+	collect := router.Group("/", server.requireScope(ScopeCollect))
+	collect.POST("/collect_istio_metrics", server.collectIstioMetricsHandler)
+	collect.POST("/topology/import", server.importTopologyHandler)
+	collect.POST("/profiles/:profile/collect_istio_metrics", server.collectIstioMetricsHandler)
+	collect.POST("/topology/backfill", server.backfillHandler)
+	collect.GET("/topology/backfills", server.listBackfillsHandler)
+	collect.GET("/topology/backfills/:id", server.getBackfillHandler)
+	collect.POST("/topology/backfills/:id/resume", server.resumeBackfillHandler)
+	collect.GET("/jobs", server.listJobsHandler)
+	collect.GET("/jobs/:id", server.getJobHandler)
+	collect.POST("/jobs/:id/cancel", server.cancelJobHandler)
 
-	// Register routes
-	router.GET("/get_ocs_prompt", server.getOCSPromptHandler)
-	router.POST("/collect_istio_metrics", server.collectIstioMetricsHandler)
+	// Configuration management, including the runtime configuration API merged over ocs_config.yaml
+	admin := router.Group("/config", server.requireScope(ScopeAdmin))
+	admin.POST("/reload", server.reloadConfigHandler)
+	admin.GET("/runtime", server.getRuntimeConfigHandler)
+	admin.GET("/runtime/history", server.runtimeConfigHistoryHandler)
+	admin.GET("/workloads", server.listWorkloadsHandler)
+	admin.POST("/workloads", server.addWorkloadHandler)
+	admin.DELETE("/workloads/:name", server.removeWorkloadHandler)
+	admin.GET("/metrics", server.listMetricsHandler)
+	admin.POST("/metrics", server.addMetricHandler)
+	admin.PUT("/metrics/:name", server.updateMetricHandler)
+	admin.DELETE("/metrics/:name", server.removeMetricHandler)
+	admin.GET("/policies", server.listPoliciesHandler)
+	admin.POST("/policies", server.addPolicyHandler)
+	admin.PUT("/policies/:index", server.updatePolicyHandler)
+	admin.DELETE("/policies/:index", server.removePolicyHandler)
+
+	// Health checks stay open for probes
 	router.GET("/health", server.healthCheckHandler)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
+	if serverConfig.TLSCertFile == "" {
+		log.Printf("Starting OCS server on port %s", serverConfig.Port)
+		if err := router.Run(":" + serverConfig.Port); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+		return
 	}
 
-	log.Printf("Starting OCS server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
+	tlsConfig, err := newServerTLSConfig(serverConfig)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+	httpServer := &http.Server{Addr: ":" + serverConfig.Port, Handler: router, TLSConfig: tlsConfig}
+	log.Printf("Starting OCS server with TLS on port %s", serverConfig.Port)
+	if err := httpServer.ListenAndServeTLS(serverConfig.TLSCertFile, serverConfig.TLSKeyFile); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
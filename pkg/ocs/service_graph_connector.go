@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConnectorServiceGraph identifies topology collected by the ServiceGraphConnector
+const ConnectorServiceGraph = "otel_service_graph"
+
+// serviceGraphLatencyQuantile is the latency quantile reported for each server
+const serviceGraphLatencyQuantile = 0.95
+
+// Metric names of the samples the ServiceGraphConnector reports per server
+const (
+	ServiceGraphRequestTotal       = "service_graph_request_total"
+	ServiceGraphRequestFailedTotal = "service_graph_request_failed_total"
+	ServiceGraphErrorRate          = "service_graph_error_rate"
+	ServiceGraphLatencyMean        = "service_graph_latency_mean_seconds"
+	ServiceGraphLatencyP95         = "service_graph_latency_p95_seconds"
+)
+
+// ServiceGraphConnector reads the request, failure and latency metrics produced by the
+// OpenTelemetry Collector servicegraph connector or Tempo's metrics generator. Traced services
+// outside the mesh show up here with their client -> server edges.
+type ServiceGraphConnector struct {
+	prometheus *PrometheusClient
+
+	// The last query results are kept so the discovery calls of one collection share one set of queries
+	mu         sync.Mutex
+	lastKey    string
+	lastResult *serviceGraphResult
+}
+
+// serviceGraphResult holds the service graph series for one collection
+type serviceGraphResult struct {
+	requests       *PrometheusQueryResult
+	failed         *PrometheusQueryResult
+	latencySum     *PrometheusQueryResult
+	latencyCount   *PrometheusQueryResult
+	latencyBuckets *PrometheusQueryResult
+}
+
+// NewServiceGraphConnector creates a service graph connector for the named Prometheus instance
+func NewServiceGraphConnector(prometheusName, prometheusURL string) *ServiceGraphConnector {
+	return &ServiceGraphConnector{
+		prometheus: NewPrometheusClient(prometheusName, prometheusURL),
+	}
+}
+
+// newServiceGraphProviders creates a service graph provider for each Prometheus instance selecting it
+func newServiceGraphProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	instances, err := promConfig.instancesFor(ConnectorServiceGraph)
+	if err != nil {
+		return nil, err
+	}
+	var providers []ContextProvider
+	for _, instance := range instances {
+		providers = append(providers, NewServiceGraphConnector(instance.Name, instance.BaseURL))
+	}
+	return providers, nil
+}
+
+// Name returns the provider name recorded on the facts this connector contributes
+func (sg *ServiceGraphConnector) Name() string {
+	return ConnectorServiceGraph
+}
+
+// Instance returns the name of the Prometheus instance the connector queries
+func (sg *ServiceGraphConnector) Instance() string {
+	return sg.prometheus.name
+}
+
+// DiscoverEntities returns every client and server in the service graph. Servers carry the
+// connection_type label as an attribute when it is set, e.g. database or messaging_system.
+func (sg *ServiceGraphConnector) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	result, err := sg.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make(map[string]*Entity)
+	add := func(name string) *Entity {
+		if entities[name] == nil {
+			entities[name] = &Entity{Name: name, Type: ResourceTypeWorkload}
+		}
+		return entities[name]
+	}
+	for _, r := range result.requests.Data.Result {
+		client, server := r.Metric["client"], r.Metric["server"]
+		if client == "" || server == "" {
+			continue
+		}
+		add(client)
+		entity := add(server)
+		if connectionType := r.Metric["connection_type"]; connectionType != "" {
+			entity.Attributes = map[string]interface{}{"connection_type": connectionType}
+		}
+	}
+
+	names := make([]string, 0, len(entities))
+	for name := range entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]Entity, 0, len(names))
+	for _, name := range names {
+		list = append(list, *entities[name])
+	}
+	return list, nil
+}
+
+// DiscoverRelationships returns the client -> server edges with their request volume
+func (sg *ServiceGraphConnector) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	result, err := sg.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var relationships []Relationship
+	for client, servers := range ExtractServiceGraphEdges(result.requests) {
+		for server, requests := range servers {
+			traffic := requests
+			relationships = append(relationships, Relationship{Source: client, Destination: server, Traffic: &traffic})
+		}
+	}
+	return relationships, nil
+}
+
+// FetchMetrics returns each server's inbound request count, failures, error rate and latency
+func (sg *ServiceGraphConnector) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	result, err := sg.collect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := sumByServer(result.requests)
+	failed := sumByServer(result.failed)
+	latencySum := sumByServer(result.latencySum)
+	latencyCount := sumByServer(result.latencyCount)
+	buckets := serverLatencyBuckets(result.latencyBuckets)
+
+	servers := make([]string, 0, len(requests))
+	for server := range requests {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	var samples []MetricSample
+	for _, server := range servers {
+		samples = append(samples,
+			MetricSample{Entity: server, Metric: ServiceGraphRequestTotal, Value: requests[server]},
+			MetricSample{Entity: server, Metric: ServiceGraphRequestFailedTotal, Value: failed[server]},
+		)
+		if requests[server] > 0 {
+			samples = append(samples, MetricSample{Entity: server, Metric: ServiceGraphErrorRate, Value: failed[server] / requests[server]})
+		}
+		if latencyCount[server] > 0 {
+			samples = append(samples, MetricSample{Entity: server, Metric: ServiceGraphLatencyMean, Value: latencySum[server] / latencyCount[server]})
+		}
+		if quantile, ok := histogramQuantile(serviceGraphLatencyQuantile, buckets[server]); ok {
+			samples = append(samples, MetricSample{Entity: server, Metric: ServiceGraphLatencyP95, Value: quantile})
+		}
+	}
+	return samples, nil
+}
+
+// collect runs the service graph queries once per collection request and reuses the results for later calls
+func (sg *ServiceGraphConnector) collect(ctx context.Context, req CollectionRequest) (*serviceGraphResult, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	key := req.key()
+	if sg.lastResult != nil && sg.lastKey == key {
+		return sg.lastResult, nil
+	}
+	if len(req.Workloads) == 0 {
+		return nil, fmt.Errorf("no source workloads provided")
+	}
+
+	clientFilter := fmt.Sprintf(`{client=~"%s"}`, strings.Join(req.Workloads, "|"))
+	result := &serviceGraphResult{}
+	queries := []struct {
+		metric string
+		target **PrometheusQueryResult
+	}{
+		{"traces_service_graph_request_total", &result.requests},
+		{"traces_service_graph_request_failed_total", &result.failed},
+		{"traces_service_graph_request_server_seconds_sum", &result.latencySum},
+		{"traces_service_graph_request_server_seconds_count", &result.latencyCount},
+		{"traces_service_graph_request_server_seconds_bucket", &result.latencyBuckets},
+	}
+	for _, q := range queries {
+		queryResult, err := sg.prometheus.Query(ctx, q.metric+clientFilter, req.From, req.To)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", q.metric, err)
+		}
+		*q.target = queryResult
+	}
+
+	sg.lastKey, sg.lastResult = key, result
+	return result, nil
+}
+
+// ExtractServiceGraphEdges extracts the request volume of each client -> server edge from
+// service graph results, in the same source -> destination form as ExtractEdgeTraffic
+func ExtractServiceGraphEdges(result *PrometheusQueryResult) map[string]map[string]float64 {
+	edges := make(map[string]map[string]float64)
+	for _, r := range result.Data.Result {
+		client, server := r.Metric["client"], r.Metric["server"]
+		if client == "" || server == "" {
+			continue
+		}
+		value, ok := sampleValue(r.Value)
+		if !ok {
+			continue
+		}
+		if edges[client] == nil {
+			edges[client] = make(map[string]float64)
+		}
+		edges[client][server] += value
+	}
+	return edges
+}
+
+// sumByServer sums the value of service graph series per server
+func sumByServer(result *PrometheusQueryResult) map[string]float64 {
+	sums := make(map[string]float64)
+	for _, r := range result.Data.Result {
+		server := r.Metric["server"]
+		if server == "" {
+			continue
+		}
+		if value, ok := sampleValue(r.Value); ok {
+			sums[server] += value
+		}
+	}
+	return sums
+}
+
+// histogramBucket is a cumulative histogram bucket: the count of observations <= upperBound
+type histogramBucket struct {
+	upperBound float64
+	count      float64
+}
+
+// serverLatencyBuckets merges the latency histogram buckets of all clients per server, sorted by upper bound
+func serverLatencyBuckets(result *PrometheusQueryResult) map[string][]histogramBucket {
+	counts := make(map[string]map[float64]float64)
+	for _, r := range result.Data.Result {
+		server := r.Metric["server"]
+		upperBound, err := strconv.ParseFloat(r.Metric["le"], 64)
+		if server == "" || err != nil {
+			continue
+		}
+		value, ok := sampleValue(r.Value)
+		if !ok {
+			continue
+		}
+		if counts[server] == nil {
+			counts[server] = make(map[float64]float64)
+		}
+		counts[server][upperBound] += value
+	}
+
+	buckets := make(map[string][]histogramBucket)
+	for server, byBound := range counts {
+		for upperBound, count := range byBound {
+			buckets[server] = append(buckets[server], histogramBucket{upperBound: upperBound, count: count})
+		}
+		sort.Slice(buckets[server], func(i, j int) bool {
+			return buckets[server][i].upperBound < buckets[server][j].upperBound
+		})
+	}
+	return buckets
+}
+
+// histogramQuantile estimates a quantile from cumulative buckets by linear interpolation within
+// the bucket it falls in, the same way Prometheus' histogram_quantile() does
+func histogramQuantile(q float64, buckets []histogramBucket) (float64, bool) {
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upperBound, 1) {
+		return 0, false
+	}
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := q * total
+	for i, bucket := range buckets {
+		if bucket.count < rank {
+			continue
+		}
+		if math.IsInf(bucket.upperBound, 1) {
+			// The quantile lies above the highest finite bound, which is the best estimate
+			return buckets[i-1].upperBound, true
+		}
+		lowerBound, lowerCount := 0.0, 0.0
+		if i > 0 {
+			lowerBound, lowerCount = buckets[i-1].upperBound, buckets[i-1].count
+		}
+		if bucket.count == lowerCount {
+			return bucket.upperBound, true
+		}
+		return lowerBound + (bucket.upperBound-lowerBound)*(rank-lowerCount)/(bucket.count-lowerCount), true
+	}
+	return buckets[len(buckets)-2].upperBound, true
+}
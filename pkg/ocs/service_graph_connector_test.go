@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	inf := math.Inf(1)
+	latency := []histogramBucket{{0.1, 50}, {0.5, 90}, {1, 100}, {inf, 100}}
+
+	tests := []struct {
+		name    string
+		q       float64
+		buckets []histogramBucket
+		want    float64
+		wantOK  bool
+	}{
+		{"interpolates within the bucket", 0.95, latency, 0.75, true},
+		{"first bucket starts at zero", 0.25, latency, 0.05, true},
+		{"rank on a bucket boundary", 0.5, latency, 0.1, true},
+		{"quantile above the highest finite bound", 0.95, []histogramBucket{{0.1, 10}, {inf, 100}}, 0.1, true},
+		{"no observations", 0.5, []histogramBucket{{0.1, 0}, {0.2, 0}, {inf, 0}}, 0, false},
+		{"missing +Inf bucket", 0.5, []histogramBucket{{0.1, 5}, {0.5, 10}}, 0, false},
+		{"single bucket", 0.5, []histogramBucket{{inf, 10}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := histogramQuantile(tt.q, tt.buckets)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("histogramQuantile(%v) = %v, %v, want %v, %v", tt.q, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
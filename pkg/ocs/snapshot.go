@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported values for latest_snapshot in ocs_config.yaml and the latest query parameter
+const (
+	// LatestByDataTime picks the snapshot whose data is newest, i.e. whose window ends last
+	LatestByDataTime = "data_time"
+	// LatestByCollectionTime picks the snapshot saved last, whatever range it covers
+	LatestByCollectionTime = "collection_time"
+)
+
+var latestSnapshotOrders = []string{LatestByDataTime, LatestByCollectionTime}
+
+// collectorVersion identifies the build that saves snapshots. Release builds set it with
+// -ldflags "-X main.collectorVersion=v1.2.3"; otherwise it is taken from the build info.
+var collectorVersion = buildVersion()
+
+// buildVersion returns the main module version, or the VCS revision for development builds
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if version := info.Main.Version; version != "" && version != "(devel)" {
+		return version
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// collectionTime returns when a snapshot was saved. Snapshots saved before collected_at was
+// recorded were timestamped when they were saved.
+func (d *AdjacencyListDocument) collectionTime() time.Time {
+	if d.CollectedAt.IsZero() {
+		return d.Timestamp
+	}
+	return d.CollectedAt
+}
+
+// snapshotQuery describes the parameters a request collects a profile's topology with
+func snapshotQuery(c *gin.Context, cfg *ActiveConfig) *SnapshotQuery {
+	query := &SnapshotQuery{Profile: cfg.profile, Workloads: cfg.ocsConfig.Workload}
+	if c.Query("from_timestamp") == "" && c.Query("to_timestamp") == "" {
+		query.TimeWindowMinutes = cfg.ocsConfig.TimeWindowMinutes
+	}
+	return query
+}
+
+// requestSnapshotOrder returns how a request picks the latest snapshot: the latest query
+// parameter, else the profile's latest_snapshot setting. It responds with 400 and returns false
+// if the parameter is not a supported order.
+func requestSnapshotOrder(c *gin.Context, cfg *ActiveConfig) (string, bool) {
+	order := c.Query("latest")
+	if order == "" {
+		order = cfg.ocsConfig.LatestSnapshot
+	}
+	switch order {
+	case "":
+		return LatestByDataTime, true
+	case LatestByDataTime, LatestByCollectionTime:
+		return order, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status":  "error",
+		"message": fmt.Sprintf("Unsupported latest %s, supported values: %s", order, strings.Join(latestSnapshotOrders, ", ")),
+	})
+	return "", false
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Supported OCS spec versions. Responses are built for the latest version and projected onto
+// the requested one, which defaults to 0.1 so existing clients keep their format until they opt in.
+const (
+	SpecVersion01      = "0.1"
+	SpecVersion02      = "0.2"
+	LatestSpecVersion  = SpecVersion02
+	DefaultSpecVersion = SpecVersion01
+)
+
+// supportedSpecVersions lists every spec version the server can produce, oldest first
+var supportedSpecVersions = []string{SpecVersion01, SpecVersion02}
+
+//go:embed schema/*.schema.json
+var schemaFS embed.FS
+
+// loadSpecSchema returns the raw JSON Schema published for a spec version
+func loadSpecSchema(version string) ([]byte, error) {
+	if !isSupportedSpecVersion(version) {
+		return nil, fmt.Errorf("unsupported spec_version %q, supported versions: %s", version, strings.Join(supportedSpecVersions, ", "))
+	}
+	data, err := schemaFS.ReadFile(fmt.Sprintf("schema/ocs-%s.schema.json", version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema for spec_version %s: %w", version, err)
+	}
+	return data, nil
+}
+
+// isSupportedSpecVersion reports whether version is one the server can produce
+func isSupportedSpecVersion(version string) bool {
+	for _, supported := range supportedSpecVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ocsPromptResponseV01 is the 0.1 wire format
+type ocsPromptResponseV01 struct {
+	SpecVersion        string                    `json:"spec_version"`
+	ContextDefinitions []ocsContextDefinitionV01 `json:"context_definitions"`
+}
+
+// ocsContextDefinitionV01 is a 0.1 context definition. Every node was described as a workload.
+type ocsContextDefinitionV01 struct {
+	ResourceID string                 `json:"resource_id,omitempty"`
+	Domain     string                 `json:"domain,omitempty"`
+	Identity   map[string]interface{} `json:"identity,omitempty"`
+	Metrics    []metricConfigV01      `json:"metrics,omitempty"`
+	Topology   map[string]interface{} `json:"topology,omitempty"`
+	Policy     []string               `json:"policy,omitempty"`
+}
+
+// metricConfigV01 is a 0.1 metric. 0.1 serialized metrics without JSON tags, so its keys are
+// the Go field names.
+type metricConfigV01 struct {
+	Name             string
+	Type             string
+	Unit             string
+	Description      string
+	AggregationLogic string
+	HealthConfig     map[string]interface{}
+}
+
+// convertToSpecVersion projects a response built for the latest spec onto the requested spec
+// version. The result is an OCSPromptResponse for 0.2 and an ocsPromptResponseV01 for 0.1.
+func convertToSpecVersion(response OCSPromptResponse, version string, config *OCSConfig) (interface{}, error) {
+	switch version {
+	case SpecVersion02:
+		response.SpecVersion = SpecVersion02
+		return response, nil
+	case SpecVersion01:
+		// 0.1 predates resource types, origin identity, temporal context, provenance,
+		// root-cause blocks and content hashes, and derived service and namespace definitions
+		var metrics []metricConfigV01
+		for _, metric := range config.Metrics {
+			metrics = append(metrics, metricConfigV01(metric))
+		}
+		definitions := []ocsContextDefinitionV01{}
+		for _, def := range response.ContextDefinitions {
+			if def.node == "" {
+				continue
+			}
+			definition := ocsContextDefinitionV01{
+				ResourceID: fmt.Sprintf("workload-%s", def.node),
+				Domain:     "compute.k8s",
+				Identity:   map[string]interface{}{"workload": def.node},
+				Metrics:    metrics,
+				Policy:     config.Policy,
+			}
+			topology := make(map[string]interface{})
+			for _, key := range []string{"dependencies", "dependents"} {
+				if value, ok := def.Topology[key]; ok {
+					topology[key] = value
+				}
+			}
+			if len(topology) > 0 {
+				definition.Topology = topology
+			}
+			definitions = append(definitions, definition)
+		}
+		return ocsPromptResponseV01{
+			SpecVersion:        SpecVersion01,
+			ContextDefinitions: definitions,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported spec_version %q, supported versions: %s", version, strings.Join(supportedSpecVersions, ", "))
+	}
+}
+
+// validateOCSResponse validates a response, as returned by convertToSpecVersion, against the
+// published schema for its spec version
+func validateOCSResponse(specVersion string, response interface{}) error {
+	schemaData, err := loadSpecSchema(specVersion)
+	if err != nil {
+		return err
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return fmt.Errorf("failed to parse schema for spec_version %s: %w", specVersion, err)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	validator := schemaValidator{root: schema}
+	validator.validate(schema, document, "$")
+	if len(validator.errors) > 0 {
+		return fmt.Errorf("response does not match OCS %s schema: %s", specVersion, strings.Join(validator.errors, "; "))
+	}
+	return nil
+}
+
+// schemaValidator checks a decoded JSON document against the subset of JSON Schema used by
+// the published OCS schemas: type (a name or a list of names), const, enum, required,
+// properties, additionalProperties, items and local $ref
+type schemaValidator struct {
+	root   map[string]interface{}
+	errors []string
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		schema = resolved
+	}
+
+	if expected, ok := schema["const"]; ok && value != expected {
+		v.fail(path, "must be %v", expected)
+	}
+	if allowed, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, candidate := range allowed {
+			if value == candidate {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "must be one of %v", allowed)
+		}
+	}
+	switch expected := schema["type"].(type) {
+	case string:
+		if !matchesType(value, expected) {
+			v.fail(path, "must be of type %s", expected)
+			return
+		}
+	case []interface{}:
+		matched := false
+		for _, candidate := range expected {
+			name, _ := candidate.(string)
+			matched = matched || matchesType(value, name)
+		}
+		if !matched {
+			v.fail(path, "must be of type %v", expected)
+			return
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, typed, path)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range typed {
+				v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, object map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, present := object[name.(string)]; !present {
+				v.fail(path, "missing required property %q", name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(propertySchema, object[name], path+"."+name)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "unexpected property %q", name)
+			}
+		case map[string]interface{}:
+			v.validate(additional, object[name], path+"."+name)
+		}
+	}
+}
+
+// resolve looks up a local reference such as #/$defs/metric
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var current interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		current = node[part]
+	}
+	resolved, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return resolved, nil
+}
+
+// matchesType reports whether a decoded JSON value has the given JSON Schema type
+func matchesType(value interface{}, expected string) bool {
+	switch expected {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return false
+	}
+}
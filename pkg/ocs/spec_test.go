@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testPromptConfig is an OCS config with one metric, policy and declared workload
+func testPromptConfig() *OCSConfig {
+	return &OCSConfig{
+		Metrics: []MetricConfig{{
+			Name:             "cpu",
+			Type:             "gauge",
+			Unit:             "percentage",
+			Description:      "CPU usage",
+			AggregationLogic: "average",
+		}},
+		Policy:   []string{"page on sla breach"},
+		Workload: []string{"app"},
+		Identity: IdentityConfig{Environment: "test"},
+		ResourceTypes: map[string]ResourceTypeConfig{
+			ResourceTypeNamespace: {},
+		},
+	}
+}
+
+// testPromptSnapshot is a ranged snapshot of app -> database, with an external host
+func testPromptSnapshot() *AdjacencyListDocument {
+	windowStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(5 * time.Minute)
+	return &AdjacencyListDocument{
+		ID:            primitive.NewObjectID(),
+		AdjacencyList: map[string][]string{"app": {"database", "api.example.com"}},
+		Timestamp:     windowEnd,
+		CollectedAt:   windowEnd.Add(3 * time.Second),
+		WindowStart:   &windowStart,
+		WindowEnd:     &windowEnd,
+		Step:          defaultQueryStep,
+		Connector:     "istio",
+		ExternalHosts: []string{"api.example.com"},
+		WorkloadOrigins: map[string]WorkloadOrigin{
+			"app":      {Namespace: "shop", Cluster: "east"},
+			"database": {Namespace: "shop", Cluster: "east"},
+		},
+		NodeSources: map[string][]string{"app": {"istio"}, "database": {"istio"}, "api.example.com": {"istio"}},
+	}
+}
+
+// testPromptResponse builds the latest-spec prompt response for a snapshot
+func testPromptResponse(snapshot *AdjacencyListDocument, config *OCSConfig) OCSPromptResponse {
+	definitions := buildContextDefinitions(snapshot, config)
+	decorateContextDefinitions(definitions, snapshot, config)
+	return OCSPromptResponse{
+		SpecVersion:        LatestSpecVersion,
+		ContextDefinitions: definitions,
+		Temporal:           buildTemporalContext(snapshot, config),
+	}
+}
+
+func TestConvertToSpecVersion(t *testing.T) {
+	// emptyConfig declares no workloads, so an empty snapshot has nothing to describe
+	emptyConfig := testPromptConfig()
+	emptyConfig.Workload = nil
+	emptySnapshot := &AdjacencyListDocument{ID: primitive.NewObjectID(), AdjacencyList: map[string][]string{}}
+
+	tests := []struct {
+		name     string
+		version  string
+		snapshot *AdjacencyListDocument
+		config   *OCSConfig // testPromptConfig() if nil
+		want     string     // exact JSON for 0.1, which must not change
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "0.1 keeps the original wire format",
+			version:  SpecVersion01,
+			snapshot: testPromptSnapshot(),
+			want: `{"spec_version":"0.1","context_definitions":[` +
+				`{"resource_id":"workload-api.example.com","domain":"compute.k8s","identity":{"workload":"api.example.com"},` +
+				`"metrics":[{"Name":"cpu","Type":"gauge","Unit":"percentage","Description":"CPU usage","AggregationLogic":"average","HealthConfig":null}],` +
+				`"topology":{"dependents":["app"]},"policy":["page on sla breach"]},` +
+				`{"resource_id":"workload-app","domain":"compute.k8s","identity":{"workload":"app"},` +
+				`"metrics":[{"Name":"cpu","Type":"gauge","Unit":"percentage","Description":"CPU usage","AggregationLogic":"average","HealthConfig":null}],` +
+				`"topology":{"dependencies":["api.example.com","database"]},"policy":["page on sla breach"]},` +
+				`{"resource_id":"workload-database","domain":"compute.k8s","identity":{"workload":"database"},` +
+				`"metrics":[{"Name":"cpu","Type":"gauge","Unit":"percentage","Description":"CPU usage","AggregationLogic":"average","HealthConfig":null}],` +
+				`"topology":{"dependents":["app"]},"policy":["page on sla breach"]}]}`,
+		},
+		{
+			name:     "0.1 without a snapshot describes configured workloads",
+			version:  SpecVersion01,
+			snapshot: nil,
+			want: `{"spec_version":"0.1","context_definitions":[` +
+				`{"resource_id":"workload-app","domain":"compute.k8s","identity":{"workload":"app"},` +
+				`"metrics":[{"Name":"cpu","Type":"gauge","Unit":"percentage","Description":"CPU usage","AggregationLogic":"average","HealthConfig":null}],` +
+				`"policy":["page on sla breach"]}]}`,
+		},
+		{
+			name:     "0.1 with an empty snapshot lists no definitions",
+			version:  SpecVersion01,
+			snapshot: emptySnapshot,
+			config:   emptyConfig,
+			want:     `{"spec_version":"0.1","context_definitions":[]}`,
+		},
+		{
+			name:     "0.2 with an empty snapshot lists no definitions",
+			version:  SpecVersion02,
+			snapshot: emptySnapshot,
+			config:   emptyConfig,
+			contains: []string{`"context_definitions":[]`},
+		},
+		{
+			name:     "0.2 carries every block",
+			version:  SpecVersion02,
+			snapshot: testPromptSnapshot(),
+			contains: []string{
+				`"spec_version":"0.2"`,
+				`"resource_id":"external-api.example.com"`,
+				`"resource_id":"namespace-shop"`,
+				`"namespace":"shop"`,
+				`"environment":"test"`,
+				`"name":"cpu"`,
+				`"temporal":{`,
+				`"value_type":"trend"`,
+				`"stale_after":"2024-01-01T00:20:00Z"`,
+				`"provenance":[`,
+			},
+			excludes: []string{`"Name"`, `"age_seconds"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			if config == nil {
+				config = testPromptConfig()
+			}
+			response, err := convertToSpecVersion(testPromptResponse(tt.snapshot, config), tt.version, config)
+			if err != nil {
+				t.Fatalf("convertToSpecVersion() error = %v", err)
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if tt.want != "" && string(data) != tt.want {
+				t.Errorf("convertToSpecVersion() =\n%s\nwant\n%s", data, tt.want)
+			}
+			for _, fragment := range tt.contains {
+				if !strings.Contains(string(data), fragment) {
+					t.Errorf("response is missing %s: %s", fragment, data)
+				}
+			}
+			for _, fragment := range tt.excludes {
+				if strings.Contains(string(data), fragment) {
+					t.Errorf("response contains %s: %s", fragment, data)
+				}
+			}
+			if err := validateOCSResponse(tt.version, response); err != nil {
+				t.Errorf("validateOCSResponse() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConvertToSpecVersionUnsupported(t *testing.T) {
+	if _, err := convertToSpecVersion(OCSPromptResponse{}, "9.9", testPromptConfig()); err == nil {
+		t.Error("convertToSpecVersion() succeeded for an unsupported version")
+	}
+}
+
+func TestValidateOCSResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		response string
+		wantErr  string
+	}{
+		{
+			name:     "valid 0.1",
+			version:  SpecVersion01,
+			response: `{"spec_version":"0.1","context_definitions":[{"resource_id":"workload-app","metrics":[{"Name":"cpu","Type":"gauge","Unit":"","Description":"","AggregationLogic":"","HealthConfig":{"critical_threshold":90}}]}]}`,
+		},
+		{
+			name:     "0.1 metric with 0.2 keys",
+			version:  SpecVersion01,
+			response: `{"spec_version":"0.1","context_definitions":[{"metrics":[{"name":"cpu","type":"gauge","unit":"","description":""}]}]}`,
+			wantErr:  `missing required property "Name"`,
+		},
+		{
+			name:     "0.1 with a 0.2 block",
+			version:  SpecVersion01,
+			response: `{"spec_version":"0.1","context_definitions":[],"content_hash":"abc"}`,
+			wantErr:  `unexpected property "content_hash"`,
+		},
+		{
+			name:     "0.1 wrong spec version",
+			version:  SpecVersion01,
+			response: `{"spec_version":"0.2","context_definitions":[]}`,
+			wantErr:  "$.spec_version: must be 0.1",
+		},
+		{
+			name:     "valid 0.2",
+			version:  SpecVersion02,
+			response: `{"spec_version":"0.2","context_definitions":[{"resource_id":"workload-app","temporal":{"value_type":"point_in_time"}}]}`,
+		},
+		{
+			name:     "0.2 bad value type",
+			version:  SpecVersion02,
+			response: `{"spec_version":"0.2","context_definitions":[{"temporal":{"value_type":"live"}}]}`,
+			wantErr:  "value_type: must be one of",
+		},
+		{
+			name:     "0.2 missing context definitions",
+			version:  SpecVersion02,
+			response: `{"spec_version":"0.2"}`,
+			wantErr:  `missing required property "context_definitions"`,
+		},
+		{
+			name:     "unsupported version",
+			version:  "9.9",
+			response: `{}`,
+			wantErr:  "unsupported spec_version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response interface{}
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			err := validateOCSResponse(tt.version, response)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateOCSResponse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateOCSResponse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceStatic identifies topology imported from a file rather than observed
+const SourceStatic = "static"
+
+// StaticTopology is an adjacency list loaded from a YAML or JSON file. Its fields use the same
+// names as the matching AdjacencyListDocument fields.
+type StaticTopology struct {
+	AdjacencyList map[string][]string           `yaml:"adjacency_list"`
+	EdgeTraffic   map[string]map[string]float64 `yaml:"edge_traffic"`
+	// EdgeAttributes holds free-form attributes per source -> destination edge, e.g. protocol
+	EdgeAttributes  map[string]map[string]map[string]interface{} `yaml:"edge_attributes"`
+	WorkloadOrigins map[string]WorkloadOrigin                    `yaml:"workload_origins"`
+	Services        map[string][]string                          `yaml:"services"`
+	ExternalHosts   []string                                     `yaml:"external_hosts"`
+
+	// hash identifies the topology's content, whatever the file's formatting
+	hash string
+}
+
+// parseStaticTopology decodes and validates a static topology. JSON is accepted as YAML, and
+// unknown fields are rejected so typos do not silently drop data.
+func parseStaticTopology(data []byte) (*StaticTopology, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var topology StaticTopology
+	if err := decoder.Decode(&topology); err != nil {
+		return nil, fmt.Errorf("failed to parse static topology: %w", err)
+	}
+	if err := topology.validate(); err != nil {
+		return nil, fmt.Errorf("invalid static topology: %w", err)
+	}
+	hash, err := computeContentHash(topology)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash static topology: %w", err)
+	}
+	topology.hash = hash
+	return &topology, nil
+}
+
+// loadStaticTopology reads and validates a static topology file
+func loadStaticTopology(path string) (*StaticTopology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static topology: %w", err)
+	}
+	topology, err := parseStaticTopology(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return topology, nil
+}
+
+// validate checks that the topology has edges, that every name is non-empty and that traffic
+// and attributes only describe edges in the adjacency list
+func (t *StaticTopology) validate() error {
+	if len(t.AdjacencyList) == 0 {
+		return fmt.Errorf("adjacency_list is required")
+	}
+	for source, destinations := range t.AdjacencyList {
+		if source == "" {
+			return fmt.Errorf("adjacency_list has an empty source")
+		}
+		for _, destination := range destinations {
+			if destination == "" {
+				return fmt.Errorf("adjacency_list.%s has an empty destination", source)
+			}
+		}
+	}
+	for source, destinations := range t.EdgeTraffic {
+		for destination, traffic := range destinations {
+			if !hasEdge(t.AdjacencyList, source, destination) {
+				return fmt.Errorf("edge_traffic.%s.%s is not an edge in adjacency_list", source, destination)
+			}
+			if traffic < 0 || math.IsNaN(traffic) || math.IsInf(traffic, 0) {
+				return fmt.Errorf("edge_traffic.%s.%s must be a non-negative number", source, destination)
+			}
+		}
+	}
+	for source, destinations := range t.EdgeAttributes {
+		for destination := range destinations {
+			if !hasEdge(t.AdjacencyList, source, destination) {
+				return fmt.Errorf("edge_attributes.%s.%s is not an edge in adjacency_list", source, destination)
+			}
+		}
+	}
+	for workload := range t.WorkloadOrigins {
+		if !hasWorkload(t.AdjacencyList, workload) {
+			return fmt.Errorf("workload_origins.%s is not a node in adjacency_list", workload)
+		}
+	}
+	for service, workloads := range t.Services {
+		if service == "" || len(workloads) == 0 {
+			return fmt.Errorf("services.%s must name at least one workload", service)
+		}
+	}
+	for _, host := range t.ExternalHosts {
+		if !hasWorkload(t.AdjacencyList, host) {
+			return fmt.Errorf("external_hosts entry %s is not a node in adjacency_list", host)
+		}
+	}
+	return nil
+}
+
+// toSnapshot converts the topology into a snapshot document tagged as static
+func (t *StaticTopology) toSnapshot() AdjacencyListDocument {
+	nodeSources := make(map[string][]string)
+	for source, destinations := range t.AdjacencyList {
+		nodeSources[source] = []string{SourceStatic}
+		for _, destination := range destinations {
+			nodeSources[destination] = []string{SourceStatic}
+		}
+	}
+	externalHosts := sortedCopy(t.ExternalHosts)
+	if len(externalHosts) == 0 {
+		externalHosts = nil
+	}
+
+	return AdjacencyListDocument{
+		AdjacencyList:   t.AdjacencyList,
+		EdgeTraffic:     t.EdgeTraffic,
+		EdgeAttributes:  t.EdgeAttributes,
+		Connector:       SourceStatic,
+		WorkloadOrigins: t.WorkloadOrigins,
+		Services:        t.Services,
+		ExternalHosts:   externalHosts,
+		NodeSources:     nodeSources,
+		ImportHash:      t.hash,
+	}
+}
+
+// StaticProvider contributes the static_topology file to each collection, so imported topology
+// is merged with observed topology. Its position in the providers list decides which wins.
+type StaticProvider struct {
+	// topology is the file as read when the configuration was loaded
+	topology *StaticTopology
+}
+
+// newStaticProviders creates a static provider for the static_topology file, which is read once
+func newStaticProviders(config *OCSConfig, promConfig *PrometheusConfig) ([]ContextProvider, error) {
+	if config.StaticTopology == "" {
+		return nil, fmt.Errorf("static_topology is not set in ocs_config.yaml")
+	}
+	topology, err := loadStaticTopology(config.StaticTopology)
+	if err != nil {
+		return nil, err
+	}
+	return []ContextProvider{&StaticProvider{topology: topology}}, nil
+}
+
+// Name returns the provider name recorded on the facts this provider contributes
+func (sp *StaticProvider) Name() string {
+	return SourceStatic
+}
+
+// Instance returns no instance, as static topology is not read from Prometheus
+func (sp *StaticProvider) Instance() string {
+	return ""
+}
+
+// DiscoverEntities returns the workloads, external hosts and services in the file
+func (sp *StaticProvider) DiscoverEntities(ctx context.Context, req CollectionRequest) ([]Entity, error) {
+	topology := sp.topology
+	var entities []Entity
+	for workload, origin := range topology.WorkloadOrigins {
+		entities = append(entities, Entity{
+			Name:      workload,
+			Type:      ResourceTypeWorkload,
+			Namespace: origin.Namespace,
+			Cluster:   origin.Cluster,
+		})
+	}
+	for _, host := range topology.ExternalHosts {
+		entities = append(entities, Entity{Name: host, Type: ResourceTypeExternalHost})
+	}
+	for service, workloads := range topology.Services {
+		entities = append(entities, Entity{Name: service, Type: ResourceTypeService, Members: workloads})
+	}
+	return entities, nil
+}
+
+// DiscoverRelationships returns the edges in the file with their traffic and attributes
+func (sp *StaticProvider) DiscoverRelationships(ctx context.Context, req CollectionRequest) ([]Relationship, error) {
+	topology := sp.topology
+	sources := make([]string, 0, len(topology.AdjacencyList))
+	for source := range topology.AdjacencyList {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var relationships []Relationship
+	for _, source := range sources {
+		for _, destination := range topology.AdjacencyList[source] {
+			relationship := Relationship{
+				Source:      source,
+				Destination: destination,
+				Attributes:  topology.EdgeAttributes[source][destination],
+			}
+			if traffic, ok := topology.EdgeTraffic[source][destination]; ok {
+				relationship.Traffic = &traffic
+			}
+			relationships = append(relationships, relationship)
+		}
+	}
+	return relationships, nil
+}
+
+// FetchMetrics returns no samples, as static topology carries no metrics
+func (sp *StaticProvider) FetchMetrics(ctx context.Context, req CollectionRequest) ([]MetricSample, error) {
+	return nil, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticTopologyImportHash(t *testing.T) {
+	parse := func(data string) string {
+		t.Helper()
+		topology, err := parseStaticTopology([]byte(data))
+		if err != nil {
+			t.Fatalf("parseStaticTopology() error = %v", err)
+		}
+		if got := topology.toSnapshot().ImportHash; got != topology.hash || got == "" {
+			t.Fatalf("snapshot import hash = %q, want %q", got, topology.hash)
+		}
+		return topology.hash
+	}
+
+	yamlHash := parse("# demo topology\nadjacency_list:\n  app: [database]\n  proxy: [app]\n")
+	jsonHash := parse(`{"adjacency_list": {"proxy": ["app"], "app": ["database"]}}`)
+	changedHash := parse("adjacency_list:\n  app: [database, cache]\n  proxy: [app]\n")
+
+	if yamlHash != jsonHash {
+		t.Errorf("the same topology hashes differently as YAML (%s) and JSON (%s)", yamlHash, jsonHash)
+	}
+	if changedHash == yamlHash {
+		t.Error("a changed topology has the same import hash")
+	}
+}
+
+func TestStaticProviderReadsFileOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	if err := os.WriteFile(path, []byte("adjacency_list:\n  app: [database]\nedge_traffic:\n  app: {database: 12}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	providers, err := newStaticProviders(&OCSConfig{StaticTopology: path}, nil)
+	if err != nil {
+		t.Fatalf("newStaticProviders() error = %v", err)
+	}
+
+	// Collections use the topology read when the provider was built
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	relationships, err := providers[0].DiscoverRelationships(context.Background(), CollectionRequest{})
+	if err != nil {
+		t.Fatalf("DiscoverRelationships() error = %v", err)
+	}
+	if len(relationships) != 1 || relationships[0].Source != "app" || relationships[0].Destination != "database" ||
+		relationships[0].Traffic == nil || *relationships[0].Traffic != 12 {
+		t.Errorf("DiscoverRelationships() = %s, want app -> database with traffic 12", mustJSON(t, relationships))
+	}
+
+	if _, err := newStaticProviders(&OCSConfig{StaticTopology: path}, nil); err == nil {
+		t.Error("newStaticProviders() succeeded for a missing file")
+	}
+}
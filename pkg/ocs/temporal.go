@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStalenessThreshold is used when staleness_threshold_minutes is not configured
+const defaultStalenessThreshold = 15 * time.Minute
+
+// Values for TemporalContext.ValueType
+const (
+	ValueTypePointInTime = "point_in_time"
+	ValueTypeTrend       = "trend"
+)
+
+// buildTemporalContext describes when a snapshot's data was observed and when it turns stale.
+// It returns nil when there is no snapshot.
+func buildTemporalContext(snapshot *AdjacencyListDocument, config *OCSConfig) *TemporalContext {
+	if snapshot == nil {
+		return nil
+	}
+
+	// Data is as old as the end of its window, or its collection for point-in-time data
+	collectedAt := snapshot.collectionTime()
+	staleAfter := snapshot.Timestamp.Add(stalenessThreshold(config))
+	temporal := &TemporalContext{
+		CollectedAt: &collectedAt,
+		WindowStart: snapshot.WindowStart,
+		WindowEnd:   snapshot.WindowEnd,
+		ValueType:   ValueTypePointInTime,
+		StaleAfter:  &staleAfter,
+	}
+	if snapshot.WindowStart != nil && snapshot.WindowEnd != nil {
+		temporal.Step = snapshot.Step
+		temporal.ValueType = ValueTypeTrend
+	}
+	return temporal
+}
+
+// stalenessThreshold returns the configured age after which a snapshot is reported stale
+func stalenessThreshold(config *OCSConfig) time.Duration {
+	if config.StalenessThresholdMinutes != nil {
+		return time.Duration(*config.StalenessThresholdMinutes) * time.Minute
+	}
+	return defaultStalenessThreshold
+}
+
+// setFreshnessHeaders reports the data's age as of now in response headers. The age changes on
+// every request, so it is kept out of the body to leave the body and its ETag stable.
+func setFreshnessHeaders(c *gin.Context, temporal *TemporalContext, now time.Time) {
+	if temporal == nil || temporal.StaleAfter == nil {
+		return
+	}
+	observedAt := *temporal.CollectedAt
+	if temporal.WindowEnd != nil {
+		observedAt = *temporal.WindowEnd
+	}
+	c.Header("X-Data-Age-Seconds", strconv.Itoa(int(now.Sub(observedAt).Seconds())))
+	c.Header("X-Data-Stale", strconv.FormatBool(now.After(*temporal.StaleAfter)))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildTemporalContext(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(5 * time.Minute)
+	collectedAt := windowEnd.Add(3 * time.Second)
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name     string
+		snapshot *AdjacencyListDocument
+		config   OCSConfig
+		want     *TemporalContext
+	}{
+		{name: "no snapshot"},
+		{
+			name: "range is a trend stale after the default threshold",
+			snapshot: &AdjacencyListDocument{
+				Timestamp: windowEnd, CollectedAt: collectedAt, WindowStart: &windowStart, WindowEnd: &windowEnd, Step: "15s",
+			},
+			want: &TemporalContext{
+				CollectedAt: &collectedAt, WindowStart: &windowStart, WindowEnd: &windowEnd, Step: "15s",
+				ValueType: ValueTypeTrend, StaleAfter: at(windowEnd.Add(defaultStalenessThreshold)),
+			},
+		},
+		{
+			name:     "instant query is a point in time stale after the configured threshold",
+			snapshot: &AdjacencyListDocument{Timestamp: collectedAt, CollectedAt: collectedAt, Step: "15s"},
+			config:   OCSConfig{StalenessThresholdMinutes: intPointer(60)},
+			want: &TemporalContext{
+				CollectedAt: &collectedAt, ValueType: ValueTypePointInTime, StaleAfter: at(collectedAt.Add(time.Hour)),
+			},
+		},
+		{
+			name:     "snapshot saved before collected_at was recorded",
+			snapshot: &AdjacencyListDocument{Timestamp: collectedAt},
+			want: &TemporalContext{
+				CollectedAt: &collectedAt, ValueType: ValueTypePointInTime, StaleAfter: at(collectedAt.Add(defaultStalenessThreshold)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildTemporalContext(tt.snapshot, &tt.config)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildTemporalContext() = %s, want %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestSetFreshnessHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	windowStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windowEnd := windowStart.Add(5 * time.Minute)
+	collectedAt := windowEnd.Add(3 * time.Second)
+	staleAfter := windowEnd.Add(15 * time.Minute)
+	trend := &TemporalContext{CollectedAt: &collectedAt, WindowStart: &windowStart, WindowEnd: &windowEnd, ValueType: ValueTypeTrend, StaleAfter: &staleAfter}
+	pointInTime := &TemporalContext{CollectedAt: &collectedAt, ValueType: ValueTypePointInTime, StaleAfter: &staleAfter}
+
+	tests := []struct {
+		name      string
+		temporal  *TemporalContext
+		now       time.Time
+		wantAge   string
+		wantStale string
+	}{
+		{name: "age from the end of the window", temporal: trend, now: windowEnd.Add(10 * time.Minute), wantAge: "600", wantStale: "false"},
+		{name: "age from collection for instant queries", temporal: pointInTime, now: windowEnd.Add(10 * time.Minute), wantAge: "597", wantStale: "false"},
+		{name: "stale once past stale_after", temporal: trend, now: staleAfter.Add(time.Second), wantAge: "901", wantStale: "true"},
+		{name: "no snapshot", now: windowEnd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			setFreshnessHeaders(c, tt.temporal, tt.now)
+			if got := w.Header().Get("X-Data-Age-Seconds"); got != tt.wantAge {
+				t.Errorf("X-Data-Age-Seconds = %q, want %q", got, tt.wantAge)
+			}
+			if got := w.Header().Get("X-Data-Stale"); got != tt.wantStale {
+				t.Errorf("X-Data-Stale = %q, want %q", got, tt.wantStale)
+			}
+		})
+	}
+}
@@ -8,30 +8,186 @@ import (
 
 // MetricConfig represents a metric configuration
 type MetricConfig struct {
-	Name             string                 `yaml:"name"`
-	Type             string                 `yaml:"type"`
-	Unit             string                 `yaml:"unit"`
-	Description      string                 `yaml:"description"`
-	AggregationLogic string                 `yaml:"aggregation_logic,omitempty"`
-	HealthConfig     map[string]interface{} `yaml:"health_config,omitempty"`
+	Name             string                 `yaml:"name" json:"name" bson:"name"`
+	Type             string                 `yaml:"type" json:"type" bson:"type"`
+	Unit             string                 `yaml:"unit" json:"unit" bson:"unit"`
+	Description      string                 `yaml:"description" json:"description" bson:"description"`
+	AggregationLogic string                 `yaml:"aggregation_logic,omitempty" json:"aggregation_logic,omitempty" bson:"aggregation_logic,omitempty"`
+	HealthConfig     map[string]interface{} `yaml:"health_config,omitempty" json:"health_config,omitempty" bson:"health_config,omitempty"`
+}
+
+// Config is the unified service configuration: ocs_config.yaml, including its optional server
+// and mongodb sections, and the Prometheus config, with environment overrides applied
+type Config struct {
+	OCSConfig `yaml:",inline"`
+	// Profiles are further named sets of OCS settings served by the same server
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+	Server   ServerConfig             `yaml:"server"`
+	Auth     AuthConfig               `yaml:"auth"`
+	// CollectionLimits is shared by every profile
+	CollectionLimits CollectionLimitsConfig `yaml:"collection_limits"`
+	MongoDB          MongoDBConfig          `yaml:"mongodb"`
+	Prometheus       PrometheusConfig       `yaml:"-"` // Loaded from the Prometheus config file
+}
+
+// ProfileConfig is a named set of OCS settings with its own topology store. Settings it leaves
+// unset are taken from the top level of ocs_config.yaml, and its Prometheus instances, if any,
+// replace those of the Prometheus config.
+type ProfileConfig struct {
+	OCSConfig           `yaml:",inline"`
+	PrometheusInstances []PrometheusInstance `yaml:"prometheus_instances"`
+
+	// keys holds the settings the profile sets in the file, including those set to zero values
+	keys map[string]bool
+}
+
+// ServerConfig configures the HTTP server. Changes take effect on restart.
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// ValidateResponses checks every generated response against the published OCS schema
+	ValidateResponses bool `yaml:"validate_responses"`
+	// ImportTopology is a static topology file imported into the store at startup
+	ImportTopology string `yaml:"import_topology"`
+	// AdminToken is a bearer token with the admin scope, accepted whether or not auth is enabled.
+	// The runtime configuration API is disabled while neither it nor auth is set up.
+	AdminToken string `yaml:"admin_token"`
+	// TLSCertFile and TLSKeyFile serve HTTPS. ClientCAFile verifies the client certificates
+	// used for mTLS authentication.
+	TLSCertFile  string `yaml:"tls_cert_file"`
+	TLSKeyFile   string `yaml:"tls_key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies whose X-Forwarded-For
+	// header is believed. By default none are, and clients are identified by their connection.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// CollectionLimitsConfig limits how often collections may be triggered. A zero value disables
+// the limit. It is reloaded with the rest of ocs_config.yaml.
+type CollectionLimitsConfig struct {
+	// RequestsPerMinute is the sustained rate at which each client may trigger collections
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	// Burst is how many collections a client may trigger back to back; defaults to 1
+	Burst int `yaml:"burst"`
+	// MaxConcurrent is how many collections may run at once across all clients
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// AuthConfig configures how API clients authenticate and what each may do. It is reloaded
+// with the rest of ocs_config.yaml.
+type AuthConfig struct {
+	// Enabled requires every request except /health to authenticate
+	Enabled bool           `yaml:"enabled"`
+	APIKeys []APIKeyConfig `yaml:"api_keys"`
+	JWT     JWTConfig      `yaml:"jwt"`
+	MTLS    MTLSConfig     `yaml:"mtls"`
+}
+
+// APIKeyConfig is a static API key. Key holds the key itself, usually as an ${ENV} reference,
+// or KeySHA256 its hex-encoded SHA-256 hash.
+type APIKeyConfig struct {
+	Name      string   `yaml:"name"`
+	Key       string   `yaml:"key"`
+	KeySHA256 string   `yaml:"key_sha256"`
+	Scopes    []string `yaml:"scopes"`
+}
+
+// JWTConfig validates RS256 bearer tokens against the keys of a local JWKS file
+type JWTConfig struct {
+	JWKSFile string `yaml:"jwks_file"` // Empty disables JWT authentication
+	Issuer   string `yaml:"issuer"`    // Required iss claim, if set
+	Audience string `yaml:"audience"`  // Required aud claim, if set
+	// ScopesClaim names the claim holding the granted scopes, a space-separated string or a
+	// list. Defaults to scope.
+	ScopesClaim string `yaml:"scopes_claim"`
+}
+
+// MTLSConfig grants scopes to client certificates verified against server.client_ca_file
+type MTLSConfig struct {
+	Clients []MTLSClientConfig `yaml:"clients"`
+}
+
+// MTLSClientConfig grants scopes to the client certificates with a given subject common name
+type MTLSClientConfig struct {
+	CommonName string   `yaml:"common_name"`
+	Scopes     []string `yaml:"scopes"`
+}
+
+// MongoDBConfig configures the topology store. Changes take effect on restart.
+type MongoDBConfig struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
 }
 
 // OCSConfig represents the OCS configuration structure
 type OCSConfig struct {
-	Policy            []string       `yaml:"policy"`
-	Metrics           []MetricConfig `yaml:"metrics"`
-	Workload          []string       `yaml:"workload"`
-	TimeWindowMinutes *int           `yaml:"time_window_minutes"` // Optional: if set, use time window for queries
+	Policy                    []string       `yaml:"policy"`
+	Metrics                   []MetricConfig `yaml:"metrics"`
+	Workload                  []string       `yaml:"workload"`
+	TimeWindowMinutes         *int           `yaml:"time_window_minutes"`         // Optional: if set, use time window for queries
+	OutputSortKey             string         `yaml:"output_sort_key"`             // Optional: resource_id (default), workload or domain
+	StalenessThresholdMinutes *int           `yaml:"staleness_threshold_minutes"` // Optional: age after which a snapshot is reported stale
+	LatestSnapshot            string         `yaml:"latest_snapshot"`             // Optional: data_time (default) or collection_time
+	Identity                  IdentityConfig `yaml:"identity"`
+	// ResourceTypes overrides the domain and ID scheme per resource type, and enables
+	// definitions for services, namespaces and clusters when they are listed
+	ResourceTypes map[string]ResourceTypeConfig `yaml:"resource_types"`
+	Kubernetes    KubernetesConfig              `yaml:"kubernetes"`
+	IstioConfig   IstioConfigSourceConfig       `yaml:"istio_config"`
+	// DeclaredDependencies and ServiceCatalog declare the expected topology, which is
+	// reconciled against the observed one
+	DeclaredDependencies map[string][]string `yaml:"declared_dependencies"`
+	ServiceCatalog       string              `yaml:"service_catalog"`
+	// Providers lists the context providers that collect topology, in merge order. Defaults to istio.
+	Providers []string `yaml:"providers"`
+	// StaticTopology is a YAML or JSON topology file imported at startup and read by the static provider
+	StaticTopology string `yaml:"static_topology"`
+}
+
+// IstioConfigSourceConfig configures where Istio routing and security resources are read from
+type IstioConfigSourceConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Source is "kubernetes" to read from the API using the kubernetes section's credentials,
+	// or "directory" to read YAML manifests from Directory
+	Source    string `yaml:"source"`
+	Directory string `yaml:"directory"`
+}
+
+// KubernetesConfig configures the Kubernetes enrichment connector
+type KubernetesConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Kubeconfig string   `yaml:"kubeconfig"` // Empty uses the in-cluster service account
+	Context    string   `yaml:"context"`    // Empty uses the kubeconfig's current-context
+	Namespaces []string `yaml:"namespaces"` // Empty reads all namespaces
+}
+
+// ResourceTypeConfig configures how a resource type is described in context definitions
+type ResourceTypeConfig struct {
+	Domain     string   `yaml:"domain"`
+	IDTemplate string   `yaml:"id_template"` // Placeholders: {name}, {namespace}, {cluster}
+	Workloads  []string `yaml:"workloads"`   // database only: workloads to describe as databases
+}
+
+// IdentityConfig holds origin attributes added to every context definition's identity
+type IdentityConfig struct {
+	Environment string `yaml:"environment"`
+	MeshID      string `yaml:"mesh_id"`
+	Cluster     string `yaml:"cluster"` // Used when Prometheus labels carry no cluster
 }
 
 // PrometheusConfig represents Prometheus configuration
 type PrometheusConfig struct {
-	PrometheusInstances []struct {
-		Name       string            `yaml:"name"`
-		BaseURL    string            `yaml:"base_url"`
-		Headers    map[string]string `yaml:"headers"`
-		DisableSSL bool              `yaml:"disable_ssl"`
-	} `yaml:"prometheus_instances"`
+	PrometheusInstances []PrometheusInstance `yaml:"prometheus_instances"`
+}
+
+// PrometheusInstance represents one Prometheus server to collect from
+type PrometheusInstance struct {
+	Name       string            `yaml:"name"`
+	BaseURL    string            `yaml:"base_url"`
+	Headers    map[string]string `yaml:"headers"`
+	DisableSSL bool              `yaml:"disable_ssl"`
+	// Connector selects the provider that reads this instance, e.g. istio or linkerd.
+	// Empty means istio.
+	Connector string `yaml:"connector"`
 }
 
 // PrometheusQueryResult represents a Prometheus instant query result
@@ -60,11 +216,134 @@ type PrometheusQueryRangeResult struct {
 
 // AdjacencyListDocument represents the MongoDB document structure
 type AdjacencyListDocument struct {
-	ID               primitive.ObjectID  `bson:"_id,omitempty"`
-	AdjacencyList    map[string][]string `bson:"adjacency_list"`
-	Timestamp        time.Time           `bson:"timestamp"`
-	SourceCount      int                 `bson:"source_count"`
-	TotalConnections int                 `bson:"total_connections"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	AdjacencyList map[string][]string `bson:"adjacency_list"`
+	// Timestamp is when the data was observed: the end of the window for range queries, the
+	// collection time for instant ones
+	Timestamp        time.Time `bson:"timestamp"`
+	SourceCount      int       `bson:"source_count"`
+	TotalConnections int       `bson:"total_connections"`
+	// CollectedAt is when the snapshot was saved, and CollectorVersion the build that saved it
+	CollectedAt      time.Time `bson:"collected_at"`
+	CollectorVersion string    `bson:"collector_version,omitempty"`
+	// Query holds the parameters the topology was collected with
+	Query *SnapshotQuery `bson:"query,omitempty"`
+	// EdgeTraffic holds observed request volume per source -> destination edge, if known
+	EdgeTraffic map[string]map[string]float64 `bson:"edge_traffic,omitempty"`
+	// WindowStart and WindowEnd are the range the topology was derived from. Both are
+	// unset for instant queries.
+	WindowStart *time.Time `bson:"window_start,omitempty"`
+	WindowEnd   *time.Time `bson:"window_end,omitempty"`
+	Step        string     `bson:"step,omitempty"`
+	// Connector and PrometheusInstance record where the topology was collected from
+	Connector          string                    `bson:"connector,omitempty"`
+	PrometheusInstance string                    `bson:"prometheus_instance,omitempty"`
+	WorkloadOrigins    map[string]WorkloadOrigin `bson:"workload_origins,omitempty"`
+	// Services maps each destination service to the workloads backing it
+	Services map[string][]string `bson:"services,omitempty"`
+	// ExternalHosts lists destinations outside the mesh, identified by their destination_service
+	ExternalHosts []string `bson:"external_hosts,omitempty"`
+	// KubernetesWorkloads holds workload metadata from the Kubernetes API, keyed by namespace/name
+	KubernetesWorkloads map[string]KubernetesWorkload `bson:"kubernetes_workloads,omitempty"`
+	// EdgePolicies holds the configured Istio routing and security settings per source -> destination edge
+	EdgePolicies map[string]map[string]EdgePolicy `bson:"edge_policies,omitempty"`
+	// EntityAttributes holds provider-specific attributes per node
+	EntityAttributes map[string]map[string]interface{} `bson:"entity_attributes,omitempty"`
+	// MetricValues holds metric samples reported by providers per node
+	MetricValues map[string]map[string]float64 `bson:"metric_values,omitempty"`
+	// NodeSources lists the providers that reported each node
+	NodeSources map[string][]string `bson:"node_sources,omitempty"`
+	// EdgeAttributes holds provider-specific attributes per source -> destination edge
+	EdgeAttributes map[string]map[string]map[string]interface{} `bson:"edge_attributes,omitempty"`
+	// BackfillID is the backfill that reconstructed this snapshot, unset for live collections
+	BackfillID primitive.ObjectID `bson:"backfill_id,omitempty"`
+	// ImportHash identifies the static topology an imported snapshot was saved from
+	ImportHash string `bson:"import_hash,omitempty"`
+}
+
+// SnapshotQuery records the parameters a snapshot was collected with
+type SnapshotQuery struct {
+	Profile   string   `bson:"profile"`
+	Workloads []string `bson:"workloads"`
+	// TimeWindowMinutes is set when the window came from time_window_minutes rather than the request
+	TimeWindowMinutes *int `bson:"time_window_minutes,omitempty"`
+	// BucketMinutes is set for snapshots reconstructed by a backfill
+	BucketMinutes int `bson:"bucket_minutes,omitempty"`
+}
+
+// EdgePolicy represents the Istio configuration that applies to calls along an edge
+type EdgePolicy struct {
+	Timeout        string               `json:"timeout,omitempty" bson:"timeout,omitempty"`
+	Retries        *RetryPolicy         `json:"retries,omitempty" bson:"retries,omitempty"`
+	TrafficSplit   []TrafficSplitTarget `json:"traffic_split,omitempty" bson:"traffic_split,omitempty"`
+	CircuitBreaker *CircuitBreaker      `json:"circuit_breaker,omitempty" bson:"circuit_breaker,omitempty"`
+	MTLSMode       string               `json:"mtls_mode,omitempty" bson:"mtls_mode,omitempty"`
+	// Resources lists the Istio resources the policy was derived from, as kind/namespace/name
+	Resources []string `json:"resources" bson:"resources"`
+	// Summary is a one-line, human-readable description of the policy for prompts
+	Summary string `json:"summary" bson:"summary"`
+}
+
+// RetryPolicy represents VirtualService retry settings
+type RetryPolicy struct {
+	Attempts      int    `json:"attempts" bson:"attempts"`
+	PerTryTimeout string `json:"per_try_timeout,omitempty" bson:"per_try_timeout,omitempty"`
+	RetryOn       string `json:"retry_on,omitempty" bson:"retry_on,omitempty"`
+}
+
+// TrafficSplitTarget represents one weighted VirtualService route destination
+type TrafficSplitTarget struct {
+	Host   string `json:"host" bson:"host"`
+	Subset string `json:"subset,omitempty" bson:"subset,omitempty"`
+	Weight int    `json:"weight" bson:"weight"`
+}
+
+// CircuitBreaker represents DestinationRule connection pool and outlier detection settings
+type CircuitBreaker struct {
+	MaxConnections        int    `json:"max_connections,omitempty" bson:"max_connections,omitempty"`
+	MaxPendingRequests    int    `json:"max_pending_requests,omitempty" bson:"max_pending_requests,omitempty"`
+	Consecutive5xxErrors  int    `json:"consecutive_5xx_errors,omitempty" bson:"consecutive_5xx_errors,omitempty"`
+	OutlierInterval       string `json:"outlier_interval,omitempty" bson:"outlier_interval,omitempty"`
+	BaseEjectionTime      string `json:"base_ejection_time,omitempty" bson:"base_ejection_time,omitempty"`
+	MaxEjectionPercentage int    `json:"max_ejection_percent,omitempty" bson:"max_ejection_percent,omitempty"`
+}
+
+// KubernetesWorkload represents the Kubernetes metadata of a Deployment or StatefulSet
+type KubernetesWorkload struct {
+	Kind          string                `json:"kind" bson:"kind"`
+	Name          string                `json:"name" bson:"name"`
+	Namespace     string                `json:"namespace" bson:"namespace"`
+	Owner         string                `json:"owner,omitempty" bson:"owner,omitempty"`
+	Replicas      int32                 `json:"replicas" bson:"replicas"`
+	ReadyReplicas int32                 `json:"ready_replicas" bson:"ready_replicas"`
+	Pods          int                   `json:"pods" bson:"pods"`
+	PodRestarts   int32                 `json:"pod_restarts" bson:"pod_restarts"`
+	Labels        map[string]string     `json:"labels,omitempty" bson:"labels,omitempty"`
+	Annotations   map[string]string     `json:"annotations,omitempty" bson:"annotations,omitempty"`
+	Containers    []KubernetesContainer `json:"containers,omitempty" bson:"containers,omitempty"`
+	HPA           *KubernetesHPA        `json:"hpa,omitempty" bson:"hpa,omitempty"`
+}
+
+// KubernetesContainer represents a container of a workload's pod template
+type KubernetesContainer struct {
+	Name     string            `json:"name" bson:"name"`
+	Image    string            `json:"image" bson:"image"`
+	Requests map[string]string `json:"requests,omitempty" bson:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty" bson:"limits,omitempty"`
+}
+
+// KubernetesHPA represents the HorizontalPodAutoscaler targeting a workload
+type KubernetesHPA struct {
+	Name                 string `json:"name" bson:"name"`
+	MinReplicas          int32  `json:"min_replicas" bson:"min_replicas"`
+	MaxReplicas          int32  `json:"max_replicas" bson:"max_replicas"`
+	TargetCPUUtilization *int32 `json:"target_cpu_utilization,omitempty" bson:"target_cpu_utilization,omitempty"`
+}
+
+// WorkloadOrigin represents where a workload runs, as reported by metric labels
+type WorkloadOrigin struct {
+	Namespace string `bson:"namespace,omitempty" yaml:"namespace"`
+	Cluster   string `bson:"cluster,omitempty" yaml:"cluster"`
 }
 
 // OCSContextDefinition represents a context definition in the OCS prompt response
@@ -75,10 +354,375 @@ type OCSContextDefinition struct {
 	Metrics    []MetricConfig         `json:"metrics,omitempty"`
 	Topology   map[string]interface{} `json:"topology,omitempty"`
 	Policy     []string               `json:"policy,omitempty"`
+	Temporal   *TemporalContext       `json:"temporal,omitempty"`
+	Provenance []ProvenanceEntry      `json:"provenance,omitempty"`
+	Kubernetes *KubernetesWorkload    `json:"kubernetes,omitempty"`
+	RootCause  *RootCauseCandidate    `json:"root_cause,omitempty"`
+	// Attributes and ObservedMetrics carry what context providers reported for the resource
+	Attributes      map[string]interface{} `json:"attributes,omitempty"`
+	ObservedMetrics map[string]float64     `json:"observed_metrics,omitempty"`
+
+	// node is the topology graph node this definition describes, empty for derived resources
+	node string
+}
+
+// ProvenanceEntry records which source produced a fact in a context definition
+type ProvenanceEntry struct {
+	Fact       string `json:"fact"`
+	Source     string `json:"source"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// TemporalContext describes when the data behind a context definition was observed
+type TemporalContext struct {
+	CollectedAt *time.Time `json:"collected_at,omitempty"`
+	WindowStart *time.Time `json:"window_start,omitempty"`
+	WindowEnd   *time.Time `json:"window_end,omitempty"`
+	Step        string     `json:"step,omitempty"`
+	// ValueType is "trend" for topology derived from a range, "point_in_time" otherwise
+	ValueType string `json:"value_type"`
+	// StaleAfter is when the data becomes older than staleness_threshold_minutes
+	StaleAfter *time.Time `json:"stale_after,omitempty"`
 }
 
 // OCSPromptResponse represents the OCS prompt response structure
 type OCSPromptResponse struct {
 	SpecVersion        string                 `json:"spec_version"`
 	ContextDefinitions []OCSContextDefinition `json:"context_definitions"`
+	Temporal           *TemporalContext       `json:"temporal,omitempty"`
+	ContentHash        string                 `json:"content_hash,omitempty"`
+}
+
+// ImpactedWorkload represents a workload affected by a degraded workload or edge
+type ImpactedWorkload struct {
+	Workload string `json:"workload"`
+	Hops     int    `json:"hops"`
+	// Via lists the already-impacted workloads this workload depends on
+	Via []string `json:"via,omitempty"`
+	// TrafficFractionAffected is the share of this workload's outbound traffic that goes
+	// to impacted workloads. Only set when edge traffic is known.
+	TrafficFractionAffected *float64 `json:"traffic_fraction_affected,omitempty"`
+}
+
+// ImpactAnalysisResponse represents the blast radius of a degraded workload or edge
+type ImpactAnalysisResponse struct {
+	Workload          string             `json:"workload"`
+	FailingEdge       *Edge              `json:"failing_edge,omitempty"`
+	ImpactedWorkloads []ImpactedWorkload `json:"impacted_workloads"`
+	TrafficKnown      bool               `json:"traffic_known"`
+}
+
+// Edge represents a directed source -> destination call relationship
+type Edge struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// RootCauseRequest represents the observed unhealthy state to explain
+type RootCauseRequest struct {
+	UnhealthyWorkloads []string `json:"unhealthy_workloads"`
+	// MetricValues holds observed values per workload and metric name, evaluated
+	// against each metric's health_config
+	MetricValues map[string]map[string]float64 `json:"metric_values,omitempty"`
+}
+
+// MetricEvidence represents a metric observation evaluated against its health config
+type MetricEvidence struct {
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Polarity  string  `json:"polarity"`
+	Healthy   bool    `json:"healthy"`
+}
+
+// RootCauseCandidate represents a workload ranked as a possible root cause
+type RootCauseCandidate struct {
+	Workload string  `json:"workload"`
+	Rank     int     `json:"rank"`
+	Score    float64 `json:"score"`
+	// Explains lists the unhealthy workloads that are this workload or transitively depend on it
+	Explains []string `json:"explains"`
+	Coverage float64  `json:"coverage"`
+	// UnhealthyDependencies lists unhealthy workloads this workload depends on. A candidate
+	// with none is the deepest unhealthy point on its dependency chain.
+	UnhealthyDependencies []string         `json:"unhealthy_dependencies,omitempty"`
+	Evidence              []MetricEvidence `json:"evidence,omitempty"`
+}
+
+// kubeconfig represents the parts of a kubeconfig file used by the Kubernetes connector
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// k8sObjectMeta represents Kubernetes object metadata
+type k8sObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"ownerReferences"`
+}
+
+// k8sWorkloadList represents a list of Deployments or StatefulSets
+type k8sWorkloadList struct {
+	Items []struct {
+		Metadata k8sObjectMeta `json:"metadata"`
+		Spec     struct {
+			Replicas *int32 `json:"replicas"`
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Name      string `json:"name"`
+						Image     string `json:"image"`
+						Resources struct {
+							Requests map[string]string `json:"requests"`
+							Limits   map[string]string `json:"limits"`
+						} `json:"resources"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+		Status struct {
+			ReadyReplicas int32 `json:"readyReplicas"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// k8sPodList represents a list of Pods
+type k8sPodList struct {
+	Items []struct {
+		Metadata k8sObjectMeta `json:"metadata"`
+		Status   struct {
+			ContainerStatuses []struct {
+				RestartCount int32 `json:"restartCount"`
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// k8sHPAList represents a list of autoscaling/v2 HorizontalPodAutoscalers
+type k8sHPAList struct {
+	Items []struct {
+		Metadata k8sObjectMeta `json:"metadata"`
+		Spec     struct {
+			ScaleTargetRef struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"scaleTargetRef"`
+			MinReplicas *int32 `json:"minReplicas"`
+			MaxReplicas int32  `json:"maxReplicas"`
+			Metrics     []struct {
+				Resource *struct {
+					Name   string `json:"name"`
+					Target struct {
+						AverageUtilization *int32 `json:"averageUtilization"`
+					} `json:"target"`
+				} `json:"resource"`
+			} `json:"metrics"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// istioResourceMeta represents the metadata of an Istio resource, from the API or a manifest
+type istioResourceMeta struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+// istioVirtualService represents the parts of a networking.istio.io VirtualService used for edge policies
+type istioVirtualService struct {
+	Metadata istioResourceMeta `json:"metadata" yaml:"metadata"`
+	Spec     struct {
+		Hosts []string         `json:"hosts" yaml:"hosts"`
+		HTTP  []istioHTTPRoute `json:"http" yaml:"http"`
+	} `json:"spec" yaml:"spec"`
+}
+
+// istioHTTPRoute represents one HTTP route of a VirtualService
+type istioHTTPRoute struct {
+	Route []struct {
+		Destination struct {
+			Host   string `json:"host" yaml:"host"`
+			Subset string `json:"subset" yaml:"subset"`
+		} `json:"destination" yaml:"destination"`
+		Weight int `json:"weight" yaml:"weight"`
+	} `json:"route" yaml:"route"`
+	Timeout string `json:"timeout" yaml:"timeout"`
+	Retries *struct {
+		Attempts      int    `json:"attempts" yaml:"attempts"`
+		PerTryTimeout string `json:"perTryTimeout" yaml:"perTryTimeout"`
+		RetryOn       string `json:"retryOn" yaml:"retryOn"`
+	} `json:"retries" yaml:"retries"`
+}
+
+// istioDestinationRule represents the parts of a networking.istio.io DestinationRule used for edge policies
+type istioDestinationRule struct {
+	Metadata istioResourceMeta `json:"metadata" yaml:"metadata"`
+	Spec     struct {
+		Host          string `json:"host" yaml:"host"`
+		TrafficPolicy *struct {
+			ConnectionPool *struct {
+				TCP *struct {
+					MaxConnections int `json:"maxConnections" yaml:"maxConnections"`
+				} `json:"tcp" yaml:"tcp"`
+				HTTP *struct {
+					HTTP1MaxPendingRequests int `json:"http1MaxPendingRequests" yaml:"http1MaxPendingRequests"`
+				} `json:"http" yaml:"http"`
+			} `json:"connectionPool" yaml:"connectionPool"`
+			OutlierDetection *struct {
+				Consecutive5xxErrors int    `json:"consecutive5xxErrors" yaml:"consecutive5xxErrors"`
+				Interval             string `json:"interval" yaml:"interval"`
+				BaseEjectionTime     string `json:"baseEjectionTime" yaml:"baseEjectionTime"`
+				MaxEjectionPercent   int    `json:"maxEjectionPercent" yaml:"maxEjectionPercent"`
+			} `json:"outlierDetection" yaml:"outlierDetection"`
+		} `json:"trafficPolicy" yaml:"trafficPolicy"`
+	} `json:"spec" yaml:"spec"`
+}
+
+// istioPeerAuthentication represents a security.istio.io PeerAuthentication
+type istioPeerAuthentication struct {
+	Metadata istioResourceMeta `json:"metadata" yaml:"metadata"`
+	Spec     struct {
+		Selector *struct {
+			MatchLabels map[string]string `json:"matchLabels" yaml:"matchLabels"`
+		} `json:"selector" yaml:"selector"`
+		MTLS *struct {
+			Mode string `json:"mode" yaml:"mode"`
+		} `json:"mtls" yaml:"mtls"`
+	} `json:"spec" yaml:"spec"`
+}
+
+// TopologyReconciliation represents the differences between declared and observed topology
+type TopologyReconciliation struct {
+	// Declared is false when no dependencies are declared, in which case nothing is reconciled
+	Declared         bool     `json:"declared"`
+	UndeclaredEdges  []Edge   `json:"undeclared_edges"`
+	UnobservedEdges  []Edge   `json:"unobserved_edges"`
+	UnknownWorkloads []string `json:"unknown_workloads"`
+}
+
+// RuntimeListChanges records the entries added to and removed from a list in ocs_config.yaml
+type RuntimeListChanges struct {
+	Added   []string `bson:"added,omitempty" json:"added,omitempty"`
+	Removed []string `bson:"removed,omitempty" json:"removed,omitempty"`
+}
+
+// RuntimeConfig holds the changes made through the runtime configuration API. It is merged over
+// ocs_config.yaml, so file entries that were not changed at runtime keep following the file.
+type RuntimeConfig struct {
+	Workloads RuntimeListChanges `bson:"workloads" json:"workloads"`
+	Policies  RuntimeListChanges `bson:"policies" json:"policies"`
+	// Metrics are added, or replace the file metric of the same name
+	Metrics        []MetricConfig `bson:"metrics,omitempty" json:"metrics,omitempty"`
+	RemovedMetrics []string       `bson:"removed_metrics,omitempty" json:"removed_metrics,omitempty"`
+}
+
+// RuntimeConfigDocument is one version of the runtime configuration as stored in MongoDB.
+// Every change is saved as a new version.
+type RuntimeConfigDocument struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Version   int                `bson:"version" json:"version"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+	// Change describes what this version changed, e.g. "add workload payments"
+	Change string        `bson:"change" json:"change"`
+	Config RuntimeConfig `bson:"config" json:"config"`
+}
+
+// CollectionJob is a collection started with collect_istio_metrics?async=true
+type CollectionJob struct {
+	ID string `json:"id"`
+	// Kind is collection for collect_istio_metrics?async=true and backfill for topology/backfill
+	Kind          string      `json:"kind"`
+	Profile       string      `json:"profile"`
+	Status        string      `json:"status"`
+	Principal     string      `json:"principal"`
+	FromTimestamp *time.Time  `json:"from_timestamp,omitempty"`
+	ToTimestamp   *time.Time  `json:"to_timestamp,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	StartedAt     *time.Time  `json:"started_at,omitempty"`
+	FinishedAt    *time.Time  `json:"finished_at,omitempty"`
+	Progress      JobProgress `json:"progress"`
+	// DocumentID is the saved snapshot once a collection job has succeeded
+	DocumentID string `json:"document_id,omitempty"`
+	// BackfillID is the backfill a backfill job runs
+	BackfillID string `json:"backfill_id,omitempty"`
+	// Shared is set when the job waited for an identical collection instead of running its own
+	Shared bool   `json:"shared"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JobProgress reports how many chunks of its range a job has collected
+type JobProgress struct {
+	ChunksDone  int `json:"chunks_done"`
+	ChunksTotal int `json:"chunks_total"`
+	// BucketsDone and BucketsTotal count the snapshots of a backfill job, including those
+	// saved by earlier runs of the backfill
+	BucketsDone  int                `json:"buckets_done,omitempty"`
+	BucketsTotal int                `json:"buckets_total,omitempty"`
+	Providers    []ProviderProgress `json:"providers"`
+}
+
+// ProviderProgress reports how far one provider, and the Prometheus instance it reads, has got
+type ProviderProgress struct {
+	Provider    string `json:"provider"`
+	Instance    string `json:"instance,omitempty"`
+	Status      string `json:"status"`
+	ChunksDone  int    `json:"chunks_done"`
+	ChunksTotal int    `json:"chunks_total"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BackfillDocument records a backfill in MongoDB, so that an interrupted one can be resumed
+type BackfillDocument struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Profile       string             `bson:"profile" json:"profile"`
+	From          time.Time          `bson:"from" json:"from_timestamp"`
+	To            time.Time          `bson:"to" json:"to_timestamp"`
+	BucketMinutes int                `bson:"bucket_minutes" json:"bucket_minutes"`
+	// Workloads and Providers are what the backfill collects, fixed when it starts so a resumed
+	// backfill matches the snapshots it already saved
+	Workloads []string `bson:"workloads" json:"workloads"`
+	Providers []string `bson:"providers" json:"providers"`
+	Status    string   `bson:"status" json:"status"`
+	// BucketsDone counts the buckets whose snapshot has been saved
+	BucketsDone  int    `bson:"buckets_done" json:"buckets_done"`
+	BucketsTotal int    `bson:"buckets_total" json:"buckets_total"`
+	Error        string `bson:"error,omitempty" json:"error,omitempty"`
+	// JobID is the job that last ran the backfill
+	JobID     string    `bson:"job_id" json:"job_id"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }